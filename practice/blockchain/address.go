@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// ------------------------------
+// 地址模块封装
+// ------------------------------
+
+const (
+	// AddressVersionPubKeyHash 公钥哈希地址的版本号
+	AddressVersionPubKeyHash byte = 0x00
+
+	// AddressVersionScriptHash 脚本哈希地址的版本号（哈希对象为赎回脚本，如多签脚本）
+	AddressVersionScriptHash byte = 0x05
+
+	// AddressVersionContract 合约地址的版本号（哈希对象为部署者地址与部署交易序号）
+	AddressVersionContract byte = 0x1c
+
+	// AddressHashLen 地址中公钥哈希的长度（字节）
+	AddressHashLen = 20
+)
+
+// Address 由公钥哈希派生的地址，文本形式为Base58Check编码
+type Address struct {
+	version byte
+	hash    [AddressHashLen]byte
+}
+
+// NewAddressFromPublicKey 根据公钥（DER字节）生成地址
+func NewAddressFromPublicKey(publicKey []byte) Address {
+	return Address{
+		version: AddressVersionPubKeyHash,
+		hash:    hashPublicKey(publicKey),
+	}
+}
+
+// hashPublicKey 计算公钥哈希：双SHA-256后取前20字节
+func hashPublicKey(publicKey []byte) [AddressHashLen]byte {
+	first := sha256.Sum256(publicKey)
+	second := sha256.Sum256(first[:])
+	var h [AddressHashLen]byte
+	copy(h[:], second[:AddressHashLen])
+	return h
+}
+
+// ParseAddress 解析Base58Check编码的地址，拼写错误会因校验和不匹配被拒绝
+func ParseAddress(s string) (Address, error) {
+	version, payload, err := base58CheckDecode(s)
+	if err != nil {
+		return Address{}, fmt.Errorf("无效地址 %q: %w", s, err)
+	}
+	if !isKnownAddressVersion(version) {
+		return Address{}, fmt.Errorf("无效地址 %q: 未知版本号 0x%02x", s, version)
+	}
+	if len(payload) != AddressHashLen {
+		return Address{}, fmt.Errorf("无效地址 %q: 哈希长度应为%d字节，实际%d字节", s, AddressHashLen, len(payload))
+	}
+	var a Address
+	a.version = version
+	copy(a.hash[:], payload)
+	return a, nil
+}
+
+// isKnownAddressVersion 检查版本号是否受支持
+func isKnownAddressVersion(version byte) bool {
+	return version == AddressVersionPubKeyHash || version == AddressVersionScriptHash ||
+		version == AddressVersionContract
+}
+
+// ValidateAddress 检查地址字符串是否合法
+func ValidateAddress(s string) bool {
+	_, err := ParseAddress(s)
+	return err == nil
+}
+
+// String 返回地址的Base58Check编码
+func (a Address) String() string {
+	return base58CheckEncode(a.version, a.hash[:])
+}
+
+// 其他必要的getter方法
+func (a Address) Version() byte              { return a.version }
+func (a Address) Hash() [AddressHashLen]byte { return a.hash }
+func (a Address) IsZero() bool               { return a == Address{} }
+func (a Address) IsScriptHash() bool         { return a.version == AddressVersionScriptHash }
+func (a Address) IsContract() bool           { return a.version == AddressVersionContract }
+
+// MarshalText 序列化为Base58Check字符串（用于JSON）
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText 从Base58Check字符串反序列化
+func (a *Address) UnmarshalText(text []byte) error {
+	parsed, err := ParseAddress(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------
+// 金额：以最小单位计数的整数，避免浮点误差；运算溢出或结果为负时返回错误。
+// 与ERC-20的decimals类似，显示和解析时按指定小数位数换算
+// ------------------------------
+
+// Amount 以最小单位计数的金额
+type Amount uint64
+
+// Decimals 本链金额的小数位数，1个币 = 10^Decimals 个最小单位
+const Decimals = 8
+
+// Coin 1个币对应的最小单位数
+const Coin Amount = 100_000_000
+
+// MaxAmount 可表示的最大金额
+const MaxAmount Amount = math.MaxUint64
+
+// maxDecimals uint64能完整表示的最大小数位数
+const maxDecimals = 19
+
+// 金额运算错误
+var (
+	ErrAmountOverflow = errors.New("金额溢出")
+	ErrAmountNegative = errors.New("金额不能为负数")
+)
+
+// Add 加法，溢出时返回错误
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum, carry := bits.Add64(uint64(a), uint64(b), 0)
+	if carry != 0 {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(sum), nil
+}
+
+// Sub 减法，结果为负时返回错误
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, ErrAmountNegative
+	}
+	return a - b, nil
+}
+
+// Mul 乘以整数，溢出时返回错误
+func (a Amount) Mul(n uint64) (Amount, error) {
+	hi, lo := bits.Mul64(uint64(a), n)
+	if hi != 0 {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(lo), nil
+}
+
+// SumAmounts 累加多个金额，溢出时返回错误
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// ParseAmount 按指定小数位数解析十进制字符串，如 ParseAmount("1.5", 8) = 150000000；
+// 小数位超过decimals、负数或溢出时返回错误
+func ParseAmount(s string, decimals int) (Amount, error) {
+	if decimals < 0 || decimals > maxDecimals {
+		return 0, fmt.Errorf("小数位数应在0到%d之间，实际%d", maxDecimals, decimals)
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") {
+		return 0, ErrAmountNegative
+	}
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" && frac == "" || hasPoint && frac == "" {
+		return 0, fmt.Errorf("金额格式错误: %q", s)
+	}
+	if len(frac) > decimals {
+		return 0, fmt.Errorf("金额 %q 的小数位超过%d位", s, decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", decimals-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("金额格式错误: %q", s)
+		}
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(n), nil
+}
+
+// ParseCoins 按本链小数位数解析金额
+func ParseCoins(s string) (Amount, error) {
+	return ParseAmount(s, Decimals)
+}
+
+// Format 按指定小数位数格式化，去掉末尾多余的0，如 150000000 -> "1.5"
+func (a Amount) Format(decimals int) string {
+	digits := strconv.FormatUint(uint64(a), 10)
+	if decimals <= 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// String 按本链小数位数显示
+func (a Amount) String() string {
+	return a.Format(Decimals)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// ------------------------------
+// Base58Check 编码（自实现，不依赖第三方库）
+// ------------------------------
+
+// base58Alphabet 去掉了容易混淆的 0、O、I、l
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Index 字符到数值的反查表，非法字符为 -1
+var base58Index = func() [256]int {
+	var idx [256]int
+	for i := range idx {
+		idx[i] = -1
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		idx[base58Alphabet[i]] = i
+	}
+	return idx
+}()
+
+// base58Encode 将字节串编码为Base58字符串，前导零字节编码为'1'
+func base58Encode(input []byte) string {
+	zeros := 0
+	for zeros < len(input) && input[zeros] == 0 {
+		zeros++
+	}
+
+	// 逐字节做大数进制转换（256进制 -> 58进制）
+	digits := make([]byte, 0, len(input)*138/100+1)
+	for _, b := range input[zeros:] {
+		carry := int(b)
+		for i := 0; i < len(digits); i++ {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+
+	out := make([]byte, 0, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out = append(out, base58Alphabet[0])
+	}
+	for i := len(digits) - 1; i >= 0; i-- {
+		out = append(out, base58Alphabet[digits[i]])
+	}
+	return string(out)
+}
+
+// base58Decode 将Base58字符串解码为字节串
+func base58Decode(input string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(input) && input[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	bytesLE := make([]byte, 0, len(input)*733/1000+1)
+	for i := zeros; i < len(input); i++ {
+		val := base58Index[input[i]]
+		if val < 0 {
+			return nil, fmt.Errorf("非法的Base58字符 %q（位置 %d）", input[i], i)
+		}
+		carry := val
+		for j := 0; j < len(bytesLE); j++ {
+			carry += int(bytesLE[j]) * 58
+			bytesLE[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			bytesLE = append(bytesLE, byte(carry))
+			carry >>= 8
+		}
+	}
+
+	out := make([]byte, zeros, zeros+len(bytesLE))
+	for i := len(bytesLE) - 1; i >= 0; i-- {
+		out = append(out, bytesLE[i])
+	}
+	return out, nil
+}
+
+// checksum 计算双SHA-256的前4字节作为校验和
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// base58CheckEncode 编码格式：版本号(1字节) + 数据 + 校验和(4字节)
+func base58CheckEncode(version byte, payload []byte) string {
+	data := make([]byte, 0, 1+len(payload)+4)
+	data = append(data, version)
+	data = append(data, payload...)
+	data = append(data, checksum(data)...)
+	return base58Encode(data)
+}
+
+// base58CheckDecode 解码并校验，返回版本号和数据部分
+func base58CheckDecode(input string) (byte, []byte, error) {
+	data, err := base58Decode(input)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 5 {
+		return 0, nil, fmt.Errorf("Base58Check数据过短: %d字节", len(data))
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if !bytes.Equal(checksum(body), sum) {
+		return 0, nil, fmt.Errorf("Base58Check校验和不匹配")
+	}
+	return body[0], body[1:], nil
+}
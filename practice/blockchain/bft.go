@@ -0,0 +1,849 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ------------------------------
+// 拜占庭容错共识（Tendermint式）：固定的验证者集合按高度与轮次轮换提出者，
+// 每轮依次进行提案、预投票、预提交，各阶段超时后进入下一阶段或下一轮。
+// 超过三分之二验证者预提交同一区块即提交，预提交签名作为提交证书随区块保存；
+// 已提交的区块最终确定、永不回滚。n = 3f+1 个验证者中最多容忍 f 个故障
+// ------------------------------
+
+// BFTConfig 拜占庭容错共识参数
+type BFTConfig struct {
+	Validators []Address `json:"validators"` // 固定的验证者集合，提出者按此顺序轮换
+}
+
+func (c BFTConfig) validate() error {
+	if len(c.Validators) == 0 {
+		return errors.New("拜占庭容错共识至少需要一个验证者")
+	}
+	seen := make(map[Address]bool)
+	for i, validator := range c.Validators {
+		if validator.IsZero() || seen[validator] {
+			return fmt.Errorf("第%d个验证者地址为空或重复", i)
+		}
+		seen[validator] = true
+	}
+	return nil
+}
+
+// quorum 法定票数：超过三分之二，n = 3f+1 时为 2f+1
+func (c BFTConfig) quorum() int {
+	return len(c.Validators)*2/3 + 1
+}
+
+// maxFaulty 可容忍的故障验证者数 f
+func (c BFTConfig) maxFaulty() int {
+	return (len(c.Validators) - 1) / 3
+}
+
+// proposer 指定高度与轮次的提出者
+func (c BFTConfig) proposer(height, round int) Address {
+	return c.Validators[(height+round)%len(c.Validators)]
+}
+
+func (c BFTConfig) isValidator(addr Address) bool {
+	for _, validator := range c.Validators {
+		if validator == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------
+// 投票与提交证书
+// ------------------------------
+
+// BFTVoteType 投票类型
+type BFTVoteType string
+
+// 投票类型
+const (
+	BFTPrevote   BFTVoteType = "prevote"
+	BFTPrecommit BFTVoteType = "precommit"
+)
+
+// BFTVote 验证者对某高度某轮次区块的签名投票，BlockHash为空表示投空票
+type BFTVote struct {
+	Type      BFTVoteType `json:"type"`
+	Height    int         `json:"height"`
+	Round     int         `json:"round"`
+	BlockHash string      `json:"block_hash,omitempty"`
+	PublicKey []byte      `json:"public_key"`
+	Signature []byte      `json:"signature"`
+}
+
+func (v *BFTVote) signingBytes(chainID string) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%d:%d:%s", chainID, v.Type, v.Height, v.Round, v.BlockHash))
+}
+
+// signBFTVote 创建并签名投票
+func signBFTVote(chainID string, voteType BFTVoteType, height, round int, blockHash string, key KeyPair) (*BFTVote, error) {
+	vote := &BFTVote{Type: voteType, Height: height, Round: round, BlockHash: blockHash, PublicKey: key.PublicKeyBytes()}
+	signature, err := key.Sign(vote.signingBytes(chainID))
+	if err != nil {
+		return nil, err
+	}
+	vote.Signature = signature
+	return vote, nil
+}
+
+// Validator 投票的验证者地址
+func (v *BFTVote) Validator() Address {
+	return NewAddressFromPublicKey(v.PublicKey)
+}
+
+func (v *BFTVote) verify(chainID string) error {
+	if v.Type != BFTPrevote && v.Type != BFTPrecommit {
+		return fmt.Errorf("未知的投票类型: %q", v.Type)
+	}
+	if err := VerifySignature(v.PublicKey, v.signingBytes(chainID), v.Signature); err != nil {
+		return fmt.Errorf("投票签名无效: %w", err)
+	}
+	return nil
+}
+
+// CommitCertificate 提交证书：超过三分之二验证者在同一轮次对区块的预提交签名
+type CommitCertificate struct {
+	Height     int        `json:"height"`
+	Round      int        `json:"round"`
+	BlockHash  string     `json:"block_hash"`
+	Precommits []*BFTVote `json:"precommits"`
+}
+
+// Signers 在证书上签名的验证者
+func (c *CommitCertificate) Signers() []Address {
+	signers := make([]Address, len(c.Precommits))
+	for i, vote := range c.Precommits {
+		signers[i] = vote.Validator()
+	}
+	return signers
+}
+
+// verify 校验证书对应该区块头，且有法定数量的不同验证者签名
+func (c *CommitCertificate) verify(chainID string, config BFTConfig, header BlockHeader) error {
+	if c.Height != header.Index || c.BlockHash != header.Hash {
+		return errors.New("证书与区块不符")
+	}
+	if c.Round < header.Round {
+		return fmt.Errorf("提交轮次%d早于区块提出轮次%d", c.Round, header.Round)
+	}
+	seen := make(map[Address]bool)
+	for i, vote := range c.Precommits {
+		if vote.Type != BFTPrecommit || vote.Height != c.Height || vote.Round != c.Round || vote.BlockHash != c.BlockHash {
+			return fmt.Errorf("第%d个签名不是该区块本轮的预提交", i)
+		}
+		validator := vote.Validator()
+		if !config.isValidator(validator) || seen[validator] {
+			return fmt.Errorf("第%d个签名者 %s 不是验证者或重复签名", i, validator)
+		}
+		if err := vote.verify(chainID); err != nil {
+			return fmt.Errorf("第%d个签名: %w", i, err)
+		}
+		seen[validator] = true
+	}
+	if len(seen) < config.quorum() {
+		return fmt.Errorf("预提交签名%d个，不足%d个", len(seen), config.quorum())
+	}
+	return nil
+}
+
+// ------------------------------
+// 共识引擎
+// ------------------------------
+
+// BFTEngine 拜占庭容错共识引擎：区块由BFTNode投票产生，接入时校验提出者签名与提交证书
+type BFTEngine struct {
+	chainID string
+	config  BFTConfig
+}
+
+// NewBFTEngine 创建拜占庭容错共识引擎
+func NewBFTEngine(chainID string, config BFTConfig) *BFTEngine {
+	return &BFTEngine{chainID: chainID, config: config}
+}
+
+// Name 共识名称
+func (e *BFTEngine) Name() string { return ConsensusBFT }
+
+// Config 返回拜占庭容错参数
+func (e *BFTEngine) Config() BFTConfig { return e.config }
+
+// Prepare 拜占庭容错共识不能单独出块
+func (e *BFTEngine) Prepare(chain ChainReader, header *BlockHeader, signer KeyPair) error {
+	return errors.New("拜占庭容错共识须由BFTNode投票出块")
+}
+
+// Seal 提出者签名区块头
+func (e *BFTEngine) Seal(parent BlockHeader, header *BlockHeader, signer KeyPair) error {
+	if signer == nil {
+		return errors.New("拜占庭容错共识出块需要设置签名密钥")
+	}
+	return signHeader(e.chainID, header, signer)
+}
+
+// VerifySeal 校验区块头由其轮次的提出者签名
+func (e *BFTEngine) VerifySeal(chain ChainReader, header BlockHeader) error {
+	if header.Round < 0 {
+		return errors.New("轮次不能为负数")
+	}
+	signer, err := verifySignerSeal(e.chainID, header)
+	if err != nil {
+		return err
+	}
+	if proposer := e.config.proposer(header.Index, header.Round); signer != proposer {
+		return fmt.Errorf("%w: 高度%d第%d轮应由 %s 提出，实际为 %s", ErrNotProposer, header.Index, header.Round, proposer, signer)
+	}
+	return nil
+}
+
+// VerifyCommit 校验区块头附带的提交证书
+func (e *BFTEngine) VerifyCommit(chain ChainReader, header BlockHeader) error {
+	if header.Commit == nil {
+		return errors.New("区块缺少提交证书")
+	}
+	return header.Commit.verify(e.chainID, e.config, header)
+}
+
+// Weight 已提交的区块不会分叉，每个区块权重相同
+func (e *BFTEngine) Weight(chain ChainReader, header BlockHeader) *big.Int {
+	return big.NewInt(1)
+}
+
+// FinalizedHeight 已最终确定的最高区块高度
+func (bc *Blockchain) FinalizedHeight() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.finalized
+}
+
+// proposeBlock 以当前链尾组装第round轮的提案区块并签名，不接入链
+func (bc *Blockchain) proposeBlock(round int, signer KeyPair) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	lastBlock, transactions, timestamp := bc.blockTemplate()
+	header := BlockHeader{
+		Index:        lastBlock.Index() + 1,
+		Timestamp:    timestamp,
+		MerkleRoot:   transactionsMerkleRoot(transactions),
+		PreviousHash: lastBlock.Hash(),
+		Round:        round,
+		BaseFee:      bc.genesis.Params.nextBaseFee(lastBlock.Header()),
+		GasUsed:      totalGas(transactions),
+	}
+	if err := bc.engine.Seal(lastBlock.Header(), &header, signer); err != nil {
+		return nil, err
+	}
+	return newBlockFromHeader(header, transactions), nil
+}
+
+// validateProposal 校验提案区块能否接在链尾（不含提交证书）
+func (bc *Blockchain) validateProposal(block *Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validateCandidate(block)
+}
+
+// ------------------------------
+// 消息与传输
+// ------------------------------
+
+// BFTProposal 提出者广播的提案；ValidRound为该区块此前获得法定预投票的轮次，新区块为-1
+type BFTProposal struct {
+	Height     int
+	Round      int
+	ValidRound int
+	Block      *Block
+	PublicKey  []byte
+	Signature  []byte
+}
+
+func (p *BFTProposal) signingBytes(chainID string) []byte {
+	return []byte(fmt.Sprintf("%s:proposal:%d:%d:%d:%s", chainID, p.Height, p.Round, p.ValidRound, p.Block.Hash()))
+}
+
+// BFTMessage 验证者之间广播的共识消息，提案与投票二选一
+type BFTMessage struct {
+	Proposal *BFTProposal
+	Vote     *BFTVote
+}
+
+// BFTTransport 共识消息的广播通道，广播的消息也会投递给自己
+type BFTTransport interface {
+	Broadcast(msg BFTMessage)
+	Receive() <-chan BFTMessage
+}
+
+// LocalBFTNetwork 进程内的共识网络，供测试与演示使用
+type LocalBFTNetwork struct {
+	mu    sync.Mutex
+	peers []*localBFTPeer
+}
+
+type localBFTPeer struct {
+	network *LocalBFTNetwork
+	inbox   chan BFTMessage
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewLocalBFTNetwork 创建进程内共识网络
+func NewLocalBFTNetwork() *LocalBFTNetwork {
+	return &LocalBFTNetwork{}
+}
+
+// Join 加入网络，返回该节点的传输通道
+func (n *LocalBFTNetwork) Join() BFTTransport {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	peer := &localBFTPeer{network: n, inbox: make(chan BFTMessage), closed: make(chan struct{})}
+	n.peers = append(n.peers, peer)
+	return peer
+}
+
+// Close 关闭网络，未投递的消息被丢弃；应在各节点Stop之后调用
+func (n *LocalBFTNetwork) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, peer := range n.peers {
+		peer.once.Do(func() { close(peer.closed) })
+	}
+}
+
+// Broadcast 异步投递给网络中的每个节点，投递顺序不保证
+func (p *localBFTPeer) Broadcast(msg BFTMessage) {
+	p.network.mu.Lock()
+	peers := append([]*localBFTPeer(nil), p.network.peers...)
+	p.network.mu.Unlock()
+	for _, peer := range peers {
+		go func(peer *localBFTPeer) {
+			select {
+			case peer.inbox <- msg:
+			case <-peer.closed:
+			}
+		}(peer)
+	}
+}
+
+func (p *localBFTPeer) Receive() <-chan BFTMessage {
+	return p.inbox
+}
+
+// ------------------------------
+// 验证者节点
+// ------------------------------
+
+// BFTTimeouts 各阶段第0轮的超时，每过一轮增加Delta
+type BFTTimeouts struct {
+	Propose   time.Duration // 等待提案
+	Prevote   time.Duration // 收到法定数量但不一致的预投票后等待
+	Precommit time.Duration // 收到法定数量但不一致的预提交后等待
+	Delta     time.Duration
+	Commit    time.Duration // 提交后等待多久开始下一高度，决定出块间隔
+}
+
+// DefaultBFTTimeouts 默认超时
+var DefaultBFTTimeouts = BFTTimeouts{
+	Propose:   3 * time.Second,
+	Prevote:   time.Second,
+	Precommit: time.Second,
+	Delta:     500 * time.Millisecond,
+	Commit:    time.Second,
+}
+
+// bftStep 轮次内的阶段
+type bftStep int
+
+const (
+	stepNewHeight bftStep = iota // 已提交上一高度，等待开始第0轮
+	stepPropose
+	stepPrevote
+	stepPrecommit
+)
+
+type bftTimeout struct {
+	height, round int
+	step          bftStep
+}
+
+type bftVoteKey struct {
+	voteType BFTVoteType
+	round    int
+}
+
+// bftFutureKey 缓存的下一高度消息，提案的voteType为空
+type bftFutureKey struct {
+	sender   Address
+	voteType BFTVoteType
+	round    int
+}
+
+// bftMaxRoundsAhead 接受的消息最多领先当前轮次的轮数；更高轮次只记录发送者到过的轮次，用于追赶
+const bftMaxRoundsAhead = 8
+
+// BFTNode 验证者节点：通过传输通道与其他验证者投票，提交的区块接入本地区块链。
+// 出块奖励发给区块链设置的矿工地址
+type BFTNode struct {
+	bc        *Blockchain
+	engine    *BFTEngine
+	key       KeyPair
+	transport BFTTransport
+	timeouts  BFTTimeouts
+	timeoutCh chan bftTimeout
+	stop      chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+
+	// 以下状态只在事件循环中访问
+	height, round int
+	step          bftStep
+	lockedBlock   *Block
+	lockedRound   int
+	validBlock    *Block
+	validRound    int
+	proposals     map[int]*BFTProposal
+	votes         map[bftVoteKey]map[Address]*BFTVote
+	latest        map[Address]int             // 各验证者发过消息的最高轮次，用于追赶更高轮次
+	fired         map[string]bool             // 每轮只触发一次的规则
+	validity      map[string]error            // 提案区块的校验结果缓存
+	future        map[bftFutureKey]BFTMessage // 下一高度的消息，进入该高度后处理
+}
+
+// NewBFTNode 创建验证者节点，key须属于创世配置中的验证者
+func NewBFTNode(bc *Blockchain, key KeyPair, transport BFTTransport, timeouts BFTTimeouts) (*BFTNode, error) {
+	engine, ok := bc.Engine().(*BFTEngine)
+	if !ok {
+		return nil, fmt.Errorf("%s共识不能运行验证者节点", bc.Engine().Name())
+	}
+	if !engine.config.isValidator(key.Address()) {
+		return nil, fmt.Errorf("%s 不是验证者", key.Address())
+	}
+	return &BFTNode{
+		bc:        bc,
+		engine:    engine,
+		key:       key,
+		transport: transport,
+		timeouts:  timeouts,
+		timeoutCh: make(chan bftTimeout),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Start 启动事件循环
+func (n *BFTNode) Start() {
+	go n.run()
+}
+
+// Stop 停止事件循环并等待其退出
+func (n *BFTNode) Stop() {
+	n.stopOnce.Do(func() { close(n.stop) })
+	<-n.done
+}
+
+func (n *BFTNode) run() {
+	defer close(n.done)
+	n.enterHeight(n.bc.LastBlock().Index() + 1)
+	n.startRound(0)
+	for {
+		select {
+		case <-n.stop:
+			return
+		case msg := <-n.transport.Receive():
+			n.handle(msg)
+		case t := <-n.timeoutCh:
+			n.onTimeout(t)
+		}
+		n.evaluate()
+	}
+}
+
+// enterHeight 重置到新高度，处理此前缓存的该高度消息
+func (n *BFTNode) enterHeight(height int) {
+	n.height, n.round, n.step = height, 0, stepNewHeight
+	n.lockedBlock, n.lockedRound = nil, -1
+	n.validBlock, n.validRound = nil, -1
+	n.proposals = make(map[int]*BFTProposal)
+	n.votes = make(map[bftVoteKey]map[Address]*BFTVote)
+	n.latest = make(map[Address]int)
+	n.fired = make(map[string]bool)
+	n.validity = make(map[string]error)
+	future := n.future
+	n.future = make(map[bftFutureKey]BFTMessage)
+	for _, msg := range future {
+		n.handle(msg)
+	}
+}
+
+// startRound 进入轮次：提出者广播提案（优先重提已获法定预投票的区块），其他验证者等待提案
+func (n *BFTNode) startRound(round int) {
+	n.round, n.step = round, stepPropose
+	if n.engine.config.proposer(n.height, round) == n.key.Address() {
+		block, validRound := n.validBlock, n.validRound
+		if block == nil {
+			var err error
+			if block, err = n.bc.proposeBlock(round, n.key); err != nil {
+				block = nil
+			}
+		}
+		if block != nil {
+			proposal := &BFTProposal{Height: n.height, Round: round, ValidRound: validRound, Block: block, PublicKey: n.key.PublicKeyBytes()}
+			if signature, err := n.key.Sign(proposal.signingBytes(n.bc.ChainID())); err == nil {
+				proposal.Signature = signature
+				n.transport.Broadcast(BFTMessage{Proposal: proposal})
+			}
+		}
+	}
+	n.schedule(n.timeouts.Propose, stepPropose)
+}
+
+// schedule 在当前高度与轮次设置超时，超时事件送回事件循环
+func (n *BFTNode) schedule(base time.Duration, step bftStep) {
+	t := bftTimeout{height: n.height, round: n.round, step: step}
+	d := base + time.Duration(n.round)*n.timeouts.Delta
+	if step == stepNewHeight {
+		d = base
+	}
+	time.AfterFunc(d, func() {
+		select {
+		case n.timeoutCh <- t:
+		case <-n.stop:
+		}
+	})
+}
+
+// handle 校验并记录消息；下一高度的消息先缓存。
+// 只记录当前轮次之后bftMaxRoundsAhead轮以内的消息，每个验证者每轮每类消息只保留一条，
+// 拜占庭验证者无法用任意高度与轮次的消息耗尽内存
+func (n *BFTNode) handle(msg BFTMessage) {
+	chainID := n.bc.ChainID()
+	var height, round int
+	var sender Address
+	switch {
+	case msg.Proposal != nil:
+		p := msg.Proposal
+		height, round, sender = p.Height, p.Round, NewAddressFromPublicKey(p.PublicKey)
+		if p.Block == nil || p.Block.Index() != p.Height {
+			return
+		}
+		if sender != n.engine.config.proposer(p.Height, p.Round) ||
+			VerifySignature(p.PublicKey, p.signingBytes(chainID), p.Signature) != nil {
+			return
+		}
+	case msg.Vote != nil:
+		v := msg.Vote
+		height, round, sender = v.Height, v.Round, v.Validator()
+		if !n.engine.config.isValidator(sender) || v.verify(chainID) != nil {
+			return
+		}
+	default:
+		return
+	}
+	if round < 0 {
+		return
+	}
+	if height == n.height+1 {
+		key := bftFutureKey{sender: sender, round: round}
+		if msg.Vote != nil {
+			key.voteType = msg.Vote.Type
+		}
+		if _, ok := n.future[key]; !ok && round <= bftMaxRoundsAhead {
+			n.future[key] = msg
+		}
+		return
+	}
+	if height != n.height {
+		return
+	}
+	if latest, ok := n.latest[sender]; !ok || round > latest {
+		n.latest[sender] = round
+	}
+	if round-n.round > bftMaxRoundsAhead {
+		return
+	}
+
+	if msg.Proposal != nil {
+		if _, ok := n.proposals[round]; !ok {
+			n.proposals[round] = msg.Proposal
+		}
+	} else {
+		key := bftVoteKey{msg.Vote.Type, round}
+		if n.votes[key] == nil {
+			n.votes[key] = make(map[Address]*BFTVote)
+		}
+		// 同一验证者在同一轮的重复投票只记第一票
+		if _, ok := n.votes[key][sender]; !ok {
+			n.votes[key][sender] = msg.Vote
+		}
+	}
+}
+
+func (n *BFTNode) onTimeout(t bftTimeout) {
+	if t.height != n.height {
+		return
+	}
+	switch {
+	case t.step == stepNewHeight && n.step == stepNewHeight:
+		n.startRound(0)
+	case t.round != n.round:
+	case t.step == stepPropose && n.step == stepPropose:
+		n.vote(BFTPrevote, "")
+		n.step = stepPrevote
+	case t.step == stepPrevote && n.step == stepPrevote:
+		n.vote(BFTPrecommit, "")
+		n.step = stepPrecommit
+	case t.step == stepPrecommit:
+		n.startRound(n.round + 1)
+	}
+}
+
+// evaluate 按当前收到的消息反复应用共识规则，直到没有规则可触发
+func (n *BFTNode) evaluate() {
+	for n.evaluateOnce() {
+	}
+}
+
+func (n *BFTNode) evaluateOnce() bool {
+	config := n.engine.config
+
+	// 任一轮次收到提案与法定预提交：提交区块
+	for round, p := range n.proposals {
+		if n.count(BFTPrecommit, round, p.Block.Hash()) >= config.quorum() && n.valid(p.Block) {
+			n.commit(p.Block, round)
+			return true
+		}
+	}
+	if n.step == stepNewHeight {
+		return false
+	}
+
+	// 已有f+1个验证者到过更高轮次，说明至少一个诚实节点已进入该轮，直接跟上
+	if round := n.catchUpRound(); round > n.round {
+		n.startRound(round)
+		return true
+	}
+
+	r := n.round
+	p := n.proposals[r]
+	if n.step == stepPropose && p != nil {
+		hash := p.Block.Hash()
+		switch {
+		case p.ValidRound == -1:
+			if n.valid(p.Block) && (n.lockedBlock == nil || n.lockedBlock.Hash() == hash) {
+				n.vote(BFTPrevote, hash)
+			} else {
+				n.vote(BFTPrevote, "")
+			}
+			n.step = stepPrevote
+			return true
+		case p.ValidRound < r && n.count(BFTPrevote, p.ValidRound, hash) >= config.quorum():
+			if n.valid(p.Block) && (n.lockedRound <= p.ValidRound || n.lockedBlock.Hash() == hash) {
+				n.vote(BFTPrevote, hash)
+			} else {
+				n.vote(BFTPrevote, "")
+			}
+			n.step = stepPrevote
+			return true
+		}
+	}
+
+	if n.step == stepPrevote && len(n.votes[bftVoteKey{BFTPrevote, r}]) >= config.quorum() && n.once("prevote-timeout", r) {
+		n.schedule(n.timeouts.Prevote, stepPrevote)
+	}
+
+	// 提案获得法定预投票：锁定并预提交，同时记为可重提的区块
+	if n.step >= stepPrevote && p != nil && n.count(BFTPrevote, r, p.Block.Hash()) >= config.quorum() &&
+		n.valid(p.Block) && n.once("polka", r) {
+		if n.step == stepPrevote {
+			n.lockedBlock, n.lockedRound = p.Block, r
+			n.vote(BFTPrecommit, p.Block.Hash())
+			n.step = stepPrecommit
+		}
+		n.validBlock, n.validRound = p.Block, r
+		return true
+	}
+
+	if n.step == stepPrevote && n.count(BFTPrevote, r, "") >= config.quorum() {
+		n.vote(BFTPrecommit, "")
+		n.step = stepPrecommit
+		return true
+	}
+
+	if len(n.votes[bftVoteKey{BFTPrecommit, r}]) >= config.quorum() && n.once("precommit-timeout", r) {
+		n.schedule(n.timeouts.Precommit, stepPrecommit)
+	}
+	return false
+}
+
+// catchUpRound 至少f+1个验证者都到过的最高轮次，不足f+1个验证者发言时为-1
+func (n *BFTNode) catchUpRound() int {
+	f := n.engine.config.maxFaulty()
+	if len(n.latest) <= f {
+		return -1
+	}
+	rounds := make([]int, 0, len(n.latest))
+	for _, round := range n.latest {
+		rounds = append(rounds, round)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(rounds)))
+	return rounds[f]
+}
+
+// once 规则在本高度的某轮次中首次触发时返回true
+func (n *BFTNode) once(rule string, round int) bool {
+	key := fmt.Sprintf("%s/%d", rule, round)
+	if n.fired[key] {
+		return false
+	}
+	n.fired[key] = true
+	return true
+}
+
+// count 某轮次投给blockHash的票数
+func (n *BFTNode) count(voteType BFTVoteType, round int, blockHash string) int {
+	count := 0
+	for _, vote := range n.votes[bftVoteKey{voteType, round}] {
+		if vote.BlockHash == blockHash {
+			count++
+		}
+	}
+	return count
+}
+
+// valid 提案区块能否接在本地链尾，结果按区块哈希缓存
+func (n *BFTNode) valid(block *Block) bool {
+	err, ok := n.validity[block.Hash()]
+	if !ok {
+		err = n.bc.validateProposal(block)
+		n.validity[block.Hash()] = err
+	}
+	return err == nil
+}
+
+// vote 签名并广播当前轮次的投票
+func (n *BFTNode) vote(voteType BFTVoteType, blockHash string) {
+	vote, err := signBFTVote(n.bc.ChainID(), voteType, n.height, n.round, blockHash, n.key)
+	if err != nil {
+		return
+	}
+	n.transport.Broadcast(BFTMessage{Vote: vote})
+}
+
+// commit 附上提交证书后接入本地链，进入下一高度
+func (n *BFTNode) commit(block *Block, round int) {
+	var precommits []*BFTVote
+	for _, vote := range n.votes[bftVoteKey{BFTPrecommit, round}] {
+		if vote.BlockHash == block.Hash() {
+			precommits = append(precommits, vote)
+		}
+	}
+	sort.Slice(precommits, func(i, j int) bool {
+		return precommits[i].Validator().String() < precommits[j].Validator().String()
+	})
+	header := block.Header()
+	header.Commit = &CommitCertificate{Height: n.height, Round: round, BlockHash: block.Hash(), Precommits: precommits}
+	// 提案区块在节点间共享，接入本地链的是副本；
+	// 接入失败（如本地链已从其他途径同步了该高度）时从本地链尾的下一高度重新开始
+	n.bc.AddBlock(newBlockFromHeader(header, block.Transactions()))
+	n.enterHeight(n.bc.LastBlock().Index() + 1)
+	n.schedule(n.timeouts.Commit, stepNewHeight)
+}
+
+// ------------------------------
+// 演示使用：四个验证者容忍一个故障
+// ------------------------------
+
+// runBFTDemo 四个验证者中一个离线，其余三个仍能逐块达成共识，已提交的区块不能回滚
+func runBFTDemo() {
+	const validators = 4
+	keys := make([]KeyPair, validators)
+	genesis := &Genesis{
+		ChainID:       "upchain-bft-demo",
+		Timestamp:     devGenesisTime,
+		Consensus:     ConsensusBFT,
+		HashAlgorithm: HashSHA256,
+		BFT:           &BFTConfig{},
+		Params:        DefaultConsensusParams,
+	}
+	for i := range keys {
+		key, err := NewEd25519KeyPair()
+		if err != nil {
+			fmt.Printf("生成密钥失败: %v\n", err)
+			return
+		}
+		keys[i] = key
+		genesis.BFT.Validators = append(genesis.BFT.Validators, key.Address())
+	}
+	// 第1个区块第0轮的提出者离线，其余验证者需超时后进入下一轮
+	offline := 1 % validators
+
+	network := NewLocalBFTNetwork()
+	timeouts := BFTTimeouts{
+		Propose:   200 * time.Millisecond,
+		Prevote:   100 * time.Millisecond,
+		Precommit: 100 * time.Millisecond,
+		Delta:     50 * time.Millisecond,
+		Commit:    50 * time.Millisecond,
+	}
+	var chains []*Blockchain
+	var nodes []*BFTNode
+	for i, key := range keys {
+		if i == offline {
+			continue
+		}
+		bc, err := NewBlockchain(genesis)
+		if err != nil {
+			fmt.Printf("创建区块链失败: %v\n", err)
+			return
+		}
+		bc.SetMinerAddress(key.Address())
+		node, err := NewBFTNode(bc, key, network.Join(), timeouts)
+		if err != nil {
+			fmt.Printf("创建验证者节点失败: %v\n", err)
+			return
+		}
+		chains = append(chains, bc)
+		nodes = append(nodes, node)
+	}
+	fmt.Printf("%d个验证者，法定票数%d，可容忍%d个故障；验证者%d离线\n",
+		validators, genesis.BFT.quorum(), genesis.BFT.maxFaulty(), offline)
+	for _, node := range nodes {
+		node.Start()
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for chains[0].LastBlock().Index() < 3 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, node := range nodes {
+		node.Stop()
+	}
+	network.Close()
+
+	bc := chains[0]
+	for _, block := range bc.Blocks()[1:] {
+		commit := block.Commit()
+		fmt.Printf("区块%d 提出轮次%d 提交轮次%d 预提交签名%d个 哈希 %s…\n",
+			block.Index(), block.Round(), commit.Round, len(commit.Precommits), block.Hash()[:16])
+	}
+	for i, other := range chains[1:] {
+		height := bc.LastBlock().Index()
+		if other.LastBlock().Index() < height {
+			height = other.LastBlock().Index()
+		}
+		same := bc.Blocks()[height].Hash() == other.Blocks()[height].Hash()
+		fmt.Printf("节点%d与节点0在高度%d的区块一致: %v\n", i+1, height, same)
+	}
+	if _, err := bc.DisconnectTip(); err != nil {
+		fmt.Printf("回滚链尾被拒绝: %v\n", err)
+	}
+}
@@ -306,10 +306,17 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -319,32 +326,233 @@ import (
 
 // Transaction 表示一笔交易，字段设为私有，通过方法访问
 type Transaction struct {
-	sender    string
-	recipient string
-	amount    float64
+	sender    Address
+	recipient Address
+	amount    Amount
+	// 输出的锁定脚本：由收款地址决定，规定这笔资金今后的花费条件
+	lockScript Script
+	// 输入的解锁脚本：满足发送方地址锁定脚本的签名等数据
+	unlockScript Script
+	// 绝对时间锁：小于lockTimeThreshold为最早可打包的区块高度，否则为Unix秒；0表示不限制
+	lockTime int64
+	// 相对时间锁：收款方须在本交易打包后再等待的区块数才能花费这笔资金
+	relativeLock int
+	// 发送方序号：每个发送方从0开始逐笔递增，防止同一笔签名交易被重复提交
+	nonce uint64
+	// 链ID：签名覆盖链ID，使交易不能在使用相同密钥的其他链上重放
+	chainID string
+	// 最高手续费：发送方愿意支付的上限，实际支付基础费用（销毁）加小费（归矿工），其余退回
+	fee Amount
+	// 最高小费：在基础费用之外愿意支付给矿工的部分
+	tip Amount
+	// 是否指定了最高小费（可以为0）；未指定的交易按传统交易处理
+	hasTip bool
+	// 交易类型：普通转账或质押相关操作
+	kind TxKind
+	// 双签证据：仅惩罚交易携带
+	evidence *DoubleSignEvidence
+	// 合约交易的数据：部署交易为合约代码，调用交易为编码后的调用参数
+	data []byte
+	// 合约交易的gas上限
+	gasLimit uint64
 }
 
 // NewTransaction 创建新交易
-func NewTransaction(sender, recipient string, amount float64) *Transaction {
+func NewTransaction(sender, recipient Address, amount Amount) *Transaction {
 	return &Transaction{
-		sender:    sender,
-		recipient: recipient,
-		amount:    amount,
+		sender:     sender,
+		recipient:  recipient,
+		amount:     amount,
+		lockScript: LockScriptForAddress(recipient),
+	}
+}
+
+// NewCoinbaseTransaction 创建挖矿奖励交易（无发送方、无需签名），
+// 以区块高度作为序号，保证每个区块的奖励交易ID不同
+func NewCoinbaseTransaction(recipient Address, amount Amount, height int) *Transaction {
+	return &Transaction{
+		recipient:  recipient,
+		amount:     amount,
+		lockScript: LockScriptForAddress(recipient),
+		nonce:      uint64(height),
 	}
 }
 
 // 提供必要的getter方法，隐藏内部实现
-func (t *Transaction) Sender() string    { return t.sender }
-func (t *Transaction) Recipient() string { return t.recipient }
-func (t *Transaction) Amount() float64   { return t.amount }
+func (t *Transaction) Sender() Address      { return t.sender }
+func (t *Transaction) Recipient() Address   { return t.recipient }
+func (t *Transaction) Amount() Amount       { return t.amount }
+func (t *Transaction) LockScript() Script   { return t.lockScript }
+func (t *Transaction) UnlockScript() Script { return t.unlockScript }
+func (t *Transaction) LockTime() int64      { return t.lockTime }
+func (t *Transaction) RelativeLock() int    { return t.relativeLock }
+func (t *Transaction) Nonce() uint64        { return t.nonce }
+func (t *Transaction) ChainID() string      { return t.chainID }
+func (t *Transaction) Fee() Amount          { return t.fee }
+func (t *Transaction) Tip() Amount          { return t.tip }
+func (t *Transaction) HasTip() bool         { return t.hasTip }
+func (t *Transaction) Kind() TxKind         { return t.kind }
+func (t *Transaction) Data() []byte         { return t.data }
+func (t *Transaction) GasLimit() uint64     { return t.gasLimit }
+
+// Evidence 惩罚交易携带的双签证据，其他交易为nil
+func (t *Transaction) Evidence() *DoubleSignEvidence { return t.evidence }
+
+// Cost 发送方可花费余额的最大总支出：转账与质押为金额 + 最高手续费，
+// 解除质押与惩罚只支付手续费；已上链交易的实际支出见CostAt
+func (t *Transaction) Cost() (Amount, error) {
+	return t.costWithFee(t.fee)
+}
+
+// CostAt 交易在基础费用为baseFee的区块中的实际支出
+func (t *Transaction) CostAt(baseFee Amount) (Amount, error) {
+	burn, tip, err := t.feesAt(baseFee)
+	if err != nil {
+		return 0, err
+	}
+	fee, err := burn.Add(tip)
+	if err != nil {
+		return 0, err
+	}
+	return t.costWithFee(fee)
+}
+
+func (t *Transaction) costWithFee(fee Amount) (Amount, error) {
+	switch t.kind {
+	case TxUnstake, TxSlash:
+		return fee, nil
+	}
+	return t.amount.Add(fee)
+}
 
-// ToMap 用于序列化，避免直接暴露字段
+// Credit 收款方入账的金额：质押与惩罚交易不入账
+func (t *Transaction) Credit() Amount {
+	switch t.kind {
+	case TxStake, TxSlash:
+		return 0
+	}
+	return t.amount
+}
+
+// Size 交易序列化后的字节数，用于交易池容量与区块大小计算
+func (t *Transaction) Size() int {
+	bytes, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	return len(bytes)
+}
+
+// IsCoinbase 判断是否为挖矿奖励交易
+func (t *Transaction) IsCoinbase() bool {
+	return t.sender.IsZero()
+}
+
+// signingBytes 返回签名覆盖的内容（不含公钥和签名本身）
+func (t *Transaction) signingBytes() []byte {
+	m := map[string]interface{}{
+		"sender":        t.sender.String(),
+		"recipient":     t.recipient.String(),
+		"amount":        t.amount,
+		"lock_script":   hex.EncodeToString(t.lockScript),
+		"lock_time":     t.lockTime,
+		"relative_lock": t.relativeLock,
+		"nonce":         t.nonce,
+		"chain_id":      t.chainID,
+		"fee":           t.fee,
+	}
+	if t.hasTip {
+		m["tip"] = t.tip
+	}
+	m["kind"] = t.kind
+	if t.evidence != nil {
+		m["evidence"] = t.evidence
+	}
+	t.addContractFields(m)
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+// Sign 使用发送方私钥签名，生成标准P2PKH解锁脚本，密钥地址必须与发送方一致
+func (t *Transaction) Sign(keys KeyPair) error {
+	if keys.Address() != t.sender {
+		return fmt.Errorf("签名密钥地址 %s 与发送方 %s 不一致", keys.Address(), t.sender)
+	}
+	signature, err := keys.Sign(t.signingBytes())
+	if err != nil {
+		return err
+	}
+	t.unlockScript = PayToPubKeyHashUnlockScript(signature, keys.PublicKeyBytes())
+	return nil
+}
+
+// SetUnlockScript 设置自定义解锁脚本（用于花费脚本哈希地址）
+func (t *Transaction) SetUnlockScript(script Script) {
+	t.unlockScript = script
+}
+
+// Verify 以当前时间、无区块高度要求做基本验证
+func (t *Transaction) Verify() error {
+	return t.VerifyAt(ScriptContext{BlockTime: time.Now().UnixNano()})
+}
+
+// VerifyAt 在给定区块上下文中验证：输出锁定脚本须为收款地址的标准脚本，
+// 解锁脚本须满足发送方地址的锁定脚本
+func (t *Transaction) VerifyAt(ctx ScriptContext) error {
+	if !bytes.Equal(t.lockScript, LockScriptForAddress(t.recipient)) {
+		return errors.New("输出锁定脚本与收款地址不匹配")
+	}
+	if t.IsCoinbase() {
+		return nil
+	}
+	if len(t.unlockScript) == 0 {
+		return errors.New("交易未签名")
+	}
+	ctx.SigData = t.signingBytes()
+	return VerifyScripts(t.unlockScript, LockScriptForAddress(t.sender), ctx)
+}
+
+// ID 交易哈希，覆盖包括签名在内的全部内容
+func (t *Transaction) ID() string {
+	bytes, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(bytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// ToMap 用于序列化，避免直接暴露字段；非惩罚交易不输出证据，非合约交易不输出合约字段
 func (t *Transaction) ToMap() map[string]interface{} {
-	return map[string]interface{}{
-		"sender":    t.sender,
-		"recipient": t.recipient,
-		"amount":    t.amount,
+	m := map[string]interface{}{
+		"sender":        t.sender.String(),
+		"recipient":     t.recipient.String(),
+		"amount":        t.amount,
+		"lock_script":   hex.EncodeToString(t.lockScript),
+		"unlock_script": hex.EncodeToString(t.unlockScript),
+		"lock_time":     t.lockTime,
+		"relative_lock": t.relativeLock,
+		"nonce":         t.nonce,
+		"chain_id":      t.chainID,
+		"fee":           t.fee,
+	}
+	if t.hasTip {
+		m["tip"] = t.tip
+	}
+	m["kind"] = t.kind
+	if t.evidence != nil {
+		m["evidence"] = t.evidence
 	}
+	t.addContractFields(m)
+	return m
+}
+
+// MarshalJSON 通过ToMap序列化，使区块哈希覆盖交易内容
+func (t *Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.ToMap())
 }
 
 // ------------------------------
@@ -356,17 +564,85 @@ type Block struct {
 	index        int
 	timestamp    int64 // 纳秒级时间戳
 	transactions []*Transaction
+	merkleRoot   string // 交易ID的Merkle根，区块哈希只覆盖区块头
 	proof        int
 	previousHash string
-	hash         string // 缓存当前区块哈希，避免重复计算
+	round        int                // 拜占庭容错共识中区块被提出的轮次
+	vote         *SignerVote        // 权威证明出块者对出块者集合变更的投票
+	seal         []byte             // 出块者对区块头的签名，未设置签名密钥的工作量证明区块为空
+	commit       *CommitCertificate // 拜占庭容错共识的提交证书，对区块哈希签名，不参与哈希
+	baseFee      Amount             // 区块内交易每单位gas的基础费用，由前一区块头决定
+	gasUsed      uint64             // 区块内交易的gas合计
+	hash         string             // 缓存当前区块哈希，避免重复计算
+	pruned       bool               // 区块体已裁剪，只保留区块头
+	weight       *big.Int           // 接入时由共识引擎计算的分叉选择权重，不参与哈希
+}
+
+// BlockHeader 区块头：不含交易列表，轻节点只同步区块头
+type BlockHeader struct {
+	Index        int                `json:"index"`
+	Timestamp    int64              `json:"timestamp"`
+	MerkleRoot   string             `json:"merkle_root"`
+	Proof        int                `json:"proof"`
+	PreviousHash string             `json:"previous_hash"`
+	Round        int                `json:"round,omitempty"`
+	Vote         *SignerVote        `json:"vote,omitempty"`
+	Seal         []byte             `json:"seal,omitempty"`
+	Commit       *CommitCertificate `json:"commit,omitempty"`
+	BaseFee      Amount             `json:"base_fee,omitempty"`
+	GasUsed      uint64             `json:"gas_used,omitempty"`
+	Hash         string             `json:"hash"`
+}
+
+// calculateHash 计算区块头哈希（不含Hash字段本身）
+func (h BlockHeader) calculateHash() string {
+	return h.digest(true)
 }
 
-// NewBlock 创建新区块
-func NewBlock(index int, proof int, previousHash string, transactions []*Transaction) *Block {
+// sealHash 共识签名覆盖的区块头哈希（不含封装数据与Hash字段）
+func (h BlockHeader) sealHash() string {
+	return h.digest(false)
+}
+
+func (h BlockHeader) digest(withSeal bool) string {
+	data := map[string]interface{}{
+		"index":         h.Index,
+		"timestamp":     h.Timestamp,
+		"merkle_root":   h.MerkleRoot,
+		"proof":         h.Proof,
+		"previous_hash": h.PreviousHash,
+		"base_fee":      h.BaseFee,
+		"gas_used":      h.GasUsed,
+	}
+	if h.Round != 0 {
+		data["round"] = h.Round
+	}
+	if h.Vote != nil {
+		data["vote"] = h.Vote
+	}
+	if withSeal {
+		data["seal"] = hex.EncodeToString(h.Seal)
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(bytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// NewBlock 以clock的当前时间创建新区块
+func NewBlock(clock Clock, index int, proof int, previousHash string, transactions []*Transaction) *Block {
+	return newBlockAt(index, clock.Now().UnixNano(), proof, previousHash, transactions)
+}
+
+// newBlockAt 以指定时间戳创建区块（交易的时间锁需按区块时间判断）
+func newBlockAt(index int, timestamp int64, proof int, previousHash string, transactions []*Transaction) *Block {
 	block := &Block{
 		index:        index,
-		timestamp:    time.Now().UnixNano(),
+		timestamp:    timestamp,
 		transactions: transactions,
+		merkleRoot:   transactionsMerkleRoot(transactions),
 		proof:        proof,
 		previousHash: previousHash,
 	}
@@ -374,22 +650,79 @@ func NewBlock(index int, proof int, previousHash string, transactions []*Transac
 	return block
 }
 
-// 计算区块哈希（私有方法，仅内部调用）
+// 计算区块哈希（私有方法，仅内部调用），交易通过Merkle根间接覆盖
 func (b *Block) calculateHash() string {
-	// 序列化区块数据（仅包含必要字段）
-	data := map[string]interface{}{
-		"index":         b.index,
-		"timestamp":     b.timestamp,
-		"transactions":  b.transactions,
-		"proof":         b.proof,
-		"previous_hash": b.previousHash,
+	return b.Header().calculateHash()
+}
+
+// newBlockFromHeader 由共识引擎封装好的区块头与交易创建区块
+func newBlockFromHeader(h BlockHeader, transactions []*Transaction) *Block {
+	block := &Block{
+		index:        h.Index,
+		timestamp:    h.Timestamp,
+		transactions: transactions,
+		merkleRoot:   h.MerkleRoot,
+		proof:        h.Proof,
+		previousHash: h.PreviousHash,
+		round:        h.Round,
+		vote:         h.Vote,
+		seal:         h.Seal,
+		commit:       h.Commit,
+		baseFee:      h.BaseFee,
+		gasUsed:      h.GasUsed,
 	}
-	bytes, err := json.Marshal(data)
-	if err != nil {
-		panic(err)
+	block.hash = block.calculateHash()
+	return block
+}
+
+// transactionsMerkleRoot 交易列表的Merkle根
+func transactionsMerkleRoot(txs []*Transaction) string {
+	return MerkleRoot(transactionIDs(txs))
+}
+
+func transactionIDs(txs []*Transaction) []string {
+	ids := make([]string, len(txs))
+	for i, tx := range txs {
+		ids[i] = tx.ID()
+	}
+	return ids
+}
+
+// blockFromHeader 由区块头构造区块体已裁剪的区块
+func blockFromHeader(h BlockHeader) *Block {
+	return &Block{
+		index:        h.Index,
+		timestamp:    h.Timestamp,
+		merkleRoot:   h.MerkleRoot,
+		proof:        h.Proof,
+		previousHash: h.PreviousHash,
+		round:        h.Round,
+		vote:         h.Vote,
+		seal:         h.Seal,
+		commit:       h.Commit,
+		baseFee:      h.BaseFee,
+		gasUsed:      h.GasUsed,
+		hash:         h.Hash,
+		pruned:       true,
+	}
+}
+
+// Header 返回区块头
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{
+		Index:        b.index,
+		Timestamp:    b.timestamp,
+		MerkleRoot:   b.merkleRoot,
+		Proof:        b.proof,
+		PreviousHash: b.previousHash,
+		Round:        b.round,
+		Vote:         b.vote,
+		Seal:         b.seal,
+		Commit:       b.commit,
+		BaseFee:      b.baseFee,
+		GasUsed:      b.gasUsed,
+		Hash:         b.hash,
 	}
-	hash := sha256.Sum256(bytes)
-	return hex.EncodeToString(hash[:])
 }
 
 // 公共方法：获取区块哈希（使用缓存）
@@ -403,6 +736,14 @@ func (b *Block) Timestamp() int64             { return b.timestamp }
 func (b *Block) Transactions() []*Transaction { return b.transactions }
 func (b *Block) Proof() int                   { return b.proof }
 func (b *Block) PreviousHash() string         { return b.previousHash }
+func (b *Block) MerkleRoot() string           { return b.merkleRoot }
+func (b *Block) IsPruned() bool               { return b.pruned }
+func (b *Block) Seal() []byte                 { return b.seal }
+func (b *Block) Vote() *SignerVote            { return b.vote }
+func (b *Block) Round() int                   { return b.round }
+func (b *Block) Commit() *CommitCertificate   { return b.commit }
+func (b *Block) BaseFee() Amount              { return b.baseFee }
+func (b *Block) GasUsed() uint64              { return b.gasUsed }
 
 // FormatTime 将时间戳转换为标准格式
 func (b *Block) FormatTime() string {
@@ -413,128 +754,728 @@ func (b *Block) FormatTime() string {
 // 区块链核心逻辑封装
 // ------------------------------
 
-// Blockchain 区块链管理器，封装链操作
+// Blockchain 区块链管理器，封装链操作，可并发使用：
+// 读操作持读锁看到一致的链状态，写操作（提交交易、接入区块）持写锁
 type Blockchain struct {
-	chain               []*Block
-	currentTransactions []*Transaction
-	difficulty          int // POW难度（前导零数量）
+	mu           sync.RWMutex
+	chain        []*Block
+	index        *chainIndex    // 区块与交易索引
+	events       *eventBus      // 事件订阅者
+	mempool      *Mempool       // 待打包交易池（含序号超前的等待队列）
+	difficulty   int            // POW难度（前导零数量）
+	minerAddress Address        // 接收挖矿奖励的地址，为空则不发放奖励
+	chainID      string         // 链ID，交易签名必须包含相同的链ID
+	base         *StateSnapshot // 状态基准快照，账户状态 = 快照 + 其后的区块；为nil表示从创世区块计算
+	stakes       stakeTable     // 链尾的质押状态
+	contracts    contractState  // 链尾的合约状态
+	prunedHeight int            // 已裁剪区块体的最高高度，-1表示未裁剪
+	pruneDepth   int            // 保留区块体的最近区块数，0表示不裁剪
+	limits       BlockLimits    // 区块大小上限（共识规则）
+	genesis      *Genesis       // 创世配置
+	clock        Clock          // 时间来源，出块时间戳与交易时间锁判断都以它为准
+	engine       ConsensusEngine
+	signer       KeyPair // 本节点出块签名密钥，为空则不能以需要签名的共识出块
+	finalized    int     // 已最终确定的最高区块高度，该高度及以下的区块永不回滚
 }
 
-// NewBlockchain 创建新区块链
-func NewBlockchain(difficulty int) *Blockchain {
-	bc := &Blockchain{
-		chain:               make([]*Block, 0),
-		currentTransactions: make([]*Transaction, 0),
-		difficulty:          difficulty,
+// MiningReward 默认的每个区块挖矿奖励（另加区块内交易的小费），可在创世配置中修改
+const MiningReward = 50 * Coin
+
+// DefaultChainID 开发链的链ID
+const DefaultChainID = "upchain-dev"
+
+// NewBlockchain 按创世配置创建区块链，配置相同的节点创世区块相同
+func NewBlockchain(genesis *Genesis) (*Blockchain, error) {
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+	bc, err := newBlockchain(genesis)
+	if err != nil {
+		return nil, err
+	}
+	block := genesis.Block()
+	bc.chain = append(bc.chain, block)
+	bc.index.connect(block, bc.base)
+	bc.connectStakes(block)
+	bc.connectContracts(block)
+	return bc, nil
+}
+
+// NewDevBlockchain 按开发链创世配置创建区块链，用于演示与测试
+func NewDevBlockchain(difficulty int) *Blockchain {
+	bc, err := NewBlockchain(DevGenesis(difficulty))
+	if err != nil {
+		panic(err)
 	}
-	bc.createGenesisBlock() // 初始化创世区块
 	return bc
 }
 
-// 创建创世区块（私有方法）
-func (bc *Blockchain) createGenesisBlock() {
-	// 创世区块没有前置哈希，交易为空
-	genesis := NewBlock(0, 1, "0", []*Transaction{})
-	bc.chain = append(bc.chain, genesis)
+// newBlockchain 按创世配置初始化空链（不含创世区块）
+func newBlockchain(genesis *Genesis) (*Blockchain, error) {
+	engine, err := newConsensusEngine(genesis)
+	if err != nil {
+		return nil, err
+	}
+	// 工作量证明区块默认须由出块者签名，未调用SetSigner时使用临时生成的密钥
+	var signer KeyPair
+	if _, ok := engine.(*ProofOfWork); ok {
+		if signer, err = NewEd25519KeyPair(); err != nil {
+			return nil, err
+		}
+	}
+	bc := &Blockchain{
+		chain:        make([]*Block, 0),
+		index:        newChainIndex(),
+		events:       newEventBus(),
+		stakes:       make(stakeTable),
+		contracts:    make(contractState),
+		difficulty:   genesis.Difficulty,
+		chainID:      genesis.ChainID,
+		prunedHeight: -1,
+		limits:       genesis.Params.blockLimits(),
+		genesis:      genesis,
+		clock:        SystemClock,
+		engine:       engine,
+		signer:       signer,
+	}
+	bc.mempool = NewMempool(DefaultMempoolConfig, bc.checkTransaction)
+	return bc, nil
+}
+
+// SetMinerAddress 设置接收挖矿奖励的地址
+func (bc *Blockchain) SetMinerAddress(addr Address) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.minerAddress = addr
+}
+
+// Genesis 返回创世配置（创建后不变，无需加锁）
+func (bc *Blockchain) Genesis() *Genesis {
+	return bc.genesis
+}
+
+// ChainID 返回链ID（创建后不变，无需加锁）
+func (bc *Blockchain) ChainID() string {
+	return bc.chainID
 }
 
-// AddTransaction 添加交易到待打包列表
-func (bc *Blockchain) AddTransaction(tx *Transaction) {
-	bc.currentTransactions = append(bc.currentTransactions, tx)
+// AddTransaction 将交易提交到交易池；序号超前的交易进入等待队列，
+// 前序交易到齐后自动转入待打包列表
+func (bc *Blockchain) AddTransaction(tx *Transaction) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err := bc.addToMempool(tx); err != nil {
+		return err
+	}
+	bc.promoteQueued()
+	return nil
+}
+
+// addToMempool 交易入池，直接进入待打包列表时发布EventPendingTx；进入等待队列的交易在被提升时发布
+func (bc *Blockchain) addToMempool(tx *Transaction) error {
+	if err := bc.mempool.Add(tx); err != nil {
+		return err
+	}
+	if pending := bc.findPending(tx.Sender(), tx.Nonce()); pending != nil && pending.ID() == tx.ID() {
+		bc.events.publish(EventPendingTx, nil, []*Transaction{tx})
+	}
+	return nil
+}
+
+// Mempool 返回交易池（交易池自带锁，可直接查询）
+func (bc *Blockchain) Mempool() *Mempool {
+	return bc.mempool
+}
+
+// checkTransaction 交易入池校验：格式、链ID、脚本、序号与余额
+func (bc *Blockchain) checkTransaction(tx *Transaction) (queued bool, err error) {
+	if tx.IsCoinbase() {
+		return false, errors.New("挖矿奖励交易不能手动提交")
+	}
+	if err := tx.checkKind(); err != nil {
+		return false, err
+	}
+	if _, err := tx.Cost(); err != nil {
+		return false, err
+	}
+	if !tx.validTimeLocks() {
+		return false, fmt.Errorf("时间锁不能为负数，相对时间锁不能超过%d个区块", MaxRelativeLock)
+	}
+	if tx.ChainID() != bc.chainID {
+		return false, fmt.Errorf("交易链ID %q 与本链 %q 不匹配", tx.ChainID(), bc.chainID)
+	}
+	nextHeight := bc.lastBlock().Index() + 1
+	ctx := ScriptContext{BlockHeight: nextHeight, BlockTime: bc.clock.Now().UnixNano()}
+	if err := tx.VerifyAt(ctx); err != nil {
+		return false, fmt.Errorf("交易脚本验证失败: %w", err)
+	}
+
+	if err := bc.checkMaxFee(tx); err != nil {
+		return false, err
+	}
+	if queued, err = bc.checkNonce(tx); err != nil || queued {
+		return queued, err
+	}
+	if err := bc.checkStakingTx(tx, bc.tipStakes().clone()); err != nil {
+		return false, err
+	}
+	return false, bc.checkPendingBalance(tx)
+}
+
+// checkPendingBalance 可花费余额（不含未到期的相对时间锁资金）需覆盖待打包列表中已有的支出
+func (bc *Blockchain) checkPendingBalance(tx *Transaction) error {
+	available, err := bc.spendableBalanceAt(tx.Sender(), bc.lastBlock().Index()+1)
+	if err != nil {
+		return err
+	}
+	needed, err := tx.Cost()
+	if err != nil {
+		return err
+	}
+	for _, pending := range bc.mempool.Pending() {
+		if pending.Sender() != tx.Sender() {
+			continue
+		}
+		cost, err := pending.Cost()
+		if err != nil {
+			return err
+		}
+		if needed, err = needed.Add(cost); err != nil {
+			return err
+		}
+	}
+	if available < needed {
+		return fmt.Errorf("余额不足: 可用 %s，需要 %s（含待打包交易）", available, needed)
+	}
+	return nil
+}
+
+// Balance 扫描已确认区块计算地址余额（含未到期的相对时间锁资金）
+func (bc *Blockchain) Balance(addr Address) Amount {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return mustBalance(bc.spendableBalanceAt(addr, math.MaxInt))
+}
+
+// mustBalance 已确认区块均经过余额校验，计算出错说明链数据已损坏
+func mustBalance(balance Amount, err error) Amount {
+	if err != nil {
+		panic(fmt.Sprintf("链上余额不一致: %v", err))
+	}
+	return balance
+}
+
+// Blocks 返回链上全部区块（副本，修改不影响链），已裁剪的区块只含区块头
+func (bc *Blockchain) Blocks() []*Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return append([]*Block(nil), bc.chain...)
+}
+
+// PendingTransactions 返回交易池中可直接打包的交易
+func (bc *Blockchain) PendingTransactions() []*Transaction {
+	return bc.mempool.Pending()
 }
 
 // LastBlock 获取最后一个区块
 func (bc *Blockchain) LastBlock() *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.lastBlock()
+}
+
+func (bc *Blockchain) lastBlock() *Block {
 	return bc.chain[len(bc.chain)-1]
 }
 
-// MineBlock 执行POW并创建新区块（核心方法）
+// MineBlock 出块的简便形式：工作量证明链总能出块；共识引擎拒绝出块时返回nil，
+// 需要错误原因（如权益证明不是本轮出块者）时使用ProduceBlock
 func (bc *Blockchain) MineBlock() *Block {
-	lastBlock := bc.LastBlock()
-	proof := bc.proofOfWork(lastBlock.Proof())
+	block, err := bc.ProduceBlock()
+	if err != nil {
+		return nil
+	}
+	return block
+}
+
+// ProduceBlock 按共识引擎出块：组装区块模板，由引擎填写并封装区块头后接入链尾。
+// 封装（如搜索工作量证明）时不持锁；期间链尾若被其他矿工或AddBlock更新，则基于新链尾重新出块
+func (bc *Blockchain) ProduceBlock() (*Block, error) {
+	for {
+		bc.mu.RLock()
+		lastBlock, transactions, timestamp := bc.blockTemplate()
+		header := BlockHeader{
+			Index:        lastBlock.Index() + 1,
+			Timestamp:    timestamp,
+			MerkleRoot:   transactionsMerkleRoot(transactions),
+			PreviousHash: lastBlock.Hash(),
+			BaseFee:      bc.genesis.Params.nextBaseFee(lastBlock.Header()),
+			GasUsed:      totalGas(transactions),
+		}
+		signer := bc.signer
+		err := bc.engine.Prepare(chainView{bc}, &header, signer)
+		bc.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := bc.engine.Seal(lastBlock.Header(), &header, signer); err != nil {
+			return nil, err
+		}
+		newBlock := newBlockFromHeader(header, transactions)
+
+		bc.mu.Lock()
+		if bc.lastBlock() == lastBlock {
+			bc.connectBlock(newBlock)
+			bc.mu.Unlock()
+			return newBlock, nil
+		}
+		bc.mu.Unlock()
+	}
+}
+
+// blockTemplate 基于当前链尾组装待挖区块的交易，调用方需持有读锁
+func (bc *Blockchain) blockTemplate() (lastBlock *Block, transactions []*Transaction, timestamp int64) {
+	lastBlock = bc.lastBlock()
+
+	// 从交易池按小费取区块模板：只打包已到期且序号连续的交易，其余留在池中。
+	// 先为区块头和奖励交易预留空间
+	index, timestamp := lastBlock.Index()+1, bc.nextBlockTime()
+	maxCount, maxBytes := bc.limits.MaxTransactions, bc.limits.MaxBytes-maxHeaderSize
+	if !bc.minerAddress.IsZero() {
+		placeholder := NewCoinbaseTransaction(bc.minerAddress, MaxAmount, index)
+		placeholder.chainID = bc.chainID
+		maxCount--
+		maxBytes -= placeholder.Size()
+	}
+	expected := make(map[Address]uint64)
+	stakes := bc.tipStakes()
+	reward := bc.genesis.Params.BlockReward
+	baseFee, gasLeft := bc.genesis.Params.nextBaseFee(lastBlock.Header()), bc.limits.maxGas()
+	transactions = bc.mempool.BlockTemplate(maxCount, maxBytes, baseFee, func(tx *Transaction) bool {
+		if _, ok := expected[tx.Sender()]; !ok {
+			expected[tx.Sender()] = bc.confirmedNonce(tx.Sender())
+		}
+		if !tx.IsFinal(index, timestamp) || tx.Nonce() != expected[tx.Sender()] || tx.Gas() > gasLeft {
+			return false
+		}
+		// 最高手续费不足以支付基础费用的交易留在池中，等基础费用回落
+		_, tip, err := tx.feesAt(baseFee)
+		if err != nil {
+			return false
+		}
+		// 在副本上检查，交易放不进区块时不影响已选交易的质押状态
+		trial := stakes.clone()
+		if bc.checkStakingTx(tx, trial) != nil {
+			return false
+		}
+		withTip, err := reward.Add(tip)
+		if err != nil {
+			return false
+		}
+		reward = withTip
+		stakes = trial
+		gasLeft -= tx.Gas()
+		expected[tx.Sender()]++
+		return true
+	})
+
+	// 设置了矿工地址时，奖励交易（奖励 + 小费）排在区块首位
+	if !bc.minerAddress.IsZero() {
+		coinbase := NewCoinbaseTransaction(bc.minerAddress, reward, index)
+		coinbase.chainID = bc.chainID
+		transactions = append([]*Transaction{coinbase}, transactions...)
+	}
+	return lastBlock, transactions, timestamp
+}
+
+// AddBlock 校验外部产生的区块后接到链尾，并从待打包列表移除其中的交易
+func (bc *Blockchain) AddBlock(block *Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err := bc.validateBlock(block); err != nil {
+		return err
+	}
+	bc.connectBlock(block)
+	return nil
+}
+
+// connectBlock 将已校验的区块接到链尾，更新索引并从交易池移除已打包交易，调用方需持有写锁
+func (bc *Blockchain) connectBlock(block *Block) {
+	block.weight = bc.engine.Weight(chainView{bc}, block.Header())
+	if _, ok := bc.engine.(FinalityEngine); ok {
+		bc.finalized = block.Index()
+	}
+	bc.chain = append(bc.chain, block)
+	bc.index.connect(block, bc.base)
+	bc.connectStakes(block)
+	bc.connectContracts(block)
+	bc.removeIncluded(block)
+	bc.events.publish(EventBlockConnected, block, block.Transactions())
+	bc.prune()
+}
+
+// DisconnectTip 回滚链尾区块（创世区块除外），其中的普通交易重新提交到交易池
+func (bc *Blockchain) DisconnectTip() (*Block, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if len(bc.chain) == 1 {
+		return nil, errors.New("不能回滚创世区块")
+	}
+	if bc.lastBlock().Index() <= bc.baseHeight() {
+		return nil, fmt.Errorf("%w: 不能回滚状态快照高度%d及以下的区块", ErrPruned, bc.baseHeight())
+	}
+	if bc.lastBlock().Index() <= bc.finalized {
+		return nil, fmt.Errorf("%w: 不能回滚高度%d及以下的区块", ErrFinalized, bc.finalized)
+	}
+	return bc.disconnectTip(), nil
+}
+
+// disconnectTip 移除链尾区块并更新索引，调用方需持有写锁且链上不止创世区块
+func (bc *Blockchain) disconnectTip() *Block {
+	block := bc.lastBlock()
+	bc.chain = bc.chain[:len(bc.chain)-1]
+	bc.index.disconnect(block)
+	bc.resetStakes()
+	bc.resetContracts()
+	bc.events.publish(EventBlockDisconnected, block, block.Transactions())
+	for _, tx := range block.Transactions() {
+		if !tx.IsCoinbase() {
+			// 回滚后已无效的交易（如余额不足）直接丢弃
+			_ = bc.addToMempool(tx)
+		}
+	}
+	bc.promoteQueued()
+	return block
+}
+
+// Reorganize 切换到更重的分叉：fork为接在主链某个区块之后的连续区块。
+// 先回滚到分叉点，再依次校验并接入分叉区块；任一区块无效，
+// 或分叉的总权重（由共识引擎计算）不高于被回滚的区块时恢复原主链
+func (bc *Blockchain) Reorganize(fork []*Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if len(fork) == 0 {
+		return errors.New("分叉不能为空")
+	}
+	ancestor, ok := bc.index.blocks[fork[0].PreviousHash()]
+	if !ok {
+		return errors.New("分叉点不在主链上")
+	}
+	if ancestor.Index() < bc.baseHeight() {
+		return fmt.Errorf("%w: 分叉点低于状态快照高度%d", ErrPruned, bc.baseHeight())
+	}
+	if ancestor.Index() < bc.finalized {
+		return fmt.Errorf("%w: 分叉点低于最终确定高度%d", ErrFinalized, bc.finalized)
+	}
 
-	// 创建新区块，打包当前交易
-	newBlock := NewBlock(
-		lastBlock.Index()+1,
-		proof,
-		lastBlock.Hash(),
-		bc.currentTransactions,
-	)
+	// 切换完成前暂停裁剪，保证失败时能回滚到分叉点；事件暂存，切换成功后才投递
+	bc.events.hold()
+	committed := false
+	defer func() {
+		bc.events.release(committed)
+	}()
+	depth := bc.pruneDepth
+	bc.pruneDepth = 0
+	defer func() {
+		bc.pruneDepth = depth
+		bc.prune()
+	}()
+
+	var detached []*Block
+	detachedWeight := new(big.Int)
+	for bc.lastBlock() != ancestor {
+		block := bc.disconnectTip()
+		detached = append(detached, block)
+		detachedWeight.Add(detachedWeight, block.weight)
+	}
+	restore := func() {
+		for bc.lastBlock() != ancestor {
+			bc.disconnectTip()
+		}
+		for j := len(detached) - 1; j >= 0; j-- {
+			bc.connectBlock(detached[j])
+		}
+	}
+	forkWeight := new(big.Int)
+	for i, block := range fork {
+		if err := bc.validateBlock(block); err != nil {
+			restore()
+			return fmt.Errorf("分叉第%d个区块无效: %w", i, err)
+		}
+		bc.connectBlock(block)
+		forkWeight.Add(forkWeight, block.weight)
+	}
+	if forkWeight.Cmp(detachedWeight) <= 0 {
+		restore()
+		return fmt.Errorf("分叉权重%s不高于主链被替换部分的权重%s，不切换", forkWeight, detachedWeight)
+	}
+	committed = true
+	return nil
+}
+
+// removeIncluded 从交易池移除区块中的交易及序号已被占用的交易，再提升等待队列
+func (bc *Blockchain) removeIncluded(block *Block) {
+	var ids []string
+	for _, tx := range block.Transactions() {
+		ids = append(ids, tx.ID())
+	}
+	for _, tx := range bc.mempool.Pending() {
+		if tx.Nonce() < bc.confirmedNonce(tx.Sender()) {
+			ids = append(ids, tx.ID())
+		}
+	}
+	bc.mempool.Remove(ids)
+	bc.promoteQueued()
+}
+
+// maxCoinbaseAmount 区块奖励交易的金额上限：挖矿奖励 + 区块内普通交易的小费（基础费用被销毁）
+func maxCoinbaseAmount(reward, baseFee Amount, txs []*Transaction) (Amount, error) {
+	total := reward
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		_, tip, err := tx.feesAt(baseFee)
+		if err != nil {
+			return 0, err
+		}
+		if total, err = total.Add(tip); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
 
-	// 重置当前交易列表，更新链
-	bc.currentTransactions = make([]*Transaction, 0)
-	bc.chain = append(bc.chain, newBlock)
+// ValidateBlock 校验区块能否接在当前链尾：链接关系、共识封装（工作量证明或出块者签名）、
+// 具有最终性的共识还需提交证书，以及按区块的高度和时间戳校验每笔交易的脚本、时间锁与余额
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validateBlock(block)
+}
 
-	return newBlock
+func (bc *Blockchain) validateBlock(block *Block) error {
+	if err := bc.validateCandidate(block); err != nil {
+		return err
+	}
+	if engine, ok := bc.engine.(FinalityEngine); ok {
+		if err := engine.VerifyCommit(chainView{bc}, block.Header()); err != nil {
+			return fmt.Errorf("提交证书无效: %w", err)
+		}
+	}
+	return nil
 }
 
-// POW逻辑（私有方法）
-func (bc *Blockchain) proofOfWork(lastProof int) int {
-	proof := 0
-	for !bc.isValidProof(lastProof, proof) {
-		proof++
+// validateCandidate 除提交证书外的全部区块校验，拜占庭容错共识投票前用它检查提案
+func (bc *Blockchain) validateCandidate(block *Block) error {
+	lastBlock := bc.lastBlock()
+	if block.Index() != lastBlock.Index()+1 {
+		return fmt.Errorf("区块高度应为%d，实际%d", lastBlock.Index()+1, block.Index())
+	}
+	if block.PreviousHash() != lastBlock.Hash() {
+		return errors.New("前一区块哈希不匹配")
+	}
+	if block.MerkleRoot() != transactionsMerkleRoot(block.Transactions()) {
+		return errors.New("Merkle根与区块交易不符")
+	}
+	if block.Hash() != block.calculateHash() {
+		return errors.New("区块哈希与内容不符")
+	}
+	if len(block.seal) > maxSealSize {
+		return fmt.Errorf("区块头封装数据超过%d字节", maxSealSize)
+	}
+	if err := bc.engine.VerifySeal(chainView{bc}, block.Header()); err != nil {
+		return err
+	}
+	if err := bc.checkBlockTime(block); err != nil {
+		return err
+	}
+	if err := bc.limits.check(block); err != nil {
+		return err
+	}
+	if err := bc.checkBlockFees(block); err != nil {
+		return err
+	}
+
+	maxReward, err := maxCoinbaseAmount(bc.genesis.Params.BlockReward, block.BaseFee(), block.Transactions())
+	if err != nil {
+		return fmt.Errorf("小费合计: %w", err)
 	}
-	return proof
+	ctx := ScriptContext{BlockHeight: block.Index(), BlockTime: block.Timestamp()}
+	spent := make(map[Address]Amount)
+	nonces := make(map[Address]uint64)
+	stakes := bc.tipStakes().clone()
+	for i, tx := range block.Transactions() {
+		if tx.ChainID() != bc.chainID {
+			return fmt.Errorf("第%d笔交易: 链ID不匹配", i)
+		}
+		if tx.IsCoinbase() {
+			if i != 0 || tx.Amount() > maxReward || tx.Nonce() != uint64(block.Index()) ||
+				tx.Kind() != TxTransfer || tx.Evidence() != nil || len(tx.Data()) > 0 || tx.GasLimit() != 0 {
+				return fmt.Errorf("第%d笔交易: 挖矿奖励交易无效", i)
+			}
+			continue
+		}
+		if _, ok := nonces[tx.Sender()]; !ok {
+			nonces[tx.Sender()] = bc.confirmedNonce(tx.Sender())
+		}
+		if tx.Nonce() != nonces[tx.Sender()] {
+			return fmt.Errorf("第%d笔交易: 序号应为%d，实际%d", i, nonces[tx.Sender()], tx.Nonce())
+		}
+		nonces[tx.Sender()]++
+		if err := tx.checkKind(); err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+		if !tx.validTimeLocks() {
+			return fmt.Errorf("第%d笔交易: 时间锁无效", i)
+		}
+		if !tx.IsFinal(block.Index(), block.Timestamp()) {
+			return fmt.Errorf("第%d笔交易: 时间锁未到期", i)
+		}
+		if err := bc.checkStakingTx(tx, stakes); err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+		if err := tx.VerifyAt(ctx); err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+		cost, err := tx.CostAt(block.BaseFee())
+		if err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+		if spent[tx.Sender()], err = spent[tx.Sender()].Add(cost); err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+		available, err := bc.spendableBalanceAt(tx.Sender(), block.Index())
+		if err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+		if available < spent[tx.Sender()] {
+			return fmt.Errorf("第%d笔交易: 余额不足", i)
+		}
+	}
+	return nil
 }
 
-// 验证POW（私有方法）
-func (bc *Blockchain) isValidProof(lastProof, proof int) bool {
-	guess := fmt.Sprintf("%d%d", lastProof, proof)
-	hash := sha256.Sum256([]byte(guess))
-	hashStr := hex.EncodeToString(hash[:])
-	return len(hashStr) >= bc.difficulty && hashStr[:bc.difficulty] == bc.targetPrefix()
+// isValidProof 只依赖前一区块的proof、出块者、难度与哈希算法，轻节点凭区块头即可验证；
+// 哈希覆盖出块者地址，换成其他出块者签名后proof随之失效
+func isValidProof(lastProof, proof int, producer Address, difficulty int, algorithm HashAlgorithm) bool {
+	guess := fmt.Sprintf("%d%d%s", lastProof, proof, producer)
+	hashStr := hex.EncodeToString(algorithm.sum([]byte(guess)))
+	return len(hashStr) >= difficulty && hashStr[:difficulty] == targetPrefix(difficulty)
 }
 
 // 生成目标前缀（如"0000"）
-func (bc *Blockchain) targetPrefix() string {
-	return fmt.Sprintf("%0"+fmt.Sprint(bc.difficulty)+"s", "")
+func targetPrefix(difficulty int) string {
+	return fmt.Sprintf("%0"+fmt.Sprint(difficulty)+"s", "")
+}
+
+// Difficulty 返回POW难度
+func (bc *Blockchain) Difficulty() int {
+	return bc.difficulty
 }
 
 // Print 打印区块链信息（对外暴露的展示方法）
 func (bc *Blockchain) Print() {
-	for i, block := range bc.chain {
+	for i, block := range bc.Blocks() {
 		fmt.Printf("区块 #%d:\n", i+1)
 		fmt.Printf("  索引: %d\n", block.Index())
 		// fmt.Printf("  时间戳: %s\n", block.FormatTime())
 		fmt.Printf("  时间戳（标准时间）: %s\n", block.FormatTime()) // 显示：标准时间
 		fmt.Printf("  时间戳（原始纳秒）: %d\n", block.Timestamp())  // 可选：显示原始时间戳
-		fmt.Printf("  交易数: %d\n", len(block.Transactions()))
+		if block.IsPruned() {
+			fmt.Printf("  区块体已裁剪\n")
+		} else {
+			fmt.Printf("  交易数: %d\n", len(block.Transactions()))
+		}
 		for _, tx := range block.Transactions() {
-			fmt.Printf("    交易: %s -> %s, 金额: %.2f\n",
-				tx.Sender(), tx.Recipient(), tx.Amount())
+			if tx.IsCoinbase() {
+				fmt.Printf("    挖矿奖励: -> %s, 金额: %s\n", tx.Recipient(), tx.Amount())
+				continue
+			}
+			fmt.Printf("    交易: %s -> %s, 金额: %s, 最高手续费: %s, 小费: %s\n",
+				tx.Sender(), tx.Recipient(), tx.Amount(), tx.Fee(), tx.Tip())
 		}
 		fmt.Printf("  Proof: %d\n", block.Proof())
+		if block.BaseFee() > 0 {
+			fmt.Printf("  基础费用: %d/gas，已用gas: %d\n", block.BaseFee(), block.GasUsed())
+		}
+		if producer, ok := block.Producer(); ok {
+			fmt.Printf("  出块者: %s\n", producer)
+		}
 		fmt.Printf("  前一区块哈希: %s\n", block.PreviousHash())
 		fmt.Printf("  当前区块哈希: %s\n\n", block.Hash())
 	}
 }
 
 // ------------------------------
-// 主函数：演示使用
+// 演示使用
 // ------------------------------
 
-func main() {
-	// 初始化区块链（难度为4个0）
-	bc := NewBlockchain(4)
-	fmt.Println("已创建区块链（包含创世区块）")
+// runChainDemo 演示通过钱包构造、签名并提交交易，再挖矿打包
+func runChainDemo() {
+	// 钱包为每个参与者生成一把密钥，交易双方以地址标识
+	wallet := NewWallet(filepath.Join(os.TempDir(), "demo_wallet.json"))
+	names := []string{"Alice", "Bob", "Charlie", "Dave"}
+	addrs := make(map[string]Address, len(names))
+	for _, name := range names {
+		addr, err := wallet.NewKey(name)
+		if err != nil {
+			fmt.Printf("密钥生成失败: %v\n", err)
+			return
+		}
+		addrs[name] = addr
+		fmt.Printf("%s 的地址: %s\n", name, addr)
+	}
 
-	// 添加交易
-	bc.AddTransaction(NewTransaction("Alice", "Bob", 5.0))
-	bc.AddTransaction(NewTransaction("Bob", "Charlie", 2.5))
+	// 初始化区块链（难度为4个0），由Alice挖矿获得初始资金
+	bc := NewDevBlockchain(4)
+	bc.SetMinerAddress(addrs["Alice"])
+	// Alice用自己的密钥签名区块头，区块可追溯到出块者
+	bc.SetSigner(wallet.key(addrs["Alice"]).keys)
+	fmt.Println("已创建区块链（包含创世区块）")
 
-	// 挖矿
-	fmt.Println("正在挖掘第一个区块...")
+	fmt.Println("正在挖掘第一个区块（Alice获得挖矿奖励）...")
 	bc.MineBlock()
 
-	// 添加更多交易
-	bc.AddTransaction(NewTransaction("Charlie", "Alice", 1.0))
-	bc.AddTransaction(NewTransaction("Bob", "Dave", 0.5))
+	// 通过钱包转账
+	send := func(from, to, value string) {
+		amount, err := ParseCoins(value)
+		if err != nil {
+			fmt.Printf("金额 %s 无效: %v\n", value, err)
+			return
+		}
+		if _, err := wallet.Send(bc, addrs[from], addrs[to], amount); err != nil {
+			fmt.Printf("%s -> %s 转账失败: %v\n", from, to, err)
+		}
+	}
+	send("Alice", "Bob", "5")
+	send("Alice", "Charlie", "2.5")
 
-	// 再次挖矿
 	fmt.Println("正在挖掘第二个区块...")
 	bc.MineBlock()
 
+	send("Charlie", "Alice", "1")
+	send("Bob", "Dave", "0.5")
+
+	fmt.Println("正在挖掘第三个区块...")
+	bc.MineBlock()
+
 	// 打印区块链
 	fmt.Println("\n区块链完整信息:")
 	bc.Print()
+
+	// 钱包余额与持久化
+	for _, name := range names {
+		fmt.Printf("%s 余额: %s\n", name, wallet.Balance(bc, addrs[name]))
+	}
+	fmt.Printf("钱包相关交易 %d 笔，总余额 %s\n", len(wallet.History(bc)), wallet.TotalBalance(bc))
+	for _, stats := range bc.ProducerStats() {
+		fmt.Printf("出块者 %s: %d 个区块，奖励 %s\n", stats.Producer, stats.Blocks, stats.Rewards)
+	}
+	if err := wallet.Save(); err != nil {
+		fmt.Printf("钱包保存失败: %v\n", err)
+	} else {
+		fmt.Printf("钱包已保存至 %s\n", wallet.path)
+	}
 }
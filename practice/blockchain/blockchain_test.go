@@ -0,0 +1,2676 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestBlockchainConcurrentAccess 多个发送方、矿工和读者并发操作同一条链，
+// 需配合 go test -race 运行
+func TestBlockchainConcurrentAccess(t *testing.T) {
+	const senders, txsPerSender, miners, blocksPerMiner = 4, 10, 2, 5
+
+	bc := NewDevBlockchain(1)
+	recipient, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个发送方使用自己的钱包，先各挖一个区块获得余额
+	wallets := make([]*Wallet, senders)
+	addrs := make([]Address, senders)
+	for i := range wallets {
+		wallets[i] = NewWallet("")
+		if addrs[i], err = wallets[i].NewKey("sender"); err != nil {
+			t.Fatal(err)
+		}
+		bc.SetMinerAddress(addrs[i])
+		bc.MineBlock()
+	}
+	bc.SetMinerAddress(Address{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, senders*txsPerSender)
+	for i := range wallets {
+		wg.Add(1)
+		go func(w *Wallet, from Address) {
+			defer wg.Done()
+			for j := 0; j < txsPerSender; j++ {
+				if _, err := w.Send(bc, from, recipient.Address(), Coin); err != nil {
+					errs <- err
+				}
+			}
+		}(wallets[i], addrs[i])
+	}
+	for i := 0; i < miners; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < blocksPerMiner; j++ {
+				bc.MineBlock()
+			}
+		}()
+	}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if blocks := bc.Blocks(); blocks[len(blocks)-1].Index() != len(blocks)-1 {
+					t.Errorf("区块快照不一致: 共%d个区块，链尾高度%d", len(blocks), blocks[len(blocks)-1].Index())
+				}
+				bc.LastBlock()
+				bc.Balance(recipient.Address())
+				bc.PendingTransactions()
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("提交交易失败: %v", err)
+	}
+
+	for bc.Mempool().Count() > 0 {
+		bc.MineBlock()
+	}
+	blocks := bc.Blocks()
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].Index() != i || blocks[i].PreviousHash() != blocks[i-1].Hash() {
+			t.Fatalf("区块%d未正确链接到前一区块", i)
+		}
+	}
+	if got, want := bc.Balance(recipient.Address()), senders*txsPerSender*Coin; got != want {
+		t.Fatalf("收款方余额 %s，期望 %s", got, want)
+	}
+}
+
+// TestBlockTimestampRules 用可推进的时钟检查区块时间戳规则
+func TestBlockTimestampRules(t *testing.T) {
+	clock := NewFakeClock(devGenesisTime.Add(time.Hour))
+	bc := NewDevBlockchain(1)
+	bc.SetClock(clock)
+
+	// 出块时间戳取自时钟
+	for i := 0; i < MedianTimeBlocks; i++ {
+		clock.Advance(time.Minute)
+		if block := bc.MineBlock(); block.Timestamp() != clock.Now().UnixNano() {
+			t.Fatalf("区块%d时间戳为%d，应为%d", block.Index(), block.Timestamp(), clock.Now().UnixNano())
+		}
+	}
+
+	// 时钟回拨时，出块时间戳仍大于过去中位时间
+	clock.Advance(-time.Hour)
+	mtp := bc.MedianTimePast()
+	if block := bc.MineBlock(); block.Timestamp() != mtp+1 {
+		t.Fatalf("时钟回拨后区块时间戳为%d，应为过去中位时间+1即%d", block.Timestamp(), mtp+1)
+	}
+	clock.Advance(time.Hour)
+
+	blockAt := func(timestamp int64) *Block {
+		tip := bc.LastBlock()
+		header := newBlockAt(tip.Index()+1, timestamp, 0, tip.Hash(), nil).Header()
+		header.BaseFee = bc.NextBaseFee()
+		if err := bc.Engine().Seal(tip.Header(), &header, bc.signer); err != nil {
+			t.Fatal(err)
+		}
+		return newBlockFromHeader(header, nil)
+	}
+	tests := []struct {
+		name      string
+		timestamp int64
+		wantErr   string
+	}{
+		{"等于过去中位时间", bc.MedianTimePast(), "过去中位时间"},
+		{"超出未来时间上限", clock.Now().Add(MaxFutureBlockTime).UnixNano() + 1, "超出本地时间"},
+		{"恰好在未来时间上限", clock.Now().Add(MaxFutureBlockTime).UnixNano(), ""},
+	}
+	for _, tt := range tests {
+		err := bc.AddBlock(blockAt(tt.timestamp))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: 错误为%v，应包含%q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// TestBFTToleratesFaultyValidators 3f+1个验证者中f个离线（恰好是前几轮的提出者），
+// 其余验证者经超时换轮后仍能提交一致的区块，提交的区块带有效证书且不能回滚
+func TestBFTToleratesFaultyValidators(t *testing.T) {
+	for _, faulty := range []int{1, 2} {
+		faulty := faulty
+		t.Run(fmt.Sprintf("f=%d", faulty), func(t *testing.T) {
+			const targetHeight = 3
+			n := 3*faulty + 1
+			keys := make([]KeyPair, n)
+			genesis := &Genesis{
+				ChainID:       "upchain-bft-test",
+				Timestamp:     devGenesisTime,
+				Consensus:     ConsensusBFT,
+				HashAlgorithm: HashSHA256,
+				BFT:           &BFTConfig{},
+				Params:        DefaultConsensusParams,
+			}
+			for i := range keys {
+				key, err := NewEd25519KeyPair()
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys[i] = key
+				genesis.BFT.Validators = append(genesis.BFT.Validators, key.Address())
+			}
+			// 高度1前f轮的提出者离线
+			offline := make(map[Address]bool)
+			for round := 0; round < faulty; round++ {
+				offline[genesis.BFT.proposer(1, round)] = true
+			}
+
+			network := NewLocalBFTNetwork()
+			timeouts := BFTTimeouts{
+				Propose:   100 * time.Millisecond,
+				Prevote:   50 * time.Millisecond,
+				Precommit: 50 * time.Millisecond,
+				Delta:     20 * time.Millisecond,
+				Commit:    10 * time.Millisecond,
+			}
+			var chains []*Blockchain
+			var nodes []*BFTNode
+			for _, key := range keys {
+				if offline[key.Address()] {
+					continue
+				}
+				bc, err := NewBlockchain(genesis)
+				if err != nil {
+					t.Fatal(err)
+				}
+				bc.SetMinerAddress(key.Address())
+				node, err := NewBFTNode(bc, key, network.Join(), timeouts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				chains = append(chains, bc)
+				nodes = append(nodes, node)
+			}
+			for _, node := range nodes {
+				node.Start()
+			}
+			deadline := time.Now().Add(20 * time.Second)
+			for time.Now().Before(deadline) {
+				done := true
+				for _, bc := range chains {
+					done = done && bc.LastBlock().Index() >= targetHeight
+				}
+				if done {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			for _, node := range nodes {
+				node.Stop()
+			}
+			network.Close()
+
+			reference := chains[0].Blocks()
+			for i, bc := range chains {
+				blocks := bc.Blocks()
+				if len(blocks) <= targetHeight {
+					t.Fatalf("节点%d只到达高度%d", i, len(blocks)-1)
+				}
+				for height := 1; height <= targetHeight; height++ {
+					block := blocks[height]
+					if block.Hash() != reference[height].Hash() {
+						t.Fatalf("节点%d在高度%d的区块与节点0不一致", i, height)
+					}
+					commit := block.Commit()
+					if commit == nil || len(commit.Precommits) < genesis.BFT.quorum() {
+						t.Fatalf("高度%d的区块缺少法定数量的预提交签名", height)
+					}
+					for _, signer := range commit.Signers() {
+						if offline[signer] {
+							t.Fatalf("高度%d的提交证书包含离线验证者的签名", height)
+						}
+					}
+				}
+				if bc.FinalizedHeight() != bc.LastBlock().Index() {
+					t.Fatalf("节点%d最终确定高度%d，链高度%d", i, bc.FinalizedHeight(), bc.LastBlock().Index())
+				}
+			}
+			if round := reference[1].Round(); round != faulty {
+				t.Fatalf("高度1应在第%d轮由在线提出者提出，实际第%d轮", faulty, round)
+			}
+
+			// 已提交的区块不能回滚，没有证书的区块不能接入
+			bc := chains[0]
+			if _, err := bc.DisconnectTip(); !errors.Is(err, ErrFinalized) {
+				t.Fatalf("回滚最终确定的区块应失败，实际: %v", err)
+			}
+			if err := bc.Reorganize(reference[1:2]); !errors.Is(err, ErrFinalized) {
+				t.Fatalf("切换到创世区块之后的分叉应失败，实际: %v", err)
+			}
+			fresh, err := NewBlockchain(genesis)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := reference[1].Header()
+			header.Commit = nil
+			if err := fresh.AddBlock(newBlockFromHeader(header, reference[1].Transactions())); err == nil || !strings.Contains(err.Error(), "提交证书") {
+				t.Fatalf("没有提交证书的区块应被拒绝，实际: %v", err)
+			}
+			synced := newBlockFromHeader(reference[1].Header(), reference[1].Transactions())
+			if err := fresh.AddBlock(synced); err != nil {
+				t.Fatalf("带提交证书的区块应能同步到新节点: %v", err)
+			}
+		})
+	}
+}
+
+// TestBFTBoundsByzantineMessages 单个拜占庭验证者用任意高度与轮次的签名消息刷屏：
+// 节点只缓存有界数量的消息，也不会被它单独拉到更高轮次；诚实验证者的消息仍被记录
+func TestBFTBoundsByzantineMessages(t *testing.T) {
+	keys := make([]KeyPair, 4)
+	genesis := &Genesis{
+		ChainID:       "upchain-bft-test",
+		Timestamp:     devGenesisTime,
+		Consensus:     ConsensusBFT,
+		HashAlgorithm: HashSHA256,
+		BFT:           &BFTConfig{},
+		Params:        DefaultConsensusParams,
+	}
+	for i := range keys {
+		key, err := NewEd25519KeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		genesis.BFT.Validators = append(genesis.BFT.Validators, key.Address())
+	}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := NewLocalBFTNetwork()
+	defer network.Close()
+	node, err := NewBFTNode(bc, keys[0], network.Join(), DefaultBFTTimeouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.stopOnce.Do(func() { close(node.stop) })
+	node.enterHeight(1)
+	node.round, node.step = 0, stepPropose
+
+	send := func(key KeyPair, voteType BFTVoteType, height, round int, blockHash string) {
+		t.Helper()
+		vote, err := signBFTVote(genesis.ChainID, voteType, height, round, blockHash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.handle(BFTMessage{Vote: vote})
+		node.evaluate()
+	}
+	flooder := keys[3]
+	for i := 0; i < 2000; i++ {
+		voteType := []BFTVoteType{BFTPrevote, BFTPrecommit}[i%2]
+		send(flooder, voteType, 1+i%3, i*i, fmt.Sprintf("%064x", i))
+	}
+	send(flooder, BFTPrevote, 1, math.MaxInt, "")
+
+	if node.round != 0 {
+		t.Fatalf("单个拜占庭验证者不应把节点拉到第%d轮", node.round)
+	}
+	if limit := 2 * (bftMaxRoundsAhead + 1); len(node.future) > limit || len(node.votes) > limit {
+		t.Fatalf("缓存了%d条下一高度的消息和%d组投票，应不超过%d", len(node.future), len(node.votes), limit)
+	}
+	if len(node.latest) != 1 {
+		t.Fatalf("应只记录1个发言的验证者，实际%d个", len(node.latest))
+	}
+
+	// 诚实验证者的下一高度消息不会被挤掉；再有一个验证者到过更高轮次时跟上
+	send(keys[1], BFTPrevote, 2, 0, "")
+	if _, ok := node.future[bftFutureKey{sender: keys[1].Address(), voteType: BFTPrevote, round: 0}]; !ok {
+		t.Fatal("诚实验证者的下一高度投票应被缓存")
+	}
+	send(keys[2], BFTPrevote, 1, 20, "")
+	if node.round != 20 {
+		t.Fatalf("f+1个验证者到过第20轮时应跟上，实际第%d轮", node.round)
+	}
+}
+
+// TestContractExecution 部署两个合约：代理合约写入自己的存储后调用计数器合约。
+// 被调用合约回滚时只撤销它自己的修改；gas耗尽时整笔调用回滚，交易仍上链；
+// 合约状态随快照传给新节点
+func TestContractExecution(t *testing.T) {
+	wallet := NewWallet("")
+	alice, err := wallet.NewKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	counter, err := AssembleVM(counterContractSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 代理合约：记录调用次数，再把参数0转发给参数1指定的合约，返回被调用合约是否成功
+	proxy, err := AssembleVM(`
+		PUSH "calls"
+		DUP 0
+		SLOAD
+		PUSH 1
+		ADD
+		SSTORE
+		ARG 0
+		PUSH 1
+		ARG 1
+		CALL
+		RETURN  ; 成功标志
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, counterAddr, err := wallet.Deploy(bc, alice, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, proxyAddr, err := wallet.Deploy(bc, alice, proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	if !counterAddr.IsContract() || string(bc.ContractCode(proxyAddr)) != string(proxy) {
+		t.Fatal("合约未部署到派生地址")
+	}
+
+	invoke := func(gas uint64, args ...string) *Receipt {
+		t.Helper()
+		raw := make([][]byte, len(args))
+		for i, arg := range args {
+			raw[i] = []byte(arg)
+		}
+		tx, err := wallet.Invoke(bc, alice, proxyAddr, raw, WithGasLimit(gas))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bc.MineBlock()
+		receipt, err := bc.Receipt(tx.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return receipt
+	}
+	calls := func() uint64 {
+		n, _ := decodeVMNum(bc.ContractStorage(proxyAddr, []byte("calls")))
+		return n
+	}
+	proxyKey := []byte(proxyAddr.String())
+
+	// 正常转发：两个合约的存储都更新
+	if r := invoke(DefaultGasLimit, "inc", counterAddr.String()); !r.Success || !vmTruthy(r.ReturnData) {
+		t.Fatalf("转发调用应成功: %+v", r)
+	}
+	if n, _ := decodeVMNum(bc.ContractStorage(counterAddr, proxyKey)); n != 1 || calls() != 1 {
+		t.Fatalf("计数%d，调用次数%d，应均为1", n, calls())
+	}
+
+	// 被调用合约回滚：代理合约的修改保留，返回失败标志
+	if r := invoke(DefaultGasLimit, "dec", counterAddr.String()); !r.Success || vmTruthy(r.ReturnData) {
+		t.Fatalf("被调用合约回滚时代理调用应成功并返回失败标志: %+v", r)
+	}
+	if calls() != 2 {
+		t.Fatalf("调用次数%d，应为2", calls())
+	}
+
+	// gas耗尽：整笔调用回滚，gas全部消耗
+	r := invoke(3000, "inc", counterAddr.String())
+	if r.Success || !strings.Contains(r.Error, ErrOutOfGas.Error()) || r.GasUsed != 3000 {
+		t.Fatalf("gas不足时应回滚并耗尽gas: %+v", r)
+	}
+	if n, _ := decodeVMNum(bc.ContractStorage(counterAddr, proxyKey)); n != 1 || calls() != 2 {
+		t.Fatalf("gas耗尽后计数%d、调用次数%d，应保持1和2", n, calls())
+	}
+
+	// 只读调用不修改状态
+	if _, err := bc.CallContract(alice, proxyAddr, MaxTxGas, []byte("inc"), []byte(counterAddr.String())); err != nil {
+		t.Fatal(err)
+	}
+	if calls() != 2 {
+		t.Fatal("只读调用修改了合约存储")
+	}
+
+	// 链尾合约状态随区块增量更新，回滚、重新接入与裁剪后都与重放结果一致
+	checkState := func(stage string) {
+		t.Helper()
+		bc.mu.RLock()
+		defer bc.mu.RUnlock()
+		replayed := bc.contractStateAt(bc.lastBlock().Index(), nil)
+		if !reflect.DeepEqual(bc.tipContracts().snapshot(), replayed.snapshot()) {
+			t.Fatalf("%s: 链尾合约状态与重放结果不一致", stage)
+		}
+	}
+	checkState("接入区块")
+	var disconnected []*Block
+	for i := 0; i < 2; i++ {
+		block, err := bc.DisconnectTip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		disconnected = append([]*Block{block}, disconnected...)
+	}
+	checkState("回滚区块")
+	if calls() != 1 {
+		t.Fatalf("回滚后调用次数%d，应为1", calls())
+	}
+	for _, block := range disconnected {
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkState("重新接入")
+	bc.SetPruneDepth(1)
+	checkState("裁剪")
+	if calls() != 2 {
+		t.Fatalf("重新接入后调用次数%d，应为2", calls())
+	}
+
+	// 合约状态随快照传给新节点
+	snapshot, err := bc.SnapshotAt(bc.LastBlock().Index())
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := NewBlockchainFromSnapshot(bc.Genesis(), snapshot, snapshot.Commitment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := node.CallContract(proxyAddr, counterAddr, MaxTxGas, []byte("get"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := decodeVMNum(got); n != 1 {
+		t.Fatalf("新节点查询到的计数为%d，应为1", n)
+	}
+}
+
+// TestEVMCounter 部署src/Counter.sol的字节码，通过calldata调用并查询。
+// 沙箱中没有solc，testdata/Counter.bin不是编译器输出，而是按solc 0.8.26（shanghai，使用PUSH0）
+// 的函数分发、ABI解码与溢出检查布局手工汇编的初始化代码加运行时代码，末尾附solc格式的
+// CBOR元数据尾（IPFS哈希为全零占位）。PATH中有solc时再用其对src/Counter.sol的实际输出运行同一流程
+func TestEVMCounter(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		hexCode, err := os.ReadFile("testdata/Counter.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testEVMCounter(t, strings.TrimSpace(string(hexCode)))
+	})
+	t.Run("solc", func(t *testing.T) {
+		solc, err := exec.LookPath("solc")
+		if err != nil {
+			t.Skip("PATH中没有solc")
+		}
+		version, _ := exec.Command(solc, "--version").Output()
+		t.Logf("%s", bytes.TrimSpace(version))
+		out, err := exec.Command(solc, "--bin", "../../src/Counter.sol").Output()
+		if err != nil {
+			t.Fatalf("编译src/Counter.sol失败: %v", err)
+		}
+		// 输出格式为"======= 文件:Counter =======\nBinary:\n<十六进制>"
+		_, bin, ok := strings.Cut(string(out), "Binary:")
+		if !ok {
+			t.Fatalf("无法解析solc输出: %s", out)
+		}
+		testEVMCounter(t, strings.TrimSpace(bin))
+	})
+}
+
+// testEVMCounter 部署Counter合约的初始化代码（十六进制），依次调用setNumber、increment与number
+func testEVMCounter(t *testing.T, hexCode string) {
+	initCode, err := hex.DecodeString(hexCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := NewWallet("")
+	alice, err := wallet.NewKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	_, counter, err := wallet.DeployEVM(bc, alice, initCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	if code := bc.ContractCode(counter); len(code) == 0 || len(code) >= len(initCode) {
+		t.Fatalf("运行时代码长度%d，应为初始化代码返回的部分", len(code))
+	}
+
+	selector := func(sel string, args ...*big.Int) []byte {
+		data, _ := hex.DecodeString(sel)
+		for _, arg := range args {
+			data = append(data, word32(arg)...)
+		}
+		return data
+	}
+	send := func(calldata []byte) *Receipt {
+		t.Helper()
+		tx, err := wallet.InvokeEVM(bc, alice, counter, calldata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bc.MineBlock()
+		receipt, err := bc.Receipt(tx.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return receipt
+	}
+	number := func() *big.Int {
+		t.Helper()
+		ret, err := bc.CallEVM(alice, counter, MaxTxGas, selector("8381f58a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return new(big.Int).SetBytes(ret)
+	}
+
+	if r := send(selector("3fb5c1cb", big.NewInt(41))); !r.Success {
+		t.Fatalf("setNumber失败: %s", r.Error)
+	}
+	if r := send(selector("d09de08a")); !r.Success || r.GasUsed <= gasTxContract {
+		t.Fatalf("increment失败: %+v", r)
+	}
+	if n := number(); n.Int64() != 42 {
+		t.Fatalf("number()为%s，应为42", n)
+	}
+	if slot := bc.ContractStorage(counter, make([]byte, 32)); new(big.Int).SetBytes(slot).Int64() != 42 {
+		t.Fatal("存储槽0应为42")
+	}
+
+	// 溢出时以Panic(0x11)回滚，状态不变
+	max := new(big.Int).Set(tt256m1)
+	send(selector("3fb5c1cb", max))
+	r := send(selector("d09de08a"))
+	panicData := selector("4e487b71", big.NewInt(0x11))
+	if r.Success || !bytes.Equal(r.ReturnData, panicData) {
+		t.Fatalf("溢出应以Panic(0x11)回滚: %+v", r)
+	}
+	if number().Cmp(max) != 0 {
+		t.Fatal("回滚后number()应保持最大值")
+	}
+	if r := send(selector("12345678")); r.Success {
+		t.Fatal("未知函数选择器应回滚")
+	}
+}
+
+// TestEVMOpcodes 直接执行运行时代码，检查JUMPDEST分析、日志与gas耗尽
+func TestEVMOpcodes(t *testing.T) {
+	addr := ContractAddress(Address{}, 0)
+	tests := []struct {
+		name    string
+		code    string
+		gas     uint64
+		wantErr string
+		want    string
+		logs    int
+	}{
+		// PUSH1 4 JUMP PUSH1 0x5b STOP：偏移4的0x5b是PUSH数据，不是JUMPDEST
+		{"跳入PUSH数据", "600456605b00", 100, "不是JUMPDEST", "", 0},
+		// 7*6=42写入内存后返回最后一个字节
+		{"算术与内存", "60076006026000526001601ff3", 100, "", "2a", 0},
+		// 内存写入0x2a后以主题7记录32字节数据
+		{"日志", "602a5f52600760205fa100", 2000, "", "", 1},
+		// 死循环：JUMPDEST PUSH0 JUMP
+		{"gas耗尽", "5b5f56", 1000, ErrOutOfGas.Error(), "", 0},
+	}
+	for _, tt := range tests {
+		code, _ := hex.DecodeString(tt.code)
+		state := contractState{addr: {code: code, storage: make(map[string][]byte), evm: true}}
+		vm := newVM(state, VMContext{}, tt.gas)
+		ret, err := vm.callEVM(Address{}, addr, nil)
+		switch {
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: 错误为%v，应包含%q", tt.name, err, tt.wantErr)
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case hex.EncodeToString(ret) != tt.want || len(vm.logs) != tt.logs:
+			t.Errorf("%s: 返回%x、日志%d条，期望%s、%d条", tt.name, ret, len(vm.logs), tt.want, tt.logs)
+		}
+	}
+}
+
+// TestFeeMarket 满块后基础费用上调、空块后回落：基础费用被销毁，小费归出块者，
+// 最高手续费不足以支付基础费用的交易留在池中直到基础费用回落
+func TestFeeMarket(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	miner, _ := wallet.NewKey("miner")
+	genesis := DevGenesis(1)
+	genesis.Params.GasTarget = 2 * GasTxTransfer
+	genesis.Params.InitialBaseFee = 800
+	genesis.Alloc = []GenesisAlloc{{Address: alice, Balance: 100 * Coin}, {Address: bob, Balance: 100 * Coin}}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.SetMinerAddress(miner)
+	reward := genesis.Params.BlockReward
+
+	// 4笔带小费的转账占满区块gas上限，Bob不带小费的交易排在后面放不进区块
+	const tip = 5 * GasTxTransfer
+	for i := 0; i < 4; i++ {
+		if _, err := wallet.Send(bc, alice, bob, Coin, WithTip(tip)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending, err := wallet.Send(bc, bob, alice, Coin, WithFee(800*GasTxTransfer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := bc.MineBlock()
+	if block.BaseFee() != 800 || block.GasUsed() != 4*GasTxTransfer || len(block.Transactions()) != 5 {
+		t.Fatalf("区块1: 基础费用%d、gas用量%d、交易%d笔", block.BaseFee(), block.GasUsed(), len(block.Transactions()))
+	}
+	if got, want := bc.Balance(miner), reward+4*tip; got != want {
+		t.Fatalf("出块者余额%s，应为奖励加小费%s", got, want)
+	}
+	if got, want := bc.Balance(alice), 100*Coin-4*(Coin+800*GasTxTransfer+tip); got != want {
+		t.Fatalf("Alice余额%s，应为%s", got, want)
+	}
+
+	// 基础费用上调1/8，Bob的最高手续费不够支付，交易留在池中
+	block = bc.MineBlock()
+	if block.BaseFee() != 900 || len(block.Transactions()) != 1 {
+		t.Fatalf("区块2: 基础费用%d、交易%d笔", block.BaseFee(), len(block.Transactions()))
+	}
+	if _, ok := bc.mempool.Get(pending.ID()); !ok {
+		t.Fatal("最高手续费不足的交易应留在交易池")
+	}
+
+	// 空块后基础费用回落，交易打包，扣除销毁部分后余下的手续费作为小费
+	block = bc.MineBlock()
+	if block.BaseFee() != 788 || len(block.Transactions()) != 2 {
+		t.Fatalf("区块3: 基础费用%d、交易%d笔", block.BaseFee(), len(block.Transactions()))
+	}
+	if got, want := bc.Balance(miner), 3*reward+4*tip+(800-788)*GasTxTransfer; got != want {
+		t.Fatalf("出块者余额%s，应为%s", got, want)
+	}
+
+	next := bc.NextBaseFee()
+	if next != 739 {
+		t.Fatalf("下一个区块的基础费用%d，应为739", next)
+	}
+	if _, err := wallet.Send(bc, alice, bob, Coin, WithFee(next*GasTxTransfer-1)); err == nil || !strings.Contains(err.Error(), "基础费用") {
+		t.Fatalf("最高手续费低于基础费用的交易应被拒绝: %v", err)
+	}
+
+	history, err := bc.FeeHistory(2, []float64{0, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &FeeHistory{
+		OldestBlock:  2,
+		BaseFees:     []Amount{900, 788, 739},
+		GasUsedRatio: []float64{0, 0.5},
+		Rewards:      [][]Amount{{0, 0}, {12, 12}},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Fatalf("手续费历史为%+v，应为%+v", history, want)
+	}
+
+	// 钱包估算：小费取最近区块小费中位数的最大值，最高手续费预留两倍基础费用
+	tx, err := wallet.BuildTransaction(bc, alice, bob, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Tip() != 12*GasTxTransfer || tx.Fee() != 2*next*GasTxTransfer+tx.Tip() {
+		t.Fatalf("估算的最高手续费%d、小费%d", tx.Fee(), tx.Tip())
+	}
+
+	// 明确指定0小费的交易只支付基础费用，余下的最高手续费不归出块者
+	minerBefore, aliceBefore := bc.Balance(miner), bc.Balance(alice)
+	if _, err := wallet.Send(bc, alice, bob, Coin, WithFee(Coin), WithTip(0)); err != nil {
+		t.Fatal(err)
+	}
+	block = bc.MineBlock()
+	if got := bc.Balance(miner) - minerBefore; got != reward {
+		t.Fatalf("0小费交易使出块者多得%s，应只有奖励%s", got, reward)
+	}
+	if got, want := aliceBefore-bc.Balance(alice), Coin+block.BaseFee()*GasTxTransfer; got != want {
+		t.Fatalf("0小费交易支出%s，应为%s", got, want)
+	}
+}
+
+// TestBase58CheckAddress 检查Base58编码、前导零、地址往返与拼写错误检测
+func TestBase58CheckAddress(t *testing.T) {
+	tests := []struct {
+		input []byte
+		want  string
+	}{
+		{[]byte("hello world"), "StV1DL6CwTryKyV"},
+		{[]byte{0, 0, 1}, "112"},
+		{[]byte{0}, "1"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := base58Encode(tt.input); got != tt.want {
+			t.Errorf("base58Encode(%x) = %q，应为%q", tt.input, got, tt.want)
+		}
+		if got, err := base58Decode(tt.want); err != nil || !bytes.Equal(got, tt.input) {
+			t.Errorf("base58Decode(%q) = %x, %v，应为%x", tt.want, got, err, tt.input)
+		}
+	}
+	// 版本号0、哈希全零的地址与比特币的同类地址一致，前导零字节都编码为'1'
+	if got := (Address{}).String(); got != "1111111111111111111114oLvT2" {
+		t.Errorf("全零地址为%q", got)
+	}
+	if _, err := base58Decode("0OIl"); err == nil {
+		t.Error("易混淆字符应被拒绝")
+	}
+
+	keys, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := keys.Address()
+	parsed, err := ParseAddress(addr.String())
+	if err != nil || parsed != addr {
+		t.Fatalf("地址往返失败: %v", err)
+	}
+
+	// 任意位置改错一个字符都会因校验和不匹配被拒绝
+	s := addr.String()
+	for i := range s {
+		typo := []byte(s)
+		if typo[i] == '2' {
+			typo[i] = '3'
+		} else {
+			typo[i] = '2'
+		}
+		if ValidateAddress(string(typo)) {
+			t.Errorf("第%d个字符拼写错误的地址 %s 未被拒绝", i, typo)
+		}
+	}
+	data, _ := base58Decode(s)
+	data[len(data)-1] ^= 1
+	if _, err := ParseAddress(base58Encode(data)); err == nil || !strings.Contains(err.Error(), "校验和") {
+		t.Errorf("校验和错误应被拒绝: %v", err)
+	}
+	if _, err := ParseAddress(base58CheckEncode(0x7f, make([]byte, AddressHashLen))); err == nil {
+		t.Error("未知版本号应被拒绝")
+	}
+	if _, err := ParseAddress(base58CheckEncode(AddressVersionPubKeyHash, make([]byte, 19))); err == nil {
+		t.Error("哈希长度错误应被拒绝")
+	}
+}
+
+// TestMnemonicAndHDKeys 检查助记词校验和、按SLIP-0010派生Ed25519密钥，以及同一助记词恢复出相同地址
+func TestMnemonicAndHDKeys(t *testing.T) {
+	mnemonic, err := MnemonicFromEntropy(mustHex(t, "00112233445566778899aabbccddeeff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Fields(mnemonic)
+	if len(words) != 12 {
+		t.Fatalf("128位熵应编码为12个词，实际%d个", len(words))
+	}
+	if entropy, err := MnemonicToEntropy(strings.ToUpper(mnemonic)); err != nil || hex.EncodeToString(entropy) != "00112233445566778899aabbccddeeff" {
+		t.Fatalf("助记词往返得到%x, %v", entropy, err)
+	}
+	// 末词改为词表中的下一个词后校验和不匹配；漏词、非词表单词同样被拒绝
+	last := mnemonicWordIndex[words[11]]
+	for _, bad := range []string{
+		strings.Join(append(words[:11:11], mnemonicWordList[(last+1)%len(mnemonicWordList)]), " "),
+		strings.Join(words[:11], " "),
+		strings.Join(append(words[:11:11], "notaword"), " "),
+	} {
+		if _, err := MnemonicToSeed(bad, ""); err == nil {
+			t.Errorf("无效助记词 %q 未被拒绝", bad)
+		}
+	}
+
+	// SLIP-0010 Ed25519测试向量1：m 与 m/0'
+	master, err := NewMasterKey(mustHex(t, "000102030405060708090a0b0c0d0e0f"), SchemeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(master.key); got != "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7" {
+		t.Fatalf("主私钥为%s", got)
+	}
+	child, err := master.Derive("m/0'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(child.key); got != "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3" {
+		t.Fatalf("m/0'私钥为%s", got)
+	}
+	if _, err := master.Child(0); err == nil || !strings.Contains(err.Error(), "硬化") {
+		t.Fatalf("Ed25519非硬化派生应被拒绝: %v", err)
+	}
+
+	// 同一助记词与口令恢复出相同地址，口令不同则地址不同
+	addresses := func(passphrase string, scheme KeyScheme) []Address {
+		seed, err := MnemonicToSeed(mnemonic, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, err := DeriveAccountKeys(seed, scheme, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var addrs []Address
+		for _, k := range keys {
+			addrs = append(addrs, k.Address())
+		}
+		return addrs
+	}
+	for _, scheme := range []KeyScheme{SchemeEd25519, SchemeECDSA} {
+		first, again := addresses("pass", scheme), addresses("pass", scheme)
+		if !reflect.DeepEqual(first, again) {
+			t.Errorf("%s: 同一助记词恢复出的地址不同", scheme)
+		}
+		if first[0] == first[1] || reflect.DeepEqual(first, addresses("other", scheme)) {
+			t.Errorf("%s: 不同索引或口令派生出相同地址", scheme)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestWallet 钱包的余额、历史记录与加密保存：HD钱包重新加载后继续按顺序派生，口令错误时拒绝加载
+func TestWallet(t *testing.T) {
+	mnemonic, err := MnemonicFromEntropy(mustHex(t, "00112233445566778899aabbccddeeff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/wallet.json"
+	wallet, err := NewHDWallet(path, mnemonic, "", SchemeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	outsider, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	tx, err := wallet.Send(bc, alice, bob, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost, err := tx.Cost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.Send(bc, alice, outsider.Address(), 2*Coin); err != nil {
+		t.Fatal(err)
+	}
+	pending := bc.PendingTransactions()
+	var pendingCost []Amount
+	for _, p := range pending {
+		c, _ := p.Cost()
+		pendingCost = append(pendingCost, c)
+	}
+	want := mustBalance(bc.SpendableBalance(alice).Sub(mustBalance(SumAmounts(pendingCost...))))
+	if got := wallet.AvailableBalance(bc, alice); got != want {
+		t.Fatalf("可用余额为%s，应为%s", got, want)
+	}
+	if got := wallet.AvailableBalance(bc, bob); got != 0 {
+		t.Fatalf("待打包的收入不应计入可用余额，实际%s", got)
+	}
+
+	history := wallet.History(bc)
+	if len(history) != 3 || !history[0].Confirmed() || history[0].Received != MiningReward {
+		t.Fatalf("历史记录应为1笔挖矿奖励加2笔待打包交易: %+v", history)
+	}
+	if r := history[1]; r.TxID != tx.ID() || r.Confirmed() || r.Received != Coin || r.Spent != cost {
+		t.Fatalf("钱包内部转账应同时记录收入与支出: %+v", r)
+	}
+	if r := history[2]; r.Received != 0 || r.Spent == 0 {
+		t.Fatalf("转给外部地址只记录支出: %+v", r)
+	}
+	block := bc.MineBlock()
+	for _, r := range wallet.History(bc)[1:] {
+		if r.BlockIndex != block.Index() {
+			t.Fatalf("打包后记录应标记区块高度%d: %+v", block.Index(), r)
+		}
+	}
+	if got := wallet.AvailableBalance(bc, bob); got != Coin {
+		t.Fatalf("打包后bob可用余额为%s，应为%s", got, Coin)
+	}
+
+	// 加密保存后重新加载
+	wallet.SetPassphrase("correct horse")
+	if err := wallet.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "PRIVATE KEY") || strings.Contains(string(data), "alice") {
+		t.Fatal("加密的钱包文件不应包含明文私钥或标签")
+	}
+	for _, wrong := range []string{"", "wrong horse"} {
+		if _, err := LoadWallet(path, wrong); err == nil {
+			t.Fatalf("口令%q不应能加载钱包", wrong)
+		} else if wrong != "" && !errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("口令错误应返回ErrWrongPassphrase: %v", err)
+		}
+	}
+	loaded, err := LoadWallet(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(loaded.Addresses(), wallet.Addresses()) {
+		t.Fatal("加载后的地址与保存前不一致")
+	}
+	if addr, ok := loaded.AddressByLabel("bob"); !ok || addr != bob {
+		t.Fatal("加载后应能按标签找到地址")
+	}
+	if len(loaded.History(bc)) != len(wallet.History(bc)) {
+		t.Fatal("加载后的历史记录与保存前不一致")
+	}
+	next, _ := wallet.NewKey("carol")
+	if got, _ := loaded.NewKey("carol"); got != next {
+		t.Fatal("加载后的HD钱包应从下一个索引继续派生")
+	}
+	if _, err := loaded.Send(bc, bob, alice, Coin/2); err != nil {
+		t.Fatalf("加载的私钥应能签名: %v", err)
+	}
+
+	// 未加密的钱包不需要口令
+	plain := NewWallet(t.TempDir() + "/plain.json")
+	if _, err := plain.ImportKey("outsider", outsider); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWallet(plain.path, "correct horse"); err == nil {
+		t.Fatal("未加密的钱包文件不应接受口令")
+	}
+	if loaded, err := LoadWallet(plain.path, ""); err != nil || !loaded.Owns(outsider.Address()) {
+		t.Fatalf("加载未加密的钱包失败: %v", err)
+	}
+
+	// 派生失败时不跳过索引
+	broken := &Wallet{seed: []byte{1}, scheme: SchemeEd25519}
+	if _, err := broken.NewKey("x"); err == nil || broken.nextKey != 0 {
+		t.Fatalf("派生失败时索引应保持0，实际%d: %v", broken.nextKey, err)
+	}
+}
+
+// TestPartiallySignedTransactionRoundTrip 多签交易经编码传递后由下一位签名人补签并提交，
+// 估算出的最高小费随编码传递，已有签名仍然有效
+func TestPartiallySignedTransactionRoundTrip(t *testing.T) {
+	keys := make([]KeyPair, 3)
+	publicKeys := make([][]byte, 3)
+	for i := range keys {
+		k, err := NewEd25519KeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i], publicKeys[i] = k, k.PublicKeyBytes()
+	}
+	policy, err := NewMultisigPolicy(2, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(policy.Address())
+	bc.MineBlock()
+
+	recipient := keys[0].Address()
+	psbt, err := NewPartiallySignedTransaction(bc, policy, recipient, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !psbt.Transaction().HasTip() {
+		t.Fatal("多签交易应带有估算的最高小费")
+	}
+	if err := psbt.Sign(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := psbt.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := DecodePartiallySignedTransaction(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Transaction().ID() != psbt.Transaction().ID() || received.SignatureCount() != 1 {
+		t.Fatal("解码后的交易与原交易不一致")
+	}
+	if err := received.Sign(keys[2]); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := received.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	if got := bc.Balance(recipient); got != Coin {
+		t.Fatalf("收款方余额%s，应为%s", got, Coin)
+	}
+}
+
+// TestMultisigPolicy 检查多签地址派生、M-of-N门限、非策略内或重复签名的拒绝，以及编码校验
+func TestMultisigPolicy(t *testing.T) {
+	keys := make([]KeyPair, 4)
+	publicKeys := make([][]byte, 3)
+	for i := range keys {
+		k, err := NewEd25519KeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = k
+		if i < 3 {
+			publicKeys[i] = k.PublicKeyBytes()
+		}
+	}
+	outsider := keys[3]
+
+	// 公钥顺序不影响地址；地址是赎回脚本的脚本哈希地址，可从赎回脚本还原策略
+	policy, err := NewMultisigPolicy(2, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed, err := NewMultisigPolicy(2, [][]byte{publicKeys[2], publicKeys[1], publicKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Address() != reversed.Address() || !policy.Address().IsScriptHash() {
+		t.Fatal("同一组公钥应派生出同一个脚本哈希地址")
+	}
+	if other, _ := NewMultisigPolicy(3, publicKeys); other.Address() == policy.Address() {
+		t.Fatal("门限不同的策略地址应不同")
+	}
+	parsed, err := ParseMultisigPolicy(policy.RedeemScript())
+	if err != nil || parsed.Address() != policy.Address() || parsed.M() != 2 || parsed.N() != 3 {
+		t.Fatalf("从赎回脚本还原策略失败: %v", err)
+	}
+	for _, bad := range []struct {
+		m    int
+		keys [][]byte
+	}{
+		{0, publicKeys},
+		{4, publicKeys},
+		{1, nil},
+		{1, [][]byte{publicKeys[0], publicKeys[0]}},
+	} {
+		if _, err := NewMultisigPolicy(bad.m, bad.keys); err == nil {
+			t.Errorf("无效策略 %d-of-%d 未被拒绝", bad.m, len(bad.keys))
+		}
+	}
+
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(policy.Address())
+	bc.MineBlock()
+	psbt, err := NewPartiallySignedTransaction(bc, policy, outsider.Address(), Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 非策略内的密钥与重复签名被拒绝，签名数不足时不能生成交易
+	if err := psbt.Sign(outsider); err == nil {
+		t.Fatal("策略外密钥的签名应被拒绝")
+	}
+	if err := psbt.Sign(keys[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := psbt.Sign(keys[1]); err == nil {
+		t.Fatal("重复签名应被拒绝")
+	}
+	if _, err := psbt.Finalize(); err == nil || psbt.IsComplete() {
+		t.Fatal("1个签名不应满足2-of-3门限")
+	}
+
+	// 只有一个签名的解锁脚本不能通过脚本验证
+	incomplete := *psbt.Transaction()
+	incomplete.unlockScript = NewScriptBuilder().AddData(psbt.signatures[0].Signature).AddData(policy.RedeemScript()).Script()
+	if err := incomplete.Verify(); err == nil {
+		t.Fatal("签名不足的多签交易不应通过脚本验证")
+	}
+
+	// 编码后被篡改的部分签名交易解码失败
+	encoded, err := psbt.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(edit func(*psbtFile)) string {
+		data, _ := base64.StdEncoding.DecodeString(encoded)
+		var file psbtFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatal(err)
+		}
+		edit(&file)
+		data, _ = json.Marshal(file)
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	outsiderSig, _ := outsider.Sign(psbt.Transaction().signingBytes())
+	for name, s := range map[string]string{
+		"修改金额": tamper(func(f *psbtFile) { f.Amount++ }),
+		"策略外签名": tamper(func(f *psbtFile) {
+			f.Signatures[0] = MultisigSignature{PublicKey: outsider.PublicKeyBytes(), Signature: outsiderSig}
+		}),
+		"发送方不匹配":  tamper(func(f *psbtFile) { f.Sender = outsider.Address() }),
+		"非base64": "!!!",
+	} {
+		if _, err := DecodePartiallySignedTransaction(s); err == nil {
+			t.Errorf("%s: 解码应失败", name)
+		}
+	}
+
+	// 第二位签名人补签后门限满足，交易可上链
+	received, err := DecodePartiallySignedTransaction(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := received.Sign(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := received.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	if got := bc.Balance(outsider.Address()); got != Coin {
+		t.Fatalf("收款方余额%s，应为%s", got, Coin)
+	}
+}
+
+// TestScriptEngine 检查P2PKH与脚本哈希模板的验证、格式错误的脚本与栈下溢
+func TestScriptEngine(t *testing.T) {
+	keys, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigData := []byte("交易内容")
+	ctx := ScriptContext{SigData: sigData, BlockHeight: 10}
+	sig, err := keys.Sign(sigData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSig, err := other.Sign(sigData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkh := PayToPubKeyHashScript(keys.Address())
+
+	// 赎回脚本：提供sha256原像即可花费
+	secret := []byte("secret")
+	digest := sha256.Sum256(secret)
+	redeem := NewScriptBuilder().AddOp(OP_SHA256).AddData(digest[:]).AddOp(OP_EQUAL).Script()
+	p2sh := LockScriptForAddress(NewScriptAddress(redeem))
+
+	tests := []struct {
+		name    string
+		unlock  Script
+		lock    Script
+		wantErr string
+	}{
+		{"P2PKH", PayToPubKeyHashUnlockScript(sig, keys.PublicKeyBytes()), p2pkh, ""},
+		{"P2PKH公钥不匹配", PayToPubKeyHashUnlockScript(otherSig, other.PublicKeyBytes()), p2pkh, "锁定脚本"},
+		{"P2PKH签名错误", PayToPubKeyHashUnlockScript(otherSig, keys.PublicKeyBytes()), p2pkh, "锁定脚本"},
+		{"脚本哈希", NewScriptBuilder().AddData(secret).AddData(redeem).Script(), p2sh, ""},
+		{"脚本哈希原像错误", NewScriptBuilder().AddData([]byte("guess")).AddData(redeem).Script(), p2sh, "赎回脚本执行结果为false"},
+		{"脚本哈希赎回脚本不匹配", NewScriptBuilder().AddData(secret).AddData(append(redeem, byte(OP_VERIFY))).Script(), p2sh, "锁定脚本"},
+		{"解锁脚本含非压栈指令", NewScriptBuilder().AddData(sig).AddOp(OP_DUP).Script(), p2pkh, "只能包含压栈指令"},
+		{"数据被截断", nil, Script{0x05, 0x01, 0x02}, "截断"},
+		{"栈下溢", nil, NewScriptBuilder().AddOp(OP_DUP).Script(), "栈为空"},
+		{"OP_SWAP栈元素不足", NewScriptBuilder().AddInt(1).Script(), NewScriptBuilder().AddOp(OP_SWAP).Script(), "栈元素不足"},
+		{"OP_RETURN", nil, NewScriptBuilder().AddOp(OP_RETURN).Script(), "不可花费"},
+		{"未知操作码", nil, Script{0xff}, "UNKNOWN"},
+		{"IF未闭合", NewScriptBuilder().AddInt(1).Script(), NewScriptBuilder().AddOp(OP_IF).AddInt(1).Script(), "IF"},
+		{"结果为false", nil, NewScriptBuilder().AddOp(OP_0).Script(), "false"},
+		{"锁定高度未到", nil, NewScriptBuilder().AddInt(11).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), "未到锁定高度"},
+		{"锁定高度已到", nil, NewScriptBuilder().AddInt(10).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), ""},
+	}
+	for _, tt := range tests {
+		err := VerifyScripts(tt.unlock, tt.lock, ctx)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: 错误为%v，应包含%q", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, err := Script(make([]byte, MaxScriptSize+1)).parse(); err == nil {
+		t.Error("超长脚本应被拒绝")
+	}
+}
+
+// TestTimeLocks 相对时间锁的资金在锁定期满后才可花费，绝对时间锁的交易到期前留在池中，
+// 超出上限的相对时间锁被拒绝
+func TestTimeLocks(t *testing.T) {
+	wallet := NewWallet("")
+	company, _ := wallet.NewKey("company")
+	employee, _ := wallet.NewKey("employee")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(company)
+	bc.MineBlock()
+
+	if _, err := wallet.Send(bc, company, employee, 10*Coin, WithRelativeLock(2)); err != nil {
+		t.Fatal(err)
+	}
+	included := bc.MineBlock().Index()
+	for height := included + 1; height <= included+2; height++ {
+		want := Amount(0)
+		if height >= included+2 {
+			want = 10 * Coin
+		}
+		if got := bc.SpendableBalance(employee); got != want || bc.Balance(employee) != 10*Coin {
+			t.Fatalf("高度%d: 可花费%s，应为%s", height, got, want)
+		}
+		if height < included+2 {
+			bc.MineBlock()
+		}
+	}
+
+	release := int64(bc.LastBlock().Index() + 3)
+	tx, err := wallet.Send(bc, company, employee, Coin, WithLockTime(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		block := bc.MineBlock()
+		_, ok := bc.mempool.Get(tx.ID())
+		if int64(block.Index()) < release && !ok {
+			t.Fatalf("绝对时间锁未到期的交易在区块%d被打包", block.Index())
+		}
+		if !ok {
+			if int64(block.Index()) != release {
+				t.Fatalf("交易应在高度%d打包，实际%d", release, block.Index())
+			}
+			break
+		}
+	}
+
+	for _, blocks := range []int{-1, MaxRelativeLock + 1, math.MaxInt} {
+		if _, err := wallet.Send(bc, company, employee, Coin, WithRelativeLock(blocks)); err == nil || !strings.Contains(err.Error(), "时间锁") {
+			t.Errorf("相对时间锁%d应被拒绝: %v", blocks, err)
+		}
+	}
+}
+
+// TestReplayProtection 已打包的交易不能重放，其他链签名的交易被拒绝，序号超前的交易进入等待队列
+func TestReplayProtection(t *testing.T) {
+	wallet := NewWallet("")
+	aliceKey, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet.ImportKey("alice", aliceKey)
+	alice := aliceKey.Address()
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	tx, err := wallet.Send(bc, alice, bob, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(tx); !errors.Is(err, ErrTxAlreadyKnown) {
+		t.Fatalf("重复提交应返回ErrTxAlreadyKnown: %v", err)
+	}
+	bc.MineBlock()
+	if err := bc.AddTransaction(tx); err == nil || !strings.Contains(err.Error(), "序号过旧") {
+		t.Fatalf("已打包交易的重放应被拒绝: %v", err)
+	}
+
+	// 同一密钥为另一条链签名的交易
+	foreign := NewTransaction(alice, bob, Coin)
+	foreign.nonce = bc.NextNonce(alice)
+	foreign.chainID = "upchain-other"
+	foreign.fee = Coin
+	if err := foreign.Sign(aliceKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(foreign); err == nil || !strings.Contains(err.Error(), "链ID") {
+		t.Fatalf("其他链的交易应被拒绝: %v", err)
+	}
+	// 篡改链ID后签名失效
+	forged := *foreign
+	forged.chainID = bc.ChainID()
+	if err := bc.AddTransaction(&forged); err == nil {
+		t.Fatal("篡改链ID的交易应签名验证失败")
+	}
+
+	// 序号超前的交易进入等待队列，前序交易到齐后转为待打包
+	next := bc.NextNonce(alice)
+	later, err := wallet.Send(bc, alice, bob, Coin, WithNonce(next+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued := bc.QueuedTransactions(); len(queued) != 1 || queued[0].ID() != later.ID() {
+		t.Fatal("序号超前的交易应进入等待队列")
+	}
+	if _, err := wallet.Send(bc, alice, bob, Coin, WithNonce(next+1+MaxNonceGap+1)); err == nil {
+		t.Fatal("序号超前过多的交易应被拒绝")
+	}
+	if _, err := wallet.Send(bc, alice, bob, Coin, WithNonce(next)); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.QueuedTransactions()) != 0 || len(bc.PendingTransactions()) != 2 {
+		t.Fatal("前序交易到齐后等待交易应转为待打包")
+	}
+	if block := bc.MineBlock(); len(block.Transactions()) != 3 || bc.NextNonce(alice) != next+2 {
+		t.Fatalf("应按序号打包2笔交易，实际%d笔", len(block.Transactions())-1)
+	}
+}
+
+// TestMempoolLimits 检查交易池去重、容量满时淘汰低手续费率交易、单发送方限制与过期清理
+func TestMempoolLimits(t *testing.T) {
+	senders := make([]Address, 4)
+	for i := range senders {
+		k, err := NewEd25519KeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		senders[i] = k.Address()
+	}
+	newTx := func(sender Address, nonce uint64, fee Amount) *Transaction {
+		tx := NewTransaction(sender, senders[0], Coin)
+		tx.nonce, tx.fee = nonce, fee
+		return tx
+	}
+	accept := func(*Transaction) (bool, error) { return false, nil }
+	clock := NewFakeClock(devGenesisTime)
+	pool := NewMempool(MempoolConfig{MaxCount: 3, MaxPerSender: 2, Expiry: time.Hour}, accept)
+	pool.SetClock(clock)
+
+	low := newTx(senders[1], 0, 100)
+	lowNext := newTx(senders[1], 1, 5000)
+	mid := newTx(senders[2], 0, 2000)
+	for _, tx := range []*Transaction{low, lowNext, mid} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pool.Add(low); !errors.Is(err, ErrTxAlreadyKnown) {
+		t.Fatalf("重复交易应返回ErrTxAlreadyKnown: %v", err)
+	}
+	if err := pool.Add(newTx(senders[1], 2, 9000)); err == nil || !strings.Contains(err.Error(), "上限") {
+		t.Fatalf("超出单发送方上限应被拒绝: %v", err)
+	}
+
+	// 池满：手续费率低于池中最低者的交易被拒绝；更高的交易淘汰最低者及同一发送方序号更大的交易
+	if err := pool.Add(newTx(senders[3], 0, 50)); !errors.Is(err, ErrMempoolFull) {
+		t.Fatalf("低手续费率交易应返回ErrMempoolFull: %v", err)
+	}
+	high := newTx(senders[3], 0, 3000)
+	if err := pool.Add(high); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []*Transaction{low, lowNext} {
+		if _, ok := pool.Get(tx.ID()); ok {
+			t.Fatalf("序号%d的交易应随最低手续费率交易一起被淘汰", tx.Nonce())
+		}
+	}
+	if pool.Count() != 2 {
+		t.Fatalf("淘汰后应剩2笔交易，实际%d笔", pool.Count())
+	}
+
+	// 出块模板按小费从高到低排列
+	if got := pool.BlockTemplate(10, 1<<20, 1, func(*Transaction) bool { return true }); len(got) != 2 || got[0].ID() != high.ID() {
+		t.Fatal("出块模板应先选手续费更高的交易")
+	}
+
+	// 过期清理
+	clock.Advance(30 * time.Minute)
+	late := newTx(senders[1], 0, 1000)
+	if err := pool.Add(late); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(31 * time.Minute)
+	pool.Expire()
+	if pool.Count() != 1 || pool.Pending()[0].ID() != late.ID() {
+		t.Fatalf("过期交易应被清理，剩余%d笔", pool.Count())
+	}
+	pool.Remove([]string{late.ID()})
+	if pool.Count() != 0 || pool.Bytes() != 0 {
+		t.Fatal("移除后交易池应为空")
+	}
+}
+
+// TestIndexedAccountState 索引中的序号与可花费余额在接入、回滚与裁剪后都与完整重放的状态一致
+func TestIndexedAccountState(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	check := func(stage string) {
+		t.Helper()
+		bc.mu.RLock()
+		defer bc.mu.RUnlock()
+		height := bc.lastBlock().Index()
+		snapshot, err := bc.snapshotAt(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, addr := range []Address{alice, bob} {
+			for _, at := range []int{height + 1, height + 3} {
+				want, err := snapshot.spendableAt(addr, at)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := mustBalance(bc.spendableBalanceAt(addr, at)); got != want {
+					t.Fatalf("%s: %s在高度%d可花费%s，应为%s", stage, addr, at, got, want)
+				}
+			}
+			if got, want := bc.confirmedNonce(addr), snapshot.Account(addr).Nonce; got != want {
+				t.Fatalf("%s: %s的序号为%d，应为%d", stage, addr, got, want)
+			}
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := wallet.Send(bc, alice, bob, Coin, WithRelativeLock(2)); err != nil {
+			t.Fatal(err)
+		}
+		bc.MineBlock()
+		check(fmt.Sprintf("接入区块%d", bc.LastBlock().Index()))
+	}
+
+	bc.mu.Lock()
+	bc.disconnectTip()
+	bc.mu.Unlock()
+	check("回滚链尾")
+	if len(bc.PendingTransactions()) != 1 {
+		t.Fatal("回滚的交易应回到交易池")
+	}
+	bc.MineBlock()
+	check("重新打包")
+
+	bc.SetPruneDepth(1)
+	check("裁剪后")
+	if _, err := wallet.Send(bc, bob, alice, Coin); err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	check("裁剪后接入")
+}
+
+// TestAddressHistoryPaging 按地址分页查询交易时最新的在前，越界或过大的页码返回空页而不会溢出
+func TestAddressHistoryPaging(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+	var sent []string
+	for i := 0; i < 5; i++ {
+		tx, err := wallet.Send(bc, alice, bob, Coin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, tx.ID())
+		bc.MineBlock()
+	}
+
+	var got []string
+	for number := 0; ; number++ {
+		history, total, err := bc.GetTransactionsByAddress(bob, Page{Number: number, Size: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != len(sent) {
+			t.Fatalf("总数为%d，应为%d", total, len(sent))
+		}
+		if len(history) == 0 {
+			break
+		}
+		for _, loc := range history {
+			got = append(got, loc.Transaction.ID())
+		}
+	}
+	slices.Reverse(sent)
+	if !slices.Equal(got, sent) {
+		t.Fatalf("分页结果%v，应为%v", got, sent)
+	}
+
+	for _, page := range []Page{
+		{Number: math.MaxInt, Size: 2},
+		{Number: math.MaxInt / 2, Size: 3},
+		{Number: 1, Size: math.MaxInt},
+	} {
+		history, total, err := bc.GetTransactionsByAddress(bob, page)
+		if err != nil || len(history) != 0 || total != len(sent) {
+			t.Fatalf("页码%+v应返回空页: %d条, 总数%d, %v", page, len(history), total, err)
+		}
+	}
+	history, _, err := bc.GetTransactionsByAddress(bob, Page{Number: 0, Size: math.MaxInt})
+	if err != nil || len(history) != len(sent) {
+		t.Fatalf("单页应返回全部%d条交易: %d条, %v", len(sent), len(history), err)
+	}
+	if _, _, err := bc.GetTransactionsByAddress(bob, Page{Number: -1}); err == nil {
+		t.Fatal("负数页码应被拒绝")
+	}
+}
+
+// TestAmountArithmetic 金额运算在溢出或结果为负时返回错误，解析与格式化可互逆
+func TestAmountArithmetic(t *testing.T) {
+	if _, err := MaxAmount.Add(1); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("加法溢出应返回ErrAmountOverflow: %v", err)
+	}
+	if _, err := Amount(1).Sub(2); !errors.Is(err, ErrAmountNegative) {
+		t.Errorf("减法结果为负应返回ErrAmountNegative: %v", err)
+	}
+	if _, err := (MaxAmount/2 + 1).Mul(2); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("乘法溢出应返回ErrAmountOverflow: %v", err)
+	}
+	if _, err := SumAmounts(MaxAmount-1, 1, 1); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("累加溢出应返回ErrAmountOverflow: %v", err)
+	}
+	if sum, err := SumAmounts(MaxAmount-2, 1, 1); err != nil || sum != MaxAmount {
+		t.Errorf("累加到最大金额: %s, %v", sum, err)
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want Amount
+	}{
+		{"0", 0},
+		{"1.5", 150_000_000},
+		{"0.00000001", 1},
+		{"184467440737.09551615", MaxAmount},
+	} {
+		got, err := ParseCoins(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseCoins(%q) = %d, %v，应为%d", tc.in, got, err, tc.want)
+		}
+		if tc.want != 0 && got.String() != tc.in {
+			t.Errorf("%d 格式化为 %q，应为 %q", got, got.String(), tc.in)
+		}
+	}
+	for _, in := range []string{"184467440737.09551616", "-1", "1.000000001", "1.", "abc", ""} {
+		if _, err := ParseCoins(in); err == nil {
+			t.Errorf("ParseCoins(%q) 应返回错误", in)
+		}
+	}
+	if _, err := ParseCoins("-1"); !errors.Is(err, ErrAmountNegative) {
+		t.Errorf("负数应返回ErrAmountNegative: %v", err)
+	}
+	if _, err := ParseCoins("184467440737.09551616"); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("超出最大金额应返回ErrAmountOverflow: %v", err)
+	}
+
+	// 金额加手续费溢出的交易被拒绝，而不是回绕成小额
+	wallet := NewWallet("")
+	aliceKey, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet.ImportKey("alice", aliceKey)
+	alice := aliceKey.Address()
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+	tx := NewTransaction(alice, bob, MaxAmount)
+	tx.nonce, tx.chainID, tx.fee = bc.NextNonce(alice), bc.ChainID(), Coin
+	if err := tx.Sign(aliceKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Cost(); !errors.Is(err, ErrAmountOverflow) {
+		t.Fatalf("金额加手续费应溢出: %v", err)
+	}
+	if err := bc.AddTransaction(tx); err == nil {
+		t.Fatal("金额加手续费溢出的交易应被拒绝")
+	}
+}
+
+// TestEventSubscriptions 检查事件类型与地址过滤、交易提升为待打包时的事件、
+// 分叉切换失败不发事件、慢消费者断开与取消订阅
+func TestEventSubscriptions(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	carol, _ := wallet.NewKey("carol")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	all := bc.Subscribe(EventFilter{})
+	defer all.Unsubscribe()
+	pending := bc.Subscribe(EventFilter{Types: EventPendingTx})
+	defer pending.Unsubscribe()
+	forCarol := bc.Subscribe(EventFilter{Addresses: []Address{carol}})
+	defer forCarol.Unsubscribe()
+	next := func(s *Subscription) Event {
+		t.Helper()
+		select {
+		case e, ok := <-s.Events():
+			if !ok {
+				t.Fatalf("订阅已关闭: %v", s.Err())
+			}
+			return e
+		default:
+			t.Fatal("没有待读取的事件")
+			return Event{}
+		}
+	}
+	expectNone := func(s *Subscription) {
+		t.Helper()
+		select {
+		case e := <-s.Events():
+			t.Fatalf("不应收到%s事件", e.Type)
+		default:
+		}
+	}
+
+	// 序号超前的交易进入等待队列时不发事件，被提升时才发
+	nonce := bc.NextNonce(alice)
+	later, err := wallet.Send(bc, alice, carol, Coin, WithNonce(nonce+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNone(pending)
+	first, err := wallet.Send(bc, alice, bob, Coin, WithNonce(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []*Transaction{first, later} {
+		if e := next(pending); e.Type != EventPendingTx || e.Transactions[0].ID() != want.ID() {
+			t.Fatalf("应收到交易%s的待打包事件", want.ID())
+		}
+	}
+	if e := next(forCarol); e.Transactions[0].ID() != later.ID() {
+		t.Fatal("地址过滤应只投递涉及carol的交易")
+	}
+	expectNone(forCarol)
+
+	block := bc.MineBlock()
+	next(all)
+	next(all)
+	if e := next(all); e.Type != EventBlockConnected || e.Block != block || len(e.Transactions) != 3 {
+		t.Fatal("未过滤的订阅应收到包含全部交易的区块接入事件")
+	}
+	if e := next(forCarol); e.Type != EventBlockConnected || len(e.Transactions) != 1 || e.Transactions[0].ID() != later.ID() {
+		t.Fatal("区块事件应只包含涉及过滤地址的交易")
+	}
+	expectNone(pending)
+
+	// 权重不足的分叉切换失败，回滚与重新接入的事件都不投递
+	fork := NewDevBlockchain(1)
+	fork.SetMinerAddress(bob)
+	if err := bc.Reorganize([]*Block{fork.MineBlock()}); err == nil || !strings.Contains(err.Error(), "权重") {
+		t.Fatalf("权重较低的分叉不应切换: %v", err)
+	}
+	if bc.LastBlock() != block {
+		t.Fatal("切换失败后应恢复原主链")
+	}
+	expectNone(all)
+	expectNone(pending)
+	expectNone(forCarol)
+
+	// 慢消费者被断开，取消订阅后通道关闭且不再投递
+	slow := bc.Subscribe(EventFilter{Types: EventBlockConnected})
+	for i := 0; i <= EventBufferSize; i++ {
+		bc.MineBlock()
+	}
+	for range slow.Events() {
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) || !errors.Is(all.Err(), ErrSlowConsumer) {
+		t.Fatalf("缓冲区写满的订阅应被断开: %v, %v", slow.Err(), all.Err())
+	}
+	pending.Unsubscribe()
+	pending.Unsubscribe()
+	if _, ok := <-pending.Events(); ok {
+		t.Fatal("取消订阅后通道应关闭")
+	}
+	if pending.Err() != nil {
+		t.Fatalf("正常取消订阅不应有错误: %v", pending.Err())
+	}
+	bc.events.mu.Lock()
+	n := len(bc.events.subs)
+	bc.events.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("断开与取消的订阅应被移除，剩余%d个", n)
+	}
+}
+
+// TestExplorerSearch 搜索按高度、区块哈希、交易ID（含交易池）与地址跳转，查不到时返回404
+func TestExplorerSearch(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+	confirmed, err := wallet.Send(bc, alice, bob, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := bc.MineBlock()
+	unconfirmed, err := wallet.Send(bc, alice, bob, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explorer := NewExplorer(bc)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		explorer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	for _, tc := range []struct{ q, location string }{
+		{strconv.Itoa(block.Index()), "/block/" + block.Hash()},
+		{block.Hash(), "/block/" + block.Hash()},
+		{confirmed.ID(), "/tx/" + confirmed.ID()},
+		{unconfirmed.ID(), "/tx/" + unconfirmed.ID()},
+		{" " + bob.String() + " ", "/address/" + bob.String()},
+	} {
+		rec := get("/search?q=" + url.QueryEscape(tc.q))
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != tc.location {
+			t.Errorf("搜索 %q: %d %s，应跳转到%s", tc.q, rec.Code, rec.Header().Get("Location"), tc.location)
+			continue
+		}
+		if page := get(tc.location); page.Code != http.StatusOK {
+			t.Errorf("%s 返回%d", tc.location, page.Code)
+		}
+	}
+
+	for _, q := range []string{"", "999", strings.Repeat("ab", 32), "<script>alert(1)</script>"} {
+		rec := get("/search?q=" + url.QueryEscape(q))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("搜索 %q 应返回404，实际%d", q, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "<script>") {
+			t.Error("搜索词应被转义")
+		}
+	}
+
+	history := "/address/" + bob.String()
+	for _, page := range []string{"abc", "-1", "1.5", "99999999999999999999"} {
+		if rec := get(history + "?page=" + url.QueryEscape(page)); rec.Code != http.StatusBadRequest {
+			t.Errorf("页码 %q 应返回400，实际%d", page, rec.Code)
+		}
+	}
+	for _, page := range []string{"", "0", "1", strconv.Itoa(math.MaxInt)} {
+		rec := get(history + "?page=" + page)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/tx/"+confirmed.ID()) {
+			t.Errorf("页码 %q 应显示最后一页的交易，实际%d", page, rec.Code)
+		}
+	}
+}
+
+// spvTransportFunc 以函数实现SPVTransport，测试中用于篡改全节点的响应
+type spvTransportFunc func(SPVRequest) (SPVResponse, error)
+
+func (f spvTransportFunc) RoundTrip(req SPVRequest) (SPVResponse, error) { return f(req) }
+
+// TestMerkleProofs 各位置的包含证明都能还原Merkle根，篡改交易ID、兄弟节点、序号或区块交易后验证失败
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		txids := make([]string, n)
+		for i := range txids {
+			sum := sha256.Sum256([]byte{byte(i)})
+			txids[i] = hex.EncodeToString(sum[:])
+		}
+		root := MerkleRoot(txids)
+		for pos := range txids {
+			proof, err := NewMerkleProof(txids, pos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := proof.Verify(root); err != nil {
+				t.Fatalf("%d笔交易中第%d笔的证明验证失败: %v", n, pos, err)
+			}
+			forgedID := sha256.Sum256([]byte("forged"))
+			tampered := map[string]MerkleProof{
+				"交易ID": {TxID: hex.EncodeToString(forgedID[:]), Position: pos, Siblings: proof.Siblings},
+				"越界序号": {TxID: proof.TxID, Position: pos + 1<<len(proof.Siblings), Siblings: proof.Siblings},
+			}
+			if pos^1 < n {
+				tampered["左右顺序"] = MerkleProof{TxID: proof.TxID, Position: pos ^ 1, Siblings: proof.Siblings}
+			}
+			if len(proof.Siblings) > 0 {
+				siblings := append([]string(nil), proof.Siblings...)
+				siblings[len(siblings)-1] = emptyMerkleRoot
+				tampered["兄弟节点"] = MerkleProof{TxID: proof.TxID, Position: pos, Siblings: siblings}
+			}
+			for what, p := range tampered {
+				if p.Verify(root) == nil {
+					t.Errorf("%d笔交易中第%d笔的证明篡改%s后应验证失败", n, pos, what)
+				}
+			}
+		}
+		if _, err := NewMerkleProof(txids, n); err == nil {
+			t.Errorf("序号%d超出范围应返回错误", n)
+		}
+	}
+	if MerkleRoot(nil) != emptyMerkleRoot {
+		t.Error("空交易列表的Merkle根应为全0")
+	}
+
+	// 区块交易被替换后Merkle根不符，区块被拒绝
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	block := bc.MineBlock()
+	replica := NewDevBlockchain(1)
+	forged := newBlockFromHeader(block.Header(), []*Transaction{NewCoinbaseTransaction(bob, block.Transactions()[0].Amount(), block.Index())})
+	if err := replica.AddBlock(forged); err == nil || !strings.Contains(err.Error(), "Merkle") {
+		t.Fatalf("交易与Merkle根不符的区块应被拒绝: %v", err)
+	}
+	if err := replica.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// 轻节点用本地区块头校验全节点返回的证明
+	tx, err := wallet.Send(bc, alice, bob, Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	bc.MineBlock()
+	server := NewSPVServer(bc)
+	tamper := false
+	transport := spvTransportFunc(func(req SPVRequest) (SPVResponse, error) {
+		resp := server.Handle(req)
+		if tamper && resp.Proof != nil {
+			resp.Proof.Merkle.Siblings[0] = emptyMerkleRoot
+		}
+		return resp, nil
+	})
+	client, err := NewLightClient("", transport, bc.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if confirmations, err := client.VerifyPayment(tx.ID()); err != nil || confirmations != 2 {
+		t.Fatalf("交易应有2个确认: %d, %v", confirmations, err)
+	}
+	tamper = true
+	if _, err := client.VerifyPayment(tx.ID()); err == nil || !strings.Contains(err.Error(), "Merkle") {
+		t.Fatalf("被篡改的证明应验证失败: %v", err)
+	}
+	tamper = false
+
+	// 全节点位于自创世区块分叉的链上：更轻时保留本地链，更重时切换
+	forkChain := func(blocks int) *Blockchain {
+		fork := NewDevBlockchain(1)
+		fork.SetMinerAddress(bob)
+		for i := 0; i < blocks; i++ {
+			fork.MineBlock()
+		}
+		return fork
+	}
+	tip, _ := client.Header(client.Height())
+	server = NewSPVServer(forkChain(bc.LastBlock().Index() - 1))
+	if added, err := client.Sync(); err == nil || added != 0 {
+		t.Fatalf("较轻的分叉不应被接受: %d, %v", added, err)
+	}
+	if header, _ := client.Header(client.Height()); header.Hash != tip.Hash {
+		t.Fatal("拒绝较轻的分叉后本地链尾不应改变")
+	}
+	server = NewSPVServer(forkChain(bc.LastBlock().Index()))
+	if _, err := client.Sync(); err == nil {
+		t.Fatal("同样重的分叉不应被接受")
+	}
+	heavier := forkChain(bc.LastBlock().Index() + 2)
+	server = NewSPVServer(heavier)
+	if added, err := client.Sync(); err != nil || added != 2 {
+		t.Fatalf("较重的分叉应切换，本地高度净增2: %d, %v", added, err)
+	}
+	if header, _ := client.Header(1); header.Hash != heavier.Blocks()[1].Hash() {
+		t.Fatal("切换后的区块头应来自较重的分叉")
+	}
+	if _, err := client.VerifyPayment(tx.ID()); err == nil {
+		t.Fatal("切换分叉后原链上的交易不应通过验证")
+	}
+}
+
+// TestSnapshotBootstrap 裁剪后查询旧区块返回ErrPruned；新节点从快照引导并接入后续区块，
+// 状态与全节点一致；被篡改的快照被拒绝
+func TestSnapshotBootstrap(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+	old, err := wallet.Send(bc, alice, bob, 2*Coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock()
+	if _, err := wallet.Send(bc, alice, bob, Coin, WithRelativeLock(5)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		bc.MineBlock()
+	}
+
+	bc.SetPruneDepth(2)
+	pruned := bc.PrunedHeight()
+	if pruned != bc.LastBlock().Index()-2 {
+		t.Fatalf("裁剪高度为%d，应为%d", pruned, bc.LastBlock().Index()-2)
+	}
+	if _, err := bc.GetBlockByHeight(1); !errors.Is(err, ErrPruned) {
+		t.Errorf("查询已裁剪的区块应返回ErrPruned: %v", err)
+	}
+	if _, err := bc.GetTransaction(old.ID()); !errors.Is(err, ErrPruned) {
+		t.Errorf("查询已裁剪区块中的交易应返回ErrPruned: %v", err)
+	}
+	if _, ok := bc.GetHeaderByHeight(1); !ok {
+		t.Error("已裁剪的区块仍应保留区块头")
+	}
+	if _, err := bc.SnapshotAt(pruned - 1); !errors.Is(err, ErrPruned) {
+		t.Errorf("裁剪高度之前的快照应返回ErrPruned: %v", err)
+	}
+
+	// 新节点从快照文件引导，再接入快照之后的区块
+	snapshot, err := bc.SnapshotAt(pruned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/snapshot.json"
+	if err := snapshot.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := snapshot.Commitment // 从可信的全节点取得
+	node, err := NewBlockchainFromSnapshot(bc.Genesis(), loaded, trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := pruned + 1; height <= bc.LastBlock().Index(); height++ {
+		block, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := node.AddBlock(block); err != nil {
+			t.Fatalf("接入区块%d失败: %v", height, err)
+		}
+	}
+	if node.LastBlock().Hash() != bc.LastBlock().Hash() {
+		t.Fatal("新节点应同步到全节点的链尾")
+	}
+	for _, addr := range []Address{alice, bob} {
+		if node.Balance(addr) != bc.Balance(addr) || node.SpendableBalance(addr) != bc.SpendableBalance(addr) ||
+			node.NextNonce(addr) != bc.NextNonce(addr) {
+			t.Fatalf("新节点中%s的状态与全节点不一致", addr)
+		}
+	}
+	if _, err := node.GetBlockByHeight(1); !errors.Is(err, ErrPruned) {
+		t.Errorf("新节点查询快照高度及以下的区块应返回ErrPruned: %v", err)
+	}
+
+	// 被篡改的快照
+	tamper := func(modify func(s *StateSnapshot)) *StateSnapshot {
+		copied, err := LoadSnapshot(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modify(copied)
+		return copied
+	}
+	for what, forged := range map[string]*StateSnapshot{
+		"余额": tamper(func(s *StateSnapshot) { s.Accounts[0].Balance += Coin }),
+		"余额并重算承诺哈希": tamper(func(s *StateSnapshot) {
+			s.Accounts[0].Balance += Coin
+			s.Commitment = s.computeCommitment()
+		}),
+		"链ID": tamper(func(s *StateSnapshot) {
+			s.ChainID = "upchain-other"
+			s.Commitment = s.computeCommitment()
+		}),
+		"区块头":   tamper(func(s *StateSnapshot) { s.Headers[1].Timestamp++ }),
+		"区块头数量": tamper(func(s *StateSnapshot) { s.Headers = s.Headers[:len(s.Headers)-1] }),
+	} {
+		if _, err := NewBlockchainFromSnapshot(bc.Genesis(), forged, trusted); err == nil {
+			t.Errorf("篡改%s的快照应被拒绝", what)
+		}
+	}
+	if _, err := NewBlockchainFromSnapshot(bc.Genesis(), loaded, ""); err == nil {
+		t.Error("没有可信的承诺哈希时应拒绝引导")
+	}
+	// 即使调用方信任了伪造快照的承诺哈希，高度与区块头不符时也只返回错误
+	for _, height := range []int{-1, 0, pruned + 1} {
+		forged := tamper(func(s *StateSnapshot) {
+			s.Height = height
+			if height < 0 {
+				s.Headers = nil
+			}
+			s.Commitment = s.computeCommitment()
+		})
+		if _, err := NewBlockchainFromSnapshot(bc.Genesis(), forged, forged.Commitment); err == nil {
+			t.Errorf("高度为%d的快照应被拒绝", height)
+		}
+	}
+
+	// 不能回滚到裁剪高度及以下
+	for bc.LastBlock().Index() > pruned {
+		if _, err := bc.DisconnectTip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bc.DisconnectTip(); !errors.Is(err, ErrPruned) {
+		t.Errorf("回滚到裁剪高度应返回ErrPruned: %v", err)
+	}
+}
+
+// TestBlockLimits 出块时不超过交易数与字节数上限，超限的区块被其他节点拒绝
+func TestBlockLimits(t *testing.T) {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	bc := NewDevBlockchain(1)
+	bc.SetMinerAddress(alice)
+	replica := NewDevBlockchain(1)
+	if err := replica.AddBlock(bc.MineBlock()); err != nil {
+		t.Fatal(err)
+	}
+	send := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := wallet.Send(bc, alice, bob, Coin); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// 交易数上限含挖矿奖励交易
+	bc.SetBlockLimits(BlockLimits{MaxTransactions: 3, MaxBytes: DefaultBlockLimits.MaxBytes})
+	send(4)
+	full := bc.MineBlock()
+	if len(full.Transactions()) != 3 || len(bc.PendingTransactions()) != 2 {
+		t.Fatalf("区块应打包2笔交易并留下2笔，实际打包%d笔", len(full.Transactions())-1)
+	}
+	replica.SetBlockLimits(BlockLimits{MaxTransactions: 2, MaxBytes: DefaultBlockLimits.MaxBytes})
+	if err := replica.AddBlock(full); err == nil || !strings.Contains(err.Error(), "交易数") {
+		t.Fatalf("交易数超限的区块应被拒绝: %v", err)
+	}
+	replica.SetBlockLimits(DefaultBlockLimits)
+	if err := replica.AddBlock(full); err != nil {
+		t.Fatal(err)
+	}
+
+	// 字节数上限：只够区块头、按最大金额预留的挖矿奖励交易与1笔普通交易
+	pending := bc.PendingTransactions()
+	placeholder := NewCoinbaseTransaction(alice, MaxAmount, full.Index()+1)
+	placeholder.chainID = bc.ChainID()
+	limit := maxHeaderSize + placeholder.Size() + pending[0].Size()
+	bc.SetBlockLimits(BlockLimits{MaxTransactions: 100, MaxBytes: limit})
+	block := bc.MineBlock()
+	if len(block.Transactions()) != 2 || block.Size() > limit {
+		t.Fatalf("区块应只打包1笔交易且不超过%d字节，实际%d笔、%d字节", limit, len(block.Transactions())-1, block.Size())
+	}
+	replica.SetBlockLimits(BlockLimits{MaxTransactions: 100, MaxBytes: block.Size() - 1})
+	if err := replica.AddBlock(block); err == nil || !strings.Contains(err.Error(), "字节") {
+		t.Fatalf("字节数超限的区块应被拒绝: %v", err)
+	}
+	replica.SetBlockLimits(BlockLimits{MaxTransactions: 100, MaxBytes: block.Size()})
+	if err := replica.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGenesisConfig 同一配置总是得到同一创世哈希，任一共识相关字段不同则哈希不同；无效配置被拒绝
+func TestGenesisConfig(t *testing.T) {
+	alice, _ := NewWallet("").NewKey("alice")
+	base := func() *Genesis {
+		g := DevGenesis(2)
+		g.Alloc = []GenesisAlloc{{Address: alice, Balance: 100 * Coin}}
+		return g
+	}
+	g := base()
+	hash := g.Hash()
+	if hash != base().Hash() || hash != g.Block().Hash() {
+		t.Fatal("同一配置的创世哈希应相同")
+	}
+	path := t.TempDir() + "/genesis.json"
+	if err := g.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGenesis(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Hash() != hash {
+		t.Fatal("保存后重新加载的创世哈希应相同")
+	}
+
+	changes := map[string]func(g *Genesis){
+		"链ID":   func(g *Genesis) { g.ChainID = "upchain-test" },
+		"创世时间":  func(g *Genesis) { g.Timestamp = g.Timestamp.Add(time.Second) },
+		"难度":    func(g *Genesis) { g.Difficulty = 3 },
+		"哈希算法":  func(g *Genesis) { g.HashAlgorithm = HashSHA3_256 },
+		"区块奖励":  func(g *Genesis) { g.Params.BlockReward++ },
+		"区块上限":  func(g *Genesis) { g.Params.MaxBlockTransactions++ },
+		"未签名区块": func(g *Genesis) { g.Params.AllowUnsignedBlocks = !g.Params.AllowUnsignedBlocks },
+		"预分配":   func(g *Genesis) { g.Alloc[0].Balance++ },
+	}
+	for what, change := range changes {
+		changed := base()
+		change(changed)
+		if err := changed.Validate(); err != nil {
+			t.Fatalf("修改%s后的配置应有效: %v", what, err)
+		}
+		if changed.Hash() == hash {
+			t.Errorf("修改%s后创世哈希应不同", what)
+		}
+	}
+
+	invalid := map[string]func(g *Genesis){
+		"链ID":   func(g *Genesis) { g.ChainID = "" },
+		"创世时间":  func(g *Genesis) { g.Timestamp = time.Time{} },
+		"共识":    func(g *Genesis) { g.Consensus = "pob" },
+		"难度":    func(g *Genesis) { g.Difficulty = 0 },
+		"哈希算法":  func(g *Genesis) { g.HashAlgorithm = "md5" },
+		"区块上限":  func(g *Genesis) { g.Params.MaxBlockBytes = 0 },
+		"重复预分配": func(g *Genesis) { g.Alloc = append(g.Alloc, g.Alloc[0]) },
+		"空预分配":  func(g *Genesis) { g.Alloc[0].Balance = 0 },
+		"预分配溢出": func(g *Genesis) {
+			g.Alloc = append(g.Alloc, GenesisAlloc{Address: Address{version: AddressVersionScriptHash}, Balance: MaxAmount})
+		},
+		"质押":     func(g *Genesis) { g.Alloc[0].Stake = Coin },
+		"权益证明参数": func(g *Genesis) { g.Consensus = ConsensusPoS },
+	}
+	for what, change := range invalid {
+		g := base()
+		change(g)
+		if err := g.Validate(); err == nil {
+			t.Errorf("%s无效的创世配置应被拒绝", what)
+		}
+	}
+	if err := os.WriteFile(path, []byte(`{"chain_id": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGenesis(path); err == nil {
+		t.Error("格式错误的创世文件应被拒绝")
+	}
+}
+
+// TestProofOfStake 出块者按质押加权抽取且只有抽中者能出块，其他验证者签名的区块被拒绝；
+// 双签被举报的验证者质押与尚未到期的解除质押资金一并销毁
+func TestProofOfStake(t *testing.T) {
+	wallet := NewWallet("")
+	keys := make([]KeyPair, 3)
+	genesis := &Genesis{
+		ChainID:       "upchain-pos-test",
+		Timestamp:     devGenesisTime,
+		Consensus:     ConsensusPoS,
+		HashAlgorithm: HashSHA256,
+		PoS:           &PoSConfig{SlotSeconds: 5, MinStake: 10 * Coin, UnbondingBlocks: 3},
+		Params:        DefaultConsensusParams,
+	}
+	for i := range keys {
+		key, err := NewEd25519KeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		wallet.ImportKey(fmt.Sprintf("validator-%d", i), key)
+		genesis.Alloc = append(genesis.Alloc, GenesisAlloc{Address: key.Address(), Balance: 100 * Coin, Stake: Amount(i+1) * 100 * Coin})
+	}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(genesis.Timestamp)
+	bc.SetClock(clock)
+	replica.SetClock(clock)
+	pos := bc.Engine().(*ProofOfStake)
+
+	// produce 进入下一个时隙，只有抽中的验证者能出块；抽中者不在allowed中时本时隙空过
+	produce := func(allowed ...int) *Block {
+		t.Helper()
+		for {
+			clock.Advance(genesis.PoS.slot())
+			tip := bc.LastBlock().Header()
+			round, err := pos.round(tip, clock.Now().UnixNano())
+			if err != nil {
+				t.Fatal(err)
+			}
+			proposer, err := pos.Proposer(chainView{bc}, tip, round)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chosen := -1
+			for i, key := range keys {
+				if key.Address() == proposer {
+					chosen = i
+					continue
+				}
+				bc.SetSigner(key)
+				if _, err := bc.ProduceBlock(); !errors.Is(err, ErrNotProposer) {
+					t.Fatalf("非出块者 validator-%d 出块应返回ErrNotProposer: %v", i, err)
+				}
+			}
+			if !slices.Contains(allowed, chosen) {
+				continue
+			}
+			bc.SetSigner(keys[chosen])
+			bc.SetMinerAddress(proposer)
+			block, err := bc.ProduceBlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := replica.AddBlock(block); err != nil {
+				t.Fatalf("副本接入区块%d失败: %v", block.Index(), err)
+			}
+			return block
+		}
+	}
+
+	// 出块者按质押加权抽取：固定的种子下各验证者被抽中的次数与质押成比例
+	validators := bc.tipStakes().validators(genesis.PoS.MinStake)
+	picks := make(map[Address]int)
+	for i := 0; i < 6000; i++ {
+		proposer, err := selectProposer(validators, proposerSeed("seed", i, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		picks[proposer]++
+	}
+	for i, key := range keys {
+		if want := (i + 1) * 1000; picks[key.Address()] < want*9/10 || picks[key.Address()] > want*11/10 {
+			t.Errorf("质押%d00的验证者被抽中%d次，应约为%d次", i+1, picks[key.Address()], want)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		produce(0, 1, 2)
+	}
+
+	// 换成其他验证者签名的区块被拒绝
+	block := produce(0, 1, 2)
+	if _, err := replica.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := sealSigner(block.Header())
+	for _, key := range keys {
+		if key.Address() == signer {
+			continue
+		}
+		header := block.Header()
+		if err := pos.Seal(replica.LastBlock().Header(), &header, key); err != nil {
+			t.Fatal(err)
+		}
+		header.Hash = header.calculateHash()
+		if err := replica.AddBlock(newBlockFromHeader(header, block.Transactions())); !errors.Is(err, ErrNotProposer) {
+			t.Fatalf("非出块者签名的区块应被拒绝: %v", err)
+		}
+	}
+	if err := replica.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// validator-2先解除100的质押，在解绑期内因双签被举报
+	offender := keys[2].Address()
+	if _, err := wallet.Unstake(bc, offender, 100*Coin); err != nil {
+		t.Fatal(err)
+	}
+	produce(0, 1)
+	if bc.StakeOf(offender) != 200*Coin {
+		t.Fatalf("解除质押后应剩200，实际%s", bc.StakeOf(offender))
+	}
+	unbonding := bc.Balance(offender) - bc.SpendableBalance(offender)
+	if unbonding != 100*Coin {
+		t.Fatalf("解绑中的资金应为100，实际%s", unbonding)
+	}
+	tip := bc.LastBlock().Header()
+	var conflicting []BlockHeader
+	for _, offset := range []time.Duration{time.Second, 2 * time.Second} {
+		header := BlockHeader{
+			Index:        tip.Index + 1,
+			Timestamp:    tip.Timestamp + int64(offset),
+			MerkleRoot:   transactionsMerkleRoot(nil),
+			PreviousHash: tip.Hash,
+		}
+		if err := pos.Seal(tip, &header, keys[2]); err != nil {
+			t.Fatal(err)
+		}
+		header.Hash = header.calculateHash()
+		conflicting = append(conflicting, header)
+	}
+	// 重组后在另一个父区块上出块、或换轮后重新提案的诚实出块者不应被惩罚
+	for what, modify := range map[string]func(h *BlockHeader){
+		"父区块": func(h *BlockHeader) { h.PreviousHash = strings.Repeat("ab", 32) },
+		"轮次":  func(h *BlockHeader) { h.Round = 1 },
+	} {
+		header := conflicting[1]
+		modify(&header)
+		if err := pos.Seal(tip, &header, keys[2]); err != nil {
+			t.Fatal(err)
+		}
+		header.Hash = header.calculateHash()
+		evidence := NewDoubleSignEvidence(conflicting[0], header)
+		if _, err := evidence.Verify(bc.ChainID()); err == nil {
+			t.Errorf("%s不同的两个区块头不应构成双签", what)
+		}
+		if _, err := wallet.ReportDoubleSign(bc, keys[0].Address(), evidence); err == nil {
+			t.Errorf("%s不同的双签举报应被拒绝", what)
+		}
+	}
+	if _, err := wallet.ReportDoubleSign(bc, keys[0].Address(), NewDoubleSignEvidence(conflicting[0], conflicting[1])); err != nil {
+		t.Fatal(err)
+	}
+	before := bc.Balance(offender)
+	produce(0, 1)
+	if !bc.IsJailed(offender) || bc.StakeOf(offender) != 0 {
+		t.Fatal("双签的验证者应被惩罚并销毁质押")
+	}
+	for i := 0; i <= genesis.PoS.UnbondingBlocks; i++ {
+		if got := bc.Balance(offender); got != before-unbonding || bc.SpendableBalance(offender) != got {
+			t.Fatalf("解绑中的资金应被销毁: 余额%s，可花费%s，应为%s", got, bc.SpendableBalance(offender), before-unbonding)
+		}
+		produce(0, 1)
+	}
+	if _, err := wallet.Send(bc, offender, keys[0].Address(), before); err == nil {
+		t.Fatal("被销毁的解绑资金不应能花费")
+	}
+	if replica.Balance(offender) != bc.Balance(offender) {
+		t.Fatal("副本的余额应与出块节点一致")
+	}
+	snapshot, err := bc.SnapshotAt(bc.LastBlock().Index())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc := snapshot.Account(offender); acc.Balance != bc.Balance(offender) || len(acc.Locked) != 0 || !acc.Jailed {
+		t.Fatalf("快照中被惩罚者的状态不一致: %+v", acc)
+	}
+}
+
+// TestProofOfAuthority 轮值出块者按时出块，非轮值者须多等一个间隔；近期出过块的出块者与未授权地址的区块被拒绝；
+// 过半出块者投票后新出块者生效；缓存的出块者状态与完整重放一致
+func TestProofOfAuthority(t *testing.T) {
+	keys := make([]*RSAKeyPair, 4)
+	for i := range keys {
+		key, err := NewRSAKeyPair(1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	genesis := &Genesis{
+		ChainID:       "upchain-poa-test",
+		Timestamp:     devGenesisTime,
+		Consensus:     ConsensusPoA,
+		HashAlgorithm: HashSHA256,
+		PoA:           &PoAConfig{PeriodSeconds: 5, Signers: []Address{keys[0].Address(), keys[1].Address(), keys[2].Address()}},
+		Params:        DefaultConsensusParams,
+	}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(genesis.Timestamp)
+	bc.SetClock(clock)
+	replica.SetClock(clock)
+	engine := bc.Engine().(*ProofOfAuthority)
+	state := func() *poaState {
+		t.Helper()
+		s, err := engine.state(chainView{bc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	try := func(i int) (*Block, error) {
+		bc.SetSigner(keys[i])
+		bc.SetMinerAddress(keys[i].Address())
+		block, err := bc.ProduceBlock()
+		if err == nil {
+			if err := replica.AddBlock(block); err != nil {
+				t.Fatalf("副本接入区块%d失败: %v", block.Index(), err)
+			}
+		}
+		return block, err
+	}
+	indexOf := func(addr Address) int {
+		for i, key := range keys {
+			if key.Address() == addr {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// 一个间隔后只有轮值出块者能出块
+	clock.Advance(genesis.PoA.period())
+	turn := indexOf(state().sorted()[1%3])
+	for i := range keys {
+		if i == turn {
+			continue
+		}
+		if _, err := try(i); !errors.Is(err, ErrNotProposer) {
+			t.Fatalf("非轮值出块者 %d 提前出块应返回ErrNotProposer: %v", i, err)
+		}
+	}
+	first, err := try(turn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.weight.Cmp(poaInTurnWeight) != 0 {
+		t.Fatal("轮值出块的权重应为2")
+	}
+
+	// 两个间隔后，刚出过块的出块者仍不能连续出块，其他授权出块者可以代出
+	clock.Advance(2 * genesis.PoA.period())
+	if _, err := try(turn); !errors.Is(err, ErrNotProposer) || !strings.Contains(err.Error(), "最近") {
+		t.Fatalf("近期出过块的出块者应被拒绝: %v", err)
+	}
+	if _, err := try(3); !errors.Is(err, ErrNotProposer) {
+		t.Fatalf("未授权地址出块应返回ErrNotProposer: %v", err)
+	}
+	var second *Block
+	for i := 0; i < 3 && second == nil; i++ {
+		if i != turn {
+			if second, err = try(i); err != nil && !errors.Is(err, ErrNotProposer) {
+				t.Fatal(err)
+			}
+		}
+	}
+	if second == nil {
+		t.Fatal("其他授权出块者应能代出")
+	}
+
+	// 把区块换成近期出过块的出块者或未授权地址签名，副本拒绝
+	if _, err := replica.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{turn, 3} {
+		header := second.Header()
+		header.Vote = nil
+		if err := engine.Seal(first.Header(), &header, keys[i]); err != nil {
+			t.Fatal(err)
+		}
+		header.Hash = header.calculateHash()
+		if err := replica.AddBlock(newBlockFromHeader(header, second.Transactions())); !errors.Is(err, ErrNotProposer) {
+			t.Fatalf("出块者 %d 签名的区块应被拒绝: %v", i, err)
+		}
+	}
+	if err := replica.AddBlock(second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过半（3个中的2个）出块者投票授权后，新出块者生效
+	engine.Propose(keys[3].Address(), true)
+	votes := 0
+	for !state().signers[keys[3].Address()] {
+		if votes++; votes > 2 {
+			t.Fatal("两个出块者投票后应授权新的出块者")
+		}
+		clock.Advance(2 * genesis.PoA.period())
+		var block *Block
+		for i := 0; i < 3 && block == nil; i++ {
+			if block, err = try(i); err != nil && !errors.Is(err, ErrNotProposer) {
+				t.Fatal(err)
+			}
+		}
+		if block == nil || block.Vote() == nil || block.Vote().Address != keys[3].Address() {
+			t.Fatal("出块时应写入授权投票")
+		}
+	}
+	if votes != 2 || state().signLimit() != 3 {
+		t.Fatalf("应在第2票时生效，实际%d票", votes)
+	}
+	clock.Advance(2 * genesis.PoA.period())
+	if _, err := try(3); err != nil {
+		t.Fatalf("新授权的出块者应能出块: %v", err)
+	}
+
+	for _, chain := range []*Blockchain{bc, replica} {
+		e := chain.Engine().(*ProofOfAuthority)
+		cached, err := e.state(chainView{chain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed, err := e.replay(chainView{chain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cached, replayed) {
+			t.Fatal("缓存的出块者状态应与完整重放一致")
+		}
+	}
+}
+
+// TestProofOfWorkSeal 工作量证明区块默认须由出块者签名，proof绑定出块者：
+// 去掉签名或换成其他密钥重新签名的区块都被拒绝
+func TestProofOfWorkSeal(t *testing.T) {
+	miner, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	thief, err := NewEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewDevBlockchain(2)
+	bc.SetSigner(miner)
+	bc.SetMinerAddress(miner.Address())
+	block := bc.MineBlock()
+	if producer, ok := block.Producer(); !ok || producer != miner.Address() {
+		t.Fatal("区块应由设置的签名密钥签名")
+	}
+	pow := bc.Engine().(*ProofOfWork)
+	parent := bc.chain[0].Header()
+
+	stripped := block.Header()
+	stripped.Seal = nil
+	stripped.Hash = stripped.calculateHash()
+	resigned := block.Header()
+	if err := signHeader(bc.ChainID(), &resigned, thief); err != nil {
+		t.Fatal(err)
+	}
+	resigned.Hash = resigned.calculateHash()
+	for name, header := range map[string]BlockHeader{"去掉签名": stripped, "重新签名": resigned} {
+		if err := pow.verifyHeader(parent, header); err == nil {
+			t.Errorf("%s的区块头应被拒绝", name)
+		}
+		replica := NewDevBlockchain(2)
+		if err := replica.AddBlock(newBlockFromHeader(header, block.Transactions())); err == nil {
+			t.Errorf("%s的区块应被拒绝", name)
+		}
+		if err := replica.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重新签名的区块头proof对新出块者无效，即使本链允许未签名区块，去掉签名也不能通过
+	if pow.verifyHeader(parent, resigned) == nil || !strings.Contains(pow.verifyHeader(parent, resigned).Error(), "工作量证明") {
+		t.Fatalf("重新签名后应因工作量证明无效被拒绝: %v", pow.verifyHeader(parent, resigned))
+	}
+	lenient := &ProofOfWork{ChainID: pow.ChainID, Difficulty: pow.Difficulty, Algorithm: pow.Algorithm}
+	if err := lenient.verifyHeader(parent, stripped); err == nil {
+		t.Error("去掉签名的区块头proof应失效")
+	}
+
+	genesis := DevGenesis(2)
+	genesis.Params.AllowUnsignedBlocks = true
+	unsigned, err := NewBlockchain(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned.SetSigner(nil)
+	block = unsigned.MineBlock()
+	if block == nil || len(block.Seal()) != 0 {
+		t.Fatal("允许未签名区块时应能不签名出块")
+	}
+	if _, ok := block.Producer(); ok {
+		t.Error("未签名区块没有出块者")
+	}
+	if _, err := NewDevBlockchain(2).ProduceBlock(); err != nil {
+		t.Fatalf("默认配置下未设置签名密钥也应能用临时密钥出块: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ------------------------------
+// 区块大小限制：区块的字节数、交易数（含挖矿奖励交易）与gas合计不得超过上限，
+// 属于共识规则，超限的区块会被拒绝
+// ------------------------------
+
+// BlockLimits 区块大小上限
+type BlockLimits struct {
+	MaxBytes        int    // 区块头与全部交易序列化后的字节数上限
+	MaxTransactions int    // 交易数上限，含挖矿奖励交易
+	MaxGas          uint64 // 交易gas合计上限，0表示不限制
+}
+
+// DefaultBlockLimits 默认区块大小上限
+var DefaultBlockLimits = BlockLimits{
+	MaxBytes:        1 << 20,
+	MaxTransactions: 1000,
+}
+
+// Size 区块序列化后的字节数：区块头 + 全部交易。
+// 提交证书在区块通过校验后才附上，不计入大小
+func (b *Block) Size() int {
+	header := b.Header()
+	header.Commit = nil
+	size := headerSize(header)
+	for _, tx := range b.transactions {
+		size += tx.Size()
+	}
+	return size
+}
+
+func headerSize(h BlockHeader) int {
+	data, err := json.Marshal(h)
+	if err != nil {
+		panic(err)
+	}
+	return len(data)
+}
+
+// maxHeaderSize 区块头可能的最大字节数，打包交易前预留
+var maxHeaderSize = headerSize(BlockHeader{
+	Index:        math.MaxInt,
+	Timestamp:    math.MaxInt64,
+	MerkleRoot:   emptyMerkleRoot,
+	Proof:        math.MaxInt,
+	PreviousHash: emptyMerkleRoot,
+	Round:        math.MaxInt,
+	Vote:         &SignerVote{Address: Address{version: AddressVersionScriptHash}, Authorize: true},
+	Seal:         make([]byte, maxSealSize),
+	BaseFee:      MaxAmount,
+	GasUsed:      math.MaxUint64,
+	Hash:         emptyMerkleRoot,
+})
+
+// check 检查区块是否超出上限
+func (l BlockLimits) check(block *Block) error {
+	if n := len(block.Transactions()); n > l.MaxTransactions {
+		return fmt.Errorf("区块交易数%d超过上限%d", n, l.MaxTransactions)
+	}
+	if size := block.Size(); size > l.MaxBytes {
+		return fmt.Errorf("区块大小%d字节超过上限%d字节", size, l.MaxBytes)
+	}
+	if gas := block.GasUsed(); gas > l.maxGas() {
+		return fmt.Errorf("区块gas合计%d超过上限%d", gas, l.maxGas())
+	}
+	return nil
+}
+
+// maxGas gas合计上限，未设置时不限制
+func (l BlockLimits) maxGas() uint64 {
+	if l.MaxGas == 0 {
+		return math.MaxUint64
+	}
+	return l.MaxGas
+}
+
+// SetBlockLimits 设置区块大小上限；同一网络的节点必须使用相同的上限
+func (bc *Blockchain) SetBlockLimits(limits BlockLimits) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.limits = limits
+}
+
+// BlockLimits 返回区块大小上限
+func (bc *Blockchain) BlockLimits() BlockLimits {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.limits
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ------------------------------
+// 时钟与区块时间戳规则：区块链、矿工和交易池都通过Clock取当前时间，测试可注入FakeClock。
+// 区块时间戳必须大于最近11个区块时间戳的中位数（过去中位时间），且不能超出本地时间太多
+// ------------------------------
+
+// Clock 时间来源
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 系统时钟
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FakeClock 手动推进的时钟，供测试使用，可并发使用
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock 创建停在指定时间的时钟
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now 返回当前设定的时间
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance 将时钟向前推进d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set 将时钟设为指定时间
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// 区块时间戳规则
+const (
+	MedianTimeBlocks   = 11            // 计算过去中位时间的区块数
+	MaxFutureBlockTime = 2 * time.Hour // 区块时间戳最多领先本地时间的时长
+)
+
+// SetClock 替换时间来源（区块链与其交易池），应在出块和接收交易之前设置
+func (bc *Blockchain) SetClock(clock Clock) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.clock = clock
+	bc.mempool.SetClock(clock)
+}
+
+// MedianTimePast 最近11个区块（不足时取全部）时间戳的中位数，新区块的时间戳必须大于它
+func (bc *Blockchain) MedianTimePast() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.medianTimePast()
+}
+
+func (bc *Blockchain) medianTimePast() int64 {
+	start := len(bc.chain) - MedianTimeBlocks
+	if start < 0 {
+		start = 0
+	}
+	timestamps := make([]int64, 0, MedianTimeBlocks)
+	for _, block := range bc.chain[start:] {
+		timestamps = append(timestamps, block.Timestamp())
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// nextBlockTime 新区块使用的时间戳：本地时间，但至少比过去中位时间大1纳秒
+func (bc *Blockchain) nextBlockTime() int64 {
+	now := bc.clock.Now().UnixNano()
+	if mtp := bc.medianTimePast(); now <= mtp {
+		return mtp + 1
+	}
+	return now
+}
+
+// checkBlockTime 检查区块时间戳是否符合规则，调用方需持有锁
+func (bc *Blockchain) checkBlockTime(block *Block) error {
+	if mtp := bc.medianTimePast(); block.Timestamp() <= mtp {
+		return fmt.Errorf("区块时间戳%d不大于过去中位时间%d", block.Timestamp(), mtp)
+	}
+	limit := bc.clock.Now().Add(MaxFutureBlockTime).UnixNano()
+	if block.Timestamp() > limit {
+		return fmt.Errorf("区块时间戳%d超出本地时间%s以上", block.Timestamp(), MaxFutureBlockTime)
+	}
+	return nil
+}
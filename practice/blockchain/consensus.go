@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// ------------------------------
+// 共识引擎：出块时填写区块头并封装（工作量证明或签名），接收区块时校验封装，
+// 并给出分叉选择的权重。工作量证明、权益证明、权威证明与拜占庭容错共识由创世配置选择
+// ------------------------------
+
+// ConsensusEngine 可插拔的共识规则
+type ConsensusEngine interface {
+	// Name 共识名称，与创世配置中的consensus字段一致
+	Name() string
+	// Prepare 填写待出块区块头中由共识决定的字段；本节点此时无权出块时返回错误
+	Prepare(chain ChainReader, header *BlockHeader, signer KeyPair) error
+	// Seal 完成区块头的封装，调用时不持有链锁，可能耗时较长
+	Seal(parent BlockHeader, header *BlockHeader, signer KeyPair) error
+	// VerifySeal 校验区块头的封装能否接在链尾
+	VerifySeal(chain ChainReader, header BlockHeader) error
+	// Weight 区块的分叉选择权重（以链尾为父区块计算），总权重大的链为主链
+	Weight(chain ChainReader, header BlockHeader) *big.Int
+}
+
+// FinalityEngine 具有最终性的共识：区块须附带提交证书才能接入，接入后永不回滚
+type FinalityEngine interface {
+	ConsensusEngine
+	// VerifyCommit 校验区块头附带的提交证书
+	VerifyCommit(chain ChainReader, header BlockHeader) error
+}
+
+// ErrFinalized 试图回滚已最终确定的区块
+var ErrFinalized = errors.New("区块已最终确定")
+
+// 共识名称
+const (
+	ConsensusPoW = "pow"
+	ConsensusPoS = "pos"
+	ConsensusPoA = "poa"
+	ConsensusBFT = "bft"
+)
+
+// ChainReader 共识引擎读取链状态的接口，由持有链锁的调用方提供
+type ChainReader interface {
+	ChainID() string
+	// Tip 当前链尾的区块头，即待校验区块的父区块
+	Tip() BlockHeader
+	HeaderByHeight(height int) (BlockHeader, bool)
+	// Validators 链尾状态下质押不低于minStake且未被惩罚的验证者
+	Validators(minStake Amount) []Validator
+	// StakeOf 链尾状态下地址的质押金额
+	StakeOf(addr Address) Amount
+	Now() time.Time
+}
+
+// chainView 在已持有链锁时读取链状态
+type chainView struct {
+	bc *Blockchain
+}
+
+func (v chainView) ChainID() string  { return v.bc.chainID }
+func (v chainView) Tip() BlockHeader { return v.bc.lastBlock().Header() }
+func (v chainView) Now() time.Time   { return v.bc.clock.Now() }
+
+func (v chainView) HeaderByHeight(height int) (BlockHeader, bool) {
+	if height < 0 || height >= len(v.bc.chain) {
+		return BlockHeader{}, false
+	}
+	return v.bc.chain[height].Header(), true
+}
+
+func (v chainView) Validators(minStake Amount) []Validator {
+	return v.bc.tipStakes().validators(minStake)
+}
+
+func (v chainView) StakeOf(addr Address) Amount {
+	return v.bc.tipStakes()[addr].stake
+}
+
+// newConsensusEngine 按创世配置创建共识引擎
+func newConsensusEngine(genesis *Genesis) (ConsensusEngine, error) {
+	switch genesis.consensus() {
+	case ConsensusPoW:
+		return newProofOfWork(genesis), nil
+	case ConsensusPoS:
+		return NewProofOfStake(genesis.ChainID, *genesis.PoS), nil
+	case ConsensusPoA:
+		return NewProofOfAuthority(genesis.ChainID, *genesis.PoA), nil
+	case ConsensusBFT:
+		return NewBFTEngine(genesis.ChainID, *genesis.BFT), nil
+	}
+	return nil, fmt.Errorf("不支持的共识: %q", genesis.Consensus)
+}
+
+// Engine 返回共识引擎（创建后不变，无需加锁）
+func (bc *Blockchain) Engine() ConsensusEngine {
+	return bc.engine
+}
+
+// SetSigner 设置本节点出块时签名区块头的密钥（RSAKeyPair或其他KeyPair）。
+// 权益证明、权威证明必须设置；工作量证明默认使用创建区块链时临时生成的密钥，
+// 设为nil则出块不签名（仅创世配置允许未签名区块时有效）
+func (bc *Blockchain) SetSigner(signer KeyPair) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.signer = signer
+}
+
+// ------------------------------
+// 工作量证明
+// ------------------------------
+
+// ProofOfWork 工作量证明：父区块proof、proof与出块者地址拼接后的哈希须有Difficulty个前导零，
+// 找到proof后出块者再签名区块头。RequireSignature为false时允许未签名的区块，其出块者地址视为空
+type ProofOfWork struct {
+	ChainID          string
+	Difficulty       int
+	Algorithm        HashAlgorithm
+	RequireSignature bool
+}
+
+// newProofOfWork 按创世配置创建工作量证明共识
+func newProofOfWork(genesis *Genesis) *ProofOfWork {
+	return &ProofOfWork{
+		ChainID:          genesis.ChainID,
+		Difficulty:       genesis.Difficulty,
+		Algorithm:        genesis.HashAlgorithm,
+		RequireSignature: !genesis.Params.AllowUnsignedBlocks,
+	}
+}
+
+// Name 共识名称
+func (e *ProofOfWork) Name() string { return ConsensusPoW }
+
+// Prepare 工作量证明任何节点都可出块，无需填写额外字段
+func (e *ProofOfWork) Prepare(chain ChainReader, header *BlockHeader, signer KeyPair) error {
+	return nil
+}
+
+// Seal 从0开始搜索满足难度的proof，设置了签名密钥时再签名区块头（签名覆盖proof）
+func (e *ProofOfWork) Seal(parent BlockHeader, header *BlockHeader, signer KeyPair) error {
+	if signer == nil && e.RequireSignature {
+		return errors.New("本链要求出块者签名，需先设置签名密钥")
+	}
+	var producer Address
+	if signer != nil {
+		producer = signer.Address()
+	}
+	proof := 0
+	for !isValidProof(parent.Proof, proof, producer, e.Difficulty, e.Algorithm) {
+		proof++
+	}
+	header.Proof = proof
+	if signer == nil {
+		return nil
+	}
+	return signHeader(e.ChainID, header, signer)
+}
+
+// VerifySeal 校验出块者签名，以及proof对该出块者满足难度
+func (e *ProofOfWork) VerifySeal(chain ChainReader, header BlockHeader) error {
+	parent, ok := chain.HeaderByHeight(header.Index - 1)
+	if !ok {
+		return errors.New("父区块不存在")
+	}
+	return e.verifyHeader(parent, header)
+}
+
+// verifyHeader 只凭父区块头校验，轻节点与快照引导也用它校验区块头链
+func (e *ProofOfWork) verifyHeader(parent, header BlockHeader) error {
+	var producer Address
+	if len(header.Seal) > 0 || e.RequireSignature {
+		var err error
+		if producer, err = verifySignerSeal(e.ChainID, header); err != nil {
+			return err
+		}
+	}
+	if !isValidProof(parent.Proof, header.Proof, producer, e.Difficulty, e.Algorithm) {
+		return errors.New("工作量证明无效")
+	}
+	return nil
+}
+
+// Weight 区块代表的期望哈希次数：16^难度
+func (e *ProofOfWork) Weight(chain ChainReader, header BlockHeader) *big.Int {
+	return new(big.Int).Exp(big.NewInt(16), big.NewInt(int64(e.Difficulty)), nil)
+}
+
+// ------------------------------
+// 出块者签名：权益证明与权威证明的封装数据为出块者公钥与其对区块头的签名
+// ------------------------------
+
+// maxSealSize 区块头封装数据的上限，足够容纳4096位RSA公钥与签名
+const maxSealSize = 2048
+
+// signerSeal 出块者签名的封装数据
+type signerSeal struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// sealSigningBytes 出块者签名的内容：链ID与不含封装数据的区块头哈希，使区块头不能在其他链上冒用
+func sealSigningBytes(chainID string, header BlockHeader) []byte {
+	return []byte(chainID + ":" + header.sealHash())
+}
+
+// signHeader 用出块者密钥签名区块头，写入封装数据
+func signHeader(chainID string, header *BlockHeader, signer KeyPair) error {
+	signature, err := signer.Sign(sealSigningBytes(chainID, *header))
+	if err != nil {
+		return err
+	}
+	header.Seal, err = json.Marshal(signerSeal{PublicKey: signer.PublicKeyBytes(), Signature: signature})
+	return err
+}
+
+func decodeSignerSeal(header BlockHeader) (signerSeal, error) {
+	var seal signerSeal
+	if err := json.Unmarshal(header.Seal, &seal); err != nil || len(seal.PublicKey) == 0 {
+		return signerSeal{}, errors.New("区块头缺少出块者签名")
+	}
+	return seal, nil
+}
+
+// sealSigner 封装数据中的出块者地址（不校验签名，用于已上链的区块头）
+func sealSigner(header BlockHeader) (Address, error) {
+	seal, err := decodeSignerSeal(header)
+	if err != nil {
+		return Address{}, err
+	}
+	return NewAddressFromPublicKey(seal.PublicKey), nil
+}
+
+// verifySignerSeal 校验区块头签名，返回出块者地址
+func verifySignerSeal(chainID string, header BlockHeader) (Address, error) {
+	seal, err := decodeSignerSeal(header)
+	if err != nil {
+		return Address{}, err
+	}
+	if err := VerifySignature(seal.PublicKey, sealSigningBytes(chainID, header), seal.Signature); err != nil {
+		return Address{}, fmt.Errorf("出块者签名无效: %w", err)
+	}
+	return NewAddressFromPublicKey(seal.PublicKey), nil
+}
+
+// Producer 区块头签名者即出块者，未签名的工作量证明区块返回false
+func (h BlockHeader) Producer() (Address, bool) {
+	producer, err := sealSigner(h)
+	return producer, err == nil
+}
+
+// Producer 区块的出块者
+func (b *Block) Producer() (Address, bool) {
+	return b.Header().Producer()
+}
+
+// ------------------------------
+// 出块者统计：按区块头签名把区块与奖励归属到出块者
+// ------------------------------
+
+// ProducerStats 出块者的出块数与奖励
+type ProducerStats struct {
+	Producer    Address
+	Blocks      int
+	Rewards     Amount // 所出区块的挖矿奖励交易金额合计（含小费），不含区块体已裁剪的区块
+	FirstHeight int
+	LastHeight  int
+}
+
+// ProducerStats 按出块者汇总链上区块，按出块数从多到少排序；未签名的区块不计入
+func (bc *Blockchain) ProducerStats() []ProducerStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	byProducer := make(map[Address]*ProducerStats)
+	for _, block := range bc.chain[1:] {
+		producer, ok := block.Producer()
+		if !ok {
+			continue
+		}
+		stats := byProducer[producer]
+		if stats == nil {
+			stats = &ProducerStats{Producer: producer, FirstHeight: block.Index()}
+			byProducer[producer] = stats
+		}
+		stats.Blocks++
+		stats.LastHeight = block.Index()
+		if txs := block.Transactions(); len(txs) > 0 && txs[0].IsCoinbase() {
+			// 已确认区块的奖励不超过金额上限，累加溢出时保留已有结果
+			if rewards, err := stats.Rewards.Add(txs[0].Amount()); err == nil {
+				stats.Rewards = rewards
+			}
+		}
+	}
+	list := make([]ProducerStats, 0, len(byProducer))
+	for _, stats := range byProducer {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Blocks != list[j].Blocks {
+			return list[i].Blocks > list[j].Blocks
+		}
+		return list[i].Producer.String() < list[j].Producer.String()
+	})
+	return list
+}
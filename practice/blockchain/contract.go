@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ------------------------------
+// 合约交易：部署交易把代码存到由发送方与序号派生的合约地址，调用交易以发送方身份执行合约；
+// 合约账户分为合约虚拟机合约与EVM合约，调用交易按账户类型分派。
+// 合约状态与质押一样由基准快照加其后的区块计算，链尾状态随区块接入增量更新；
+// 执行失败（含gas耗尽）只回滚合约存储，交易仍然上链，序号与手续费照常消耗
+// ------------------------------
+
+// DefaultGasLimit 钱包构造合约交易时的默认gas上限
+const DefaultGasLimit = 200_000
+
+// ContractAddress 合约地址：对部署者地址与部署交易序号做哈希，同一发送方每次部署的地址都不同
+func ContractAddress(deployer Address, nonce uint64) Address {
+	data := append([]byte(deployer.String()), binary.BigEndian.AppendUint64(nil, nonce)...)
+	return Address{version: AddressVersionContract, hash: hashPublicKey(data)}
+}
+
+// isContractTx 是否为部署或调用合约的交易
+func (t *Transaction) isContractTx() bool {
+	return t.kind == TxDeploy || t.kind == TxInvoke || t.kind == TxDeployEVM
+}
+
+// intrinsicGas 执行前按交易本身收取的gas：固定开销、数据字节与部署代码的存储开销
+// （EVM合约的存储开销按初始化代码返回的运行时代码在执行时收取）
+func (t *Transaction) intrinsicGas() uint64 {
+	gas := uint64(gasTxContract) + uint64(len(t.data))*gasTxDataByte
+	if t.kind == TxDeploy {
+		gas += uint64(len(t.data)) * gasDeployByte
+	}
+	return gas
+}
+
+// checkContract 检查合约交易的收款方、数据与gas上限
+func (t *Transaction) checkContract() error {
+	if t.amount != 0 {
+		return errors.New("合约交易的金额必须为0，合约不持有余额")
+	}
+	if t.gasLimit == 0 || t.gasLimit > MaxTxGas {
+		return fmt.Errorf("gas上限须在1到%d之间", MaxTxGas)
+	}
+	if gas := t.intrinsicGas(); gas > t.gasLimit {
+		return fmt.Errorf("gas上限%d低于交易的固定开销%d", t.gasLimit, gas)
+	}
+	switch t.kind {
+	case TxDeploy, TxDeployEVM:
+		if t.recipient != ContractAddress(t.sender, t.nonce) {
+			return errors.New("部署交易的收款方必须是由发送方与序号派生的合约地址")
+		}
+		if len(t.data) == 0 {
+			return errors.New("部署交易缺少合约代码")
+		}
+		if t.kind == TxDeployEVM {
+			if len(t.data) > MaxEVMInitCode {
+				return fmt.Errorf("初始化代码过长: %d字节", len(t.data))
+			}
+		} else if _, err := VMCode(t.data).parse(); err != nil {
+			return fmt.Errorf("合约代码无效: %w", err)
+		}
+	case TxInvoke:
+		// 调用数据的格式取决于合约类型，执行时再解析
+		if !t.recipient.IsContract() {
+			return errors.New("调用交易的收款方必须是合约地址")
+		}
+	}
+	return nil
+}
+
+// addContractFields 合约交易的数据与gas上限参与签名和序列化
+func (t *Transaction) addContractFields(m map[string]interface{}) {
+	if len(t.data) > 0 {
+		m["data"] = hex.EncodeToString(t.data)
+	}
+	if t.gasLimit != 0 {
+		m["gas_limit"] = t.gasLimit
+	}
+}
+
+// WithGasLimit 指定合约交易的gas上限
+func WithGasLimit(gas uint64) TxOption {
+	return func(t *Transaction) { t.gasLimit = gas }
+}
+
+// ------------------------------
+// 合约状态
+// ------------------------------
+
+// contractAccount 合约账户：代码与键值存储
+type contractAccount struct {
+	code    VMCode // EVM合约为运行时字节码
+	storage map[string][]byte
+	evm     bool
+}
+
+// contractState 各地址的合约账户
+type contractState map[Address]*contractAccount
+
+func (s contractState) clone() contractState {
+	c := make(contractState, len(s))
+	for addr, contract := range s {
+		storage := make(map[string][]byte, len(contract.storage))
+		for k, v := range contract.storage {
+			storage[k] = v
+		}
+		c[addr] = &contractAccount{code: contract.code, storage: storage, evm: contract.evm}
+	}
+	return c
+}
+
+// Receipt 合约交易的执行结果
+type Receipt struct {
+	TxID       string  `json:"tx_id"`
+	BlockIndex int     `json:"block_index"`
+	Contract   Address `json:"contract"`
+	Success    bool    `json:"success"`
+	GasUsed    uint64  `json:"gas_used"`
+	ReturnData []byte  `json:"return_data,omitempty"` // EVM合约回滚时为REVERT的数据
+	Error      string  `json:"error,omitempty"`
+	Logs       []Log   `json:"logs,omitempty"`
+}
+
+// apply 执行合约交易并更新状态，非合约交易返回nil。
+// 执行结果只取决于交易与之前的状态，重放区块总能得到相同的状态和回执
+func (s contractState) apply(tx *Transaction, block *Block) *Receipt {
+	if !tx.isContractTx() {
+		return nil
+	}
+	receipt := &Receipt{TxID: tx.ID(), BlockIndex: block.Index(), Contract: tx.Recipient()}
+	ctx := VMContext{Origin: tx.Sender(), BlockHeight: block.Index(), BlockTime: block.Timestamp()}
+	// 区块中的交易已经过checkContract，gas上限不低于固定开销
+	vm := newVM(s, ctx, tx.GasLimit()-tx.intrinsicGas())
+	var err error
+	switch tx.Kind() {
+	case TxDeploy:
+		err = vm.create(tx.Recipient(), tx.Data())
+	case TxDeployEVM:
+		err = vm.createEVM(tx.Recipient(), tx.Data())
+	default:
+		receipt.ReturnData, err = vm.invoke(tx.Sender(), tx.Recipient(), tx.Data())
+	}
+	var revert *evmRevert
+	if err != nil {
+		vm.revert(0)
+		receipt.ReturnData = nil
+		if errors.As(err, &revert) {
+			receipt.ReturnData = revert.data
+		}
+		receipt.Error = err.Error()
+	}
+	receipt.Success = err == nil
+	if receipt.Success {
+		receipt.Logs = vm.logs
+	}
+	receipt.GasUsed = tx.GasLimit() - vm.gas
+	return receipt
+}
+
+// invoke 按合约类型分派调用交易：EVM合约的数据即calldata，合约虚拟机合约的数据为编码后的参数
+func (vm *VM) invoke(caller, addr Address, data []byte) ([]byte, error) {
+	if contract, ok := vm.state[addr]; ok && contract.evm {
+		return vm.callEVM(caller, addr, data)
+	}
+	args, err := decodeVMArgs(data)
+	if err != nil {
+		return nil, err
+	}
+	return vm.call(caller, addr, args)
+}
+
+// tipContracts 链尾的合约状态，随区块接入增量更新，调用方需持有锁且不能修改返回值
+func (bc *Blockchain) tipContracts() contractState {
+	return bc.contracts
+}
+
+// connectContracts 区块接入链尾时执行其中的合约交易，调用方需持有写锁
+func (bc *Blockchain) connectContracts(block *Block) {
+	for _, tx := range block.Transactions() {
+		bc.contracts.apply(tx, block)
+	}
+}
+
+// resetContracts 回滚区块或更换基准快照后重新计算合约状态，调用方需持有写锁
+func (bc *Blockchain) resetContracts() {
+	bc.contracts = bc.contractStateAt(bc.lastBlock().Index(), nil)
+}
+
+// contractStateAt 由基准快照与其后的区块重放计算指定高度的合约状态，
+// 每笔合约交易的回执交给onReceipt（可为nil），调用方需持有锁
+func (bc *Blockchain) contractStateAt(height int, onReceipt func(*Receipt)) contractState {
+	state := make(contractState)
+	if bc.base != nil {
+		for _, snap := range bc.base.Contracts {
+			contract := &contractAccount{code: snap.Code, storage: make(map[string][]byte, len(snap.Storage)), evm: snap.EVM}
+			for _, entry := range snap.Storage {
+				contract.storage[string(entry.Key)] = entry.Value
+			}
+			state[snap.Address] = contract
+		}
+	}
+	for _, block := range bc.chain[bc.baseHeight()+1 : height+1] {
+		for _, tx := range block.Transactions() {
+			if receipt := state.apply(tx, block); receipt != nil && onReceipt != nil {
+				onReceipt(receipt)
+			}
+		}
+	}
+	return state
+}
+
+// ContractCode 查询合约代码，地址没有合约时返回nil
+func (bc *Blockchain) ContractCode(addr Address) VMCode {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if contract, ok := bc.tipContracts()[addr]; ok {
+		return slices.Clone(contract.code)
+	}
+	return nil
+}
+
+// ContractStorage 查询合约存储中键对应的值，不存在时返回nil
+func (bc *Blockchain) ContractStorage(addr Address, key []byte) []byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if contract, ok := bc.tipContracts()[addr]; ok {
+		return slices.Clone(contract.storage[string(key)])
+	}
+	return nil
+}
+
+// Receipt 查询已上链合约交易的执行回执；交易位于已裁剪的区块中时返回ErrPruned
+func (bc *Blockchain) Receipt(txid string) (*Receipt, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	loc, ok := bc.index.txs[txid]
+	if !ok {
+		if bc.prunedHeight >= 0 {
+			return nil, fmt.Errorf("%w: 高度%d之后的区块中没有交易 %s", ErrPruned, bc.prunedHeight, txid)
+		}
+		return nil, ErrTxNotFound
+	}
+	if !loc.Transaction.isContractTx() {
+		return nil, fmt.Errorf("交易 %s 不是合约交易", txid)
+	}
+	var found *Receipt
+	bc.contractStateAt(loc.Block.Index(), func(r *Receipt) {
+		if r.TxID == txid {
+			found = r
+		}
+	})
+	return found, nil
+}
+
+// CallContract 在最新状态上只读地调用合约虚拟机合约，修改不会保存，用于查询合约数据
+func (bc *Blockchain) CallContract(caller, addr Address, gas uint64, args ...[]byte) ([]byte, error) {
+	return bc.callReadOnly(caller, addr, gas, EncodeVMArgs(args...))
+}
+
+// CallEVM 在最新状态上只读地以calldata调用EVM合约（类似eth_call）
+func (bc *Blockchain) CallEVM(caller, addr Address, gas uint64, calldata []byte) ([]byte, error) {
+	return bc.callReadOnly(caller, addr, gas, calldata)
+}
+
+func (bc *Blockchain) callReadOnly(caller, addr Address, gas uint64, data []byte) ([]byte, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	last := bc.lastBlock()
+	state := bc.tipContracts().clone()
+	ctx := VMContext{Origin: caller, BlockHeight: last.Index(), BlockTime: last.Timestamp()}
+	return newVM(state, ctx, gas).invoke(caller, addr, data)
+}
+
+// ------------------------------
+// 快照中的合约状态
+// ------------------------------
+
+// StorageEntry 合约存储中的一项
+type StorageEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// ContractSnapshot 合约在快照高度的代码与存储
+type ContractSnapshot struct {
+	Address Address        `json:"address"`
+	Code    VMCode         `json:"code"`
+	Storage []StorageEntry `json:"storage,omitempty"` // 按键排序
+	EVM     bool           `json:"evm,omitempty"`
+}
+
+// snapshot 按地址排序导出全部合约
+func (s contractState) snapshot() []ContractSnapshot {
+	var list []ContractSnapshot
+	for addr, contract := range s {
+		snap := ContractSnapshot{Address: addr, Code: contract.code, EVM: contract.evm}
+		for k, v := range contract.storage {
+			snap.Storage = append(snap.Storage, StorageEntry{Key: []byte(k), Value: v})
+		}
+		sort.Slice(snap.Storage, func(i, j int) bool { return string(snap.Storage[i].Key) < string(snap.Storage[j].Key) })
+		list = append(list, snap)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address.String() < list[j].Address.String() })
+	return list
+}
+
+// ------------------------------
+// 钱包：合约操作
+// ------------------------------
+
+// Deploy 部署合约，返回交易与合约地址
+func (w *Wallet) Deploy(bc *Blockchain, from Address, code VMCode, opts ...TxOption) (*Transaction, Address, error) {
+	return w.deploy(bc, from, TxDeploy, code, opts)
+}
+
+// DeployEVM 以初始化代码（solc输出的bytecode）部署EVM合约，返回交易与合约地址
+func (w *Wallet) DeployEVM(bc *Blockchain, from Address, initCode []byte, opts ...TxOption) (*Transaction, Address, error) {
+	return w.deploy(bc, from, TxDeployEVM, initCode, opts)
+}
+
+func (w *Wallet) deploy(bc *Blockchain, from Address, kind TxKind, code []byte, opts []TxOption) (*Transaction, Address, error) {
+	base := []TxOption{withKind(kind), WithGasLimit(DefaultGasLimit), withData(code)}
+	// 合约地址取决于最终的序号，在其他选项之后设置收款方
+	atContract := func(t *Transaction) {
+		t.recipient = ContractAddress(t.sender, t.nonce)
+		t.lockScript = LockScriptForAddress(t.recipient)
+	}
+	opts = append(append(base, opts...), atContract)
+	tx, err := w.Send(bc, from, ContractAddress(from, 0), 0, opts...)
+	if err != nil {
+		return nil, Address{}, err
+	}
+	return tx, tx.Recipient(), nil
+}
+
+// Invoke 以from身份调用合约
+func (w *Wallet) Invoke(bc *Blockchain, from, contract Address, args [][]byte, opts ...TxOption) (*Transaction, error) {
+	base := []TxOption{withKind(TxInvoke), WithGasLimit(DefaultGasLimit), withData(EncodeVMArgs(args...))}
+	return w.Send(bc, from, contract, 0, append(base, opts...)...)
+}
+
+// InvokeEVM 以from身份用calldata调用EVM合约
+func (w *Wallet) InvokeEVM(bc *Blockchain, from, contract Address, calldata []byte, opts ...TxOption) (*Transaction, error) {
+	base := []TxOption{withKind(TxInvoke), WithGasLimit(DefaultGasLimit), withData(calldata)}
+	return w.Send(bc, from, contract, 0, append(base, opts...)...)
+}
+
+// withData 设置合约交易的数据
+func withData(data []byte) TxOption {
+	return func(t *Transaction) { t.data = append([]byte(nil), data...) }
+}
+
+// ------------------------------
+// 演示使用：计数器合约
+// ------------------------------
+
+// counterContractSource 计数器合约：参数"inc"使调用方的计数加1，参数"get"返回调用方的计数
+const counterContractSource = `
+	ARG 0
+	PUSH "inc"
+	EQ
+	JUMPI inc
+	ARG 0
+	PUSH "get"
+	EQ
+	JUMPI get
+	PUSH "未知方法"
+	REVERT
+inc:
+	CALLER
+	DUP 0
+	SLOAD
+	PUSH 1
+	ADD
+	SSTORE
+	STOP
+get:
+	CALLER
+	SLOAD
+	RETURN
+`
+
+// runContractDemo 部署计数器合约并调用，演示存储、回执与gas耗尽回滚
+func runContractDemo() {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bc := NewDevBlockchain(2)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+
+	code, err := AssembleVM(counterContractSource)
+	if err != nil {
+		fmt.Printf("汇编失败: %v\n", err)
+		return
+	}
+	fmt.Printf("计数器合约代码:\n%s\n", code)
+	_, contract, err := wallet.Deploy(bc, alice, code)
+	if err != nil {
+		fmt.Printf("部署失败: %v\n", err)
+		return
+	}
+	bc.MineBlock()
+	fmt.Printf("合约地址: %s\n", contract)
+
+	for i := 0; i < 3; i++ {
+		if _, err := wallet.Invoke(bc, alice, contract, [][]byte{[]byte("inc")}); err != nil {
+			fmt.Printf("调用失败: %v\n", err)
+			return
+		}
+	}
+	// gas只够固定开销，执行时耗尽，计数不变但交易仍上链
+	starved, err := wallet.Invoke(bc, alice, contract, [][]byte{[]byte("inc")}, WithGasLimit(1100))
+	if err != nil {
+		fmt.Printf("调用失败: %v\n", err)
+		return
+	}
+	bc.MineBlock()
+
+	if receipt, err := bc.Receipt(starved.ID()); err == nil {
+		fmt.Printf("gas不足的调用: 成功=%v，消耗gas %d，错误: %s\n", receipt.Success, receipt.GasUsed, receipt.Error)
+	}
+	count, err := bc.CallContract(alice, contract, MaxTxGas, []byte("get"))
+	if err != nil {
+		fmt.Printf("查询失败: %v\n", err)
+		return
+	}
+	n, _ := decodeVMNum(count)
+	fmt.Printf("Alice的计数: %d\n", n)
+}
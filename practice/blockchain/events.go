@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// ------------------------------
+// 事件订阅：新的待打包交易、区块接入、区块回滚（分叉切换），可按地址过滤。
+// 投递不阻塞链操作，缓冲区写满的慢消费者会被断开
+// ------------------------------
+
+// EventType 事件类型，可按位组合用于过滤
+type EventType int
+
+const (
+	EventPendingTx         EventType = 1 << iota // 交易进入待打包列表（直接入池或从等待队列提升）
+	EventBlockConnected                          // 区块接入链尾
+	EventBlockDisconnected                       // 区块因回滚或分叉切换被移出主链
+
+	EventAll = EventPendingTx | EventBlockConnected | EventBlockDisconnected
+)
+
+// String 事件类型名称
+func (t EventType) String() string {
+	switch t {
+	case EventPendingTx:
+		return "pending_tx"
+	case EventBlockConnected:
+		return "block_connected"
+	case EventBlockDisconnected:
+		return "block_disconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 一条链事件
+type Event struct {
+	Type  EventType
+	Block *Block // 区块事件对应的区块，交易事件为nil
+	// 与过滤条件匹配的交易：交易事件为该交易本身；区块事件为区块中涉及过滤地址的交易，
+	// 未设置地址过滤时为区块全部交易
+	Transactions []*Transaction
+}
+
+// EventFilter 订阅过滤条件
+type EventFilter struct {
+	Types     EventType // 订阅的事件类型，0表示全部
+	Addresses []Address // 只接收涉及这些地址的事件，为空表示不过滤
+}
+
+// match 返回事件中与过滤条件匹配的交易，ok=false表示不投递
+func (f EventFilter) match(eventType EventType, txs []*Transaction) (matched []*Transaction, ok bool) {
+	if f.Types != 0 && f.Types&eventType == 0 {
+		return nil, false
+	}
+	if len(f.Addresses) == 0 {
+		return txs, true
+	}
+	for _, tx := range txs {
+		for _, addr := range f.Addresses {
+			if tx.Recipient() == addr || (!tx.IsCoinbase() && tx.Sender() == addr) {
+				matched = append(matched, tx)
+				break
+			}
+		}
+	}
+	return matched, len(matched) > 0
+}
+
+// EventBufferSize 每个订阅的事件缓冲区大小
+const EventBufferSize = 256
+
+// ErrSlowConsumer 订阅者未及时读取事件，缓冲区写满后被断开
+var ErrSlowConsumer = errors.New("事件消费过慢，订阅已断开")
+
+// Subscription 一个事件订阅
+type Subscription struct {
+	bus    *eventBus
+	filter EventFilter
+	events chan Event
+	err    error // err与closed由eventBus的锁保护
+	closed bool
+}
+
+// Events 事件通道，订阅结束（取消或被断开）后关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err 订阅被断开的原因，正常取消或仍在订阅时为nil
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+// Unsubscribe 取消订阅并关闭事件通道，可重复调用
+func (s *Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s, nil)
+}
+
+// eventBus 订阅者列表与事件分发
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+	// 分叉切换期间暂存的事件，切换成功后按顺序投递，失败时丢弃
+	holding bool
+	held    []Event
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// remove 移除订阅并关闭通道，调用方需持有锁
+func (b *eventBus) remove(s *Subscription, err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	delete(b.subs, s)
+	close(s.events)
+}
+
+// publish 向匹配的订阅者投递事件，不阻塞；缓冲区已满的订阅者被断开
+func (b *eventBus) publish(eventType EventType, block *Block, txs []*Transaction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.holding {
+		b.held = append(b.held, Event{Type: eventType, Block: block, Transactions: txs})
+		return
+	}
+	b.deliver(eventType, block, txs)
+}
+
+// hold 开始暂存事件，直到release
+func (b *eventBus) hold() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.holding = true
+}
+
+// release 结束暂存：commit为true时投递暂存的事件，否则丢弃
+func (b *eventBus) release(commit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	held := b.held
+	b.holding, b.held = false, nil
+	if !commit {
+		return
+	}
+	for _, e := range held {
+		b.deliver(e.Type, e.Block, e.Transactions)
+	}
+}
+
+// deliver 投递一条事件，调用方需持有锁
+func (b *eventBus) deliver(eventType EventType, block *Block, txs []*Transaction) {
+	for s := range b.subs {
+		matched, ok := s.filter.match(eventType, txs)
+		if !ok {
+			continue
+		}
+		select {
+		case s.events <- Event{Type: eventType, Block: block, Transactions: matched}:
+		default:
+			b.remove(s, ErrSlowConsumer)
+		}
+	}
+}
+
+// Subscribe 订阅满足过滤条件的链事件，通过Events()读取
+func (bc *Blockchain) Subscribe(filter EventFilter) *Subscription {
+	s := &Subscription{
+		bus:    bc.events,
+		filter: filter,
+		events: make(chan Event, EventBufferSize),
+	}
+	bc.events.mu.Lock()
+	defer bc.events.mu.Unlock()
+	bc.events.subs[s] = struct{}{}
+	return s
+}
+
+// SubscribeFunc 以回调方式订阅，回调在独立的goroutine中按顺序执行；
+// 回调过慢同样会导致订阅被断开
+func (bc *Blockchain) SubscribeFunc(filter EventFilter, fn func(Event)) *Subscription {
+	s := bc.Subscribe(filter)
+	go func() {
+		for event := range s.Events() {
+			fn(event)
+		}
+	}()
+	return s
+}
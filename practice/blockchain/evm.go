@@ -0,0 +1,725 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ------------------------------
+// EVM字节码解释器：支持算术、比较与位运算、栈与内存、SLOAD/SSTORE、CALLDATA*、
+// CODECOPY、RETURN/REVERT、LOG0-4以及带JUMPDEST分析的JUMP/JUMPI，足以运行solc编译的简单合约。
+// 不支持KECCAK256、合约间调用与转账，遇到不支持的操作码时执行失败。
+// EVM合约与合约虚拟机合约共用合约账户、gas与修改记录，存储键值均为32字节
+// ------------------------------
+
+// EVMOp EVM操作码
+type EVMOp byte
+
+// 支持的EVM操作码
+const (
+	EVM_STOP       EVMOp = 0x00
+	EVM_ADD        EVMOp = 0x01
+	EVM_MUL        EVMOp = 0x02
+	EVM_SUB        EVMOp = 0x03
+	EVM_DIV        EVMOp = 0x04
+	EVM_SDIV       EVMOp = 0x05
+	EVM_MOD        EVMOp = 0x06
+	EVM_SMOD       EVMOp = 0x07
+	EVM_ADDMOD     EVMOp = 0x08
+	EVM_MULMOD     EVMOp = 0x09
+	EVM_EXP        EVMOp = 0x0a
+	EVM_SIGNEXTEND EVMOp = 0x0b
+
+	EVM_LT     EVMOp = 0x10
+	EVM_GT     EVMOp = 0x11
+	EVM_SLT    EVMOp = 0x12
+	EVM_SGT    EVMOp = 0x13
+	EVM_EQ     EVMOp = 0x14
+	EVM_ISZERO EVMOp = 0x15
+	EVM_AND    EVMOp = 0x16
+	EVM_OR     EVMOp = 0x17
+	EVM_XOR    EVMOp = 0x18
+	EVM_NOT    EVMOp = 0x19
+	EVM_BYTE   EVMOp = 0x1a
+	EVM_SHL    EVMOp = 0x1b
+	EVM_SHR    EVMOp = 0x1c
+	EVM_SAR    EVMOp = 0x1d
+
+	EVM_ADDRESS      EVMOp = 0x30
+	EVM_ORIGIN       EVMOp = 0x32
+	EVM_CALLER       EVMOp = 0x33
+	EVM_CALLVALUE    EVMOp = 0x34
+	EVM_CALLDATALOAD EVMOp = 0x35
+	EVM_CALLDATASIZE EVMOp = 0x36
+	EVM_CALLDATACOPY EVMOp = 0x37
+	EVM_CODESIZE     EVMOp = 0x38
+	EVM_CODECOPY     EVMOp = 0x39
+
+	EVM_TIMESTAMP EVMOp = 0x42
+	EVM_NUMBER    EVMOp = 0x43
+
+	EVM_POP      EVMOp = 0x50
+	EVM_MLOAD    EVMOp = 0x51
+	EVM_MSTORE   EVMOp = 0x52
+	EVM_MSTORE8  EVMOp = 0x53
+	EVM_SLOAD    EVMOp = 0x54
+	EVM_SSTORE   EVMOp = 0x55
+	EVM_JUMP     EVMOp = 0x56
+	EVM_JUMPI    EVMOp = 0x57
+	EVM_PC       EVMOp = 0x58
+	EVM_MSIZE    EVMOp = 0x59
+	EVM_GAS      EVMOp = 0x5a
+	EVM_JUMPDEST EVMOp = 0x5b
+	EVM_PUSH0    EVMOp = 0x5f
+	EVM_PUSH1    EVMOp = 0x60
+	EVM_PUSH32   EVMOp = 0x7f
+	EVM_DUP1     EVMOp = 0x80
+	EVM_DUP16    EVMOp = 0x8f
+	EVM_SWAP1    EVMOp = 0x90
+	EVM_SWAP16   EVMOp = 0x9f
+	EVM_LOG0     EVMOp = 0xa0
+	EVM_LOG4     EVMOp = 0xa4
+
+	EVM_RETURN  EVMOp = 0xf3
+	EVM_REVERT  EVMOp = 0xfd
+	EVM_INVALID EVMOp = 0xfe
+)
+
+var evmOpNames = map[EVMOp]string{
+	EVM_STOP: "STOP", EVM_ADD: "ADD", EVM_MUL: "MUL", EVM_SUB: "SUB", EVM_DIV: "DIV", EVM_SDIV: "SDIV",
+	EVM_MOD: "MOD", EVM_SMOD: "SMOD", EVM_ADDMOD: "ADDMOD", EVM_MULMOD: "MULMOD", EVM_EXP: "EXP",
+	EVM_SIGNEXTEND: "SIGNEXTEND", EVM_LT: "LT", EVM_GT: "GT", EVM_SLT: "SLT", EVM_SGT: "SGT", EVM_EQ: "EQ",
+	EVM_ISZERO: "ISZERO", EVM_AND: "AND", EVM_OR: "OR", EVM_XOR: "XOR", EVM_NOT: "NOT", EVM_BYTE: "BYTE",
+	EVM_SHL: "SHL", EVM_SHR: "SHR", EVM_SAR: "SAR",
+	EVM_ADDRESS: "ADDRESS", EVM_ORIGIN: "ORIGIN", EVM_CALLER: "CALLER", EVM_CALLVALUE: "CALLVALUE",
+	EVM_CALLDATALOAD: "CALLDATALOAD", EVM_CALLDATASIZE: "CALLDATASIZE", EVM_CALLDATACOPY: "CALLDATACOPY",
+	EVM_CODESIZE: "CODESIZE", EVM_CODECOPY: "CODECOPY", EVM_TIMESTAMP: "TIMESTAMP", EVM_NUMBER: "NUMBER",
+	EVM_POP: "POP", EVM_MLOAD: "MLOAD", EVM_MSTORE: "MSTORE", EVM_MSTORE8: "MSTORE8",
+	EVM_SLOAD: "SLOAD", EVM_SSTORE: "SSTORE", EVM_JUMP: "JUMP", EVM_JUMPI: "JUMPI", EVM_PC: "PC",
+	EVM_MSIZE: "MSIZE", EVM_GAS: "GAS", EVM_JUMPDEST: "JUMPDEST", EVM_PUSH0: "PUSH0",
+	EVM_RETURN: "RETURN", EVM_REVERT: "REVERT", EVM_INVALID: "INVALID",
+}
+
+func (op EVMOp) String() string {
+	switch {
+	case op >= EVM_PUSH1 && op <= EVM_PUSH32:
+		return fmt.Sprintf("PUSH%d", op-EVM_PUSH1+1)
+	case op >= EVM_DUP1 && op <= EVM_DUP16:
+		return fmt.Sprintf("DUP%d", op-EVM_DUP1+1)
+	case op >= EVM_SWAP1 && op <= EVM_SWAP16:
+		return fmt.Sprintf("SWAP%d", op-EVM_SWAP1+1)
+	case op >= EVM_LOG0 && op <= EVM_LOG4:
+		return fmt.Sprintf("LOG%d", op-EVM_LOG0)
+	}
+	if name, ok := evmOpNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(0x%02x)", byte(op))
+}
+
+// pushSize PUSH1-PUSH32后紧跟的数据字节数，其他操作码为0
+func (op EVMOp) pushSize() int {
+	if op >= EVM_PUSH1 && op <= EVM_PUSH32 {
+		return int(op-EVM_PUSH1) + 1
+	}
+	return 0
+}
+
+// EVM执行限制
+const (
+	MaxEVMStack    = 1024
+	MaxEVMInitCode = 2 * MaxContractCodeSize // 部署交易中初始化代码的最大字节数
+	MaxEVMMemory   = 1 << 20                 // 内存上限（字节），gas通常会先耗尽
+)
+
+// EVM的gas表（参照以太坊黄皮书，SSTORE不计退款）
+const (
+	gasEVMBase        = 2
+	gasEVMVeryLow     = 3
+	gasEVMLow         = 5
+	gasEVMMid         = 8
+	gasEVMHigh        = 10
+	gasEVMJumpDest    = 1
+	gasEVMExpByte     = 50
+	gasEVMCopyWord    = 3
+	gasEVMMemoryWord  = 3
+	gasEVMSLoad       = 800
+	gasEVMSStoreSet   = 20000 // 零值改为非零值
+	gasEVMSStoreReset = 5000  // 其他修改
+	gasEVMLog         = 375
+	gasEVMLogTopic    = 375
+	gasEVMLogByte     = 8
+)
+
+// evmOpGas 操作码的固定gas消耗，内存扩展、复制、EXP、日志与存储的额外开销执行时计算
+func evmOpGas(op EVMOp) uint64 {
+	switch {
+	case op >= EVM_PUSH1 && op <= EVM_SWAP16:
+		return gasEVMVeryLow
+	case op >= EVM_LOG0 && op <= EVM_LOG4:
+		return gasEVMLog + uint64(op-EVM_LOG0)*gasEVMLogTopic
+	}
+	switch op {
+	case EVM_STOP, EVM_RETURN, EVM_REVERT, EVM_INVALID, EVM_SSTORE:
+		return 0
+	case EVM_JUMPDEST:
+		return gasEVMJumpDest
+	case EVM_MUL, EVM_DIV, EVM_SDIV, EVM_MOD, EVM_SMOD, EVM_SIGNEXTEND:
+		return gasEVMLow
+	case EVM_ADDMOD, EVM_MULMOD, EVM_JUMP:
+		return gasEVMMid
+	case EVM_JUMPI, EVM_EXP:
+		return gasEVMHigh
+	case EVM_SLOAD:
+		return gasEVMSLoad
+	case EVM_ADDRESS, EVM_ORIGIN, EVM_CALLER, EVM_CALLVALUE, EVM_CALLDATASIZE, EVM_CODESIZE,
+		EVM_TIMESTAMP, EVM_NUMBER, EVM_POP, EVM_PC, EVM_MSIZE, EVM_GAS, EVM_PUSH0:
+		return gasEVMBase
+	}
+	return gasEVMVeryLow
+}
+
+// ------------------------------
+// 256位字运算
+// ------------------------------
+
+var (
+	tt256   = new(big.Int).Lsh(big.NewInt(1), 256)
+	tt255   = new(big.Int).Lsh(big.NewInt(1), 255)
+	tt256m1 = new(big.Int).Sub(tt256, big.NewInt(1))
+)
+
+// u256 把结果规约到[0, 2^256)
+func u256(x *big.Int) *big.Int {
+	return x.Mod(x, tt256)
+}
+
+// s256 按补码解释为有符号数（返回新值）
+func s256(x *big.Int) *big.Int {
+	if x.Cmp(tt255) < 0 {
+		return new(big.Int).Set(x)
+	}
+	return new(big.Int).Sub(x, tt256)
+}
+
+func evmBool(v bool) *big.Int {
+	if v {
+		return big.NewInt(1)
+	}
+	return new(big.Int)
+}
+
+// word32 32字节大端编码
+func word32(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, 32))
+}
+
+// ------------------------------
+// 日志
+// ------------------------------
+
+// Log 合约通过LOG0-4记录的事件，执行失败时丢弃
+type Log struct {
+	Address Address  `json:"address"`
+	Topics  []string `json:"topics,omitempty"` // 32字节主题的十六进制
+	Data    []byte   `json:"data,omitempty"`
+}
+
+// ------------------------------
+// 部署与调用
+// ------------------------------
+
+// evmRevert REVERT返回的数据，如solc的Error(string)或Panic(uint256)编码
+type evmRevert struct {
+	data []byte
+}
+
+func (e *evmRevert) Error() string {
+	return fmt.Sprintf("%s: 0x%s", ErrExecutionReverted, hex.EncodeToString(e.data))
+}
+
+func (e *evmRevert) Is(target error) bool { return target == ErrExecutionReverted }
+
+// createEVM 在addr执行初始化代码，其返回数据作为合约的运行时代码
+func (vm *VM) createEVM(addr Address, initCode []byte) error {
+	if _, ok := vm.state[addr]; ok {
+		return fmt.Errorf("地址 %s 已存在合约", addr)
+	}
+	contract := &contractAccount{evm: true, storage: make(map[string][]byte)}
+	vm.state[addr] = contract
+	vm.journal = append(vm.journal, vmJournalEntry{addr: addr, created: true})
+	f := &evmFrame{vm: vm, caller: vm.ctx.Origin, self: addr, code: initCode}
+	runtime, err := f.run()
+	if err != nil {
+		return err
+	}
+	if len(runtime) > MaxContractCodeSize {
+		return fmt.Errorf("运行时代码过长: %d字节", len(runtime))
+	}
+	if err := vm.useGas(uint64(len(runtime)) * gasDeployByte); err != nil {
+		return err
+	}
+	contract.code = runtime
+	vm.logs = append(vm.logs, f.logs...)
+	return nil
+}
+
+// callEVM 以calldata调用EVM合约；执行失败时撤销本次调用的全部修改
+func (vm *VM) callEVM(caller, addr Address, calldata []byte) ([]byte, error) {
+	contract, ok := vm.state[addr]
+	if !ok {
+		return nil, fmt.Errorf("地址 %s 没有合约", addr)
+	}
+	if !contract.evm {
+		return nil, fmt.Errorf("地址 %s 不是EVM合约", addr)
+	}
+	mark := len(vm.journal)
+	f := &evmFrame{vm: vm, caller: caller, self: addr, code: contract.code, calldata: calldata}
+	ret, err := f.run()
+	if err != nil {
+		vm.revert(mark)
+		return ret, err
+	}
+	vm.logs = append(vm.logs, f.logs...)
+	return ret, nil
+}
+
+// ------------------------------
+// 解释器
+// ------------------------------
+
+// evmFrame 单次EVM调用的执行状态
+type evmFrame struct {
+	vm       *VM
+	caller   Address
+	self     Address
+	code     []byte
+	calldata []byte
+	stack    []*big.Int
+	memory   []byte
+	logs     []Log
+}
+
+// jumpDests JUMPDEST分析：只有不在PUSH数据中的JUMPDEST才是合法的跳转目标
+func jumpDests(code []byte) []bool {
+	dests := make([]bool, len(code))
+	for pc := 0; pc < len(code); pc++ {
+		op := EVMOp(code[pc])
+		if op == EVM_JUMPDEST {
+			dests[pc] = true
+		}
+		pc += op.pushSize()
+	}
+	return dests
+}
+
+// evmAddressWord 地址在EVM中按20字节哈希解释为整数
+func evmAddressWord(addr Address) *big.Int {
+	hash := addr.Hash()
+	return new(big.Int).SetBytes(hash[:])
+}
+
+func (f *evmFrame) push(x *big.Int) error {
+	if len(f.stack) >= MaxEVMStack {
+		return errors.New("栈溢出")
+	}
+	f.stack = append(f.stack, x)
+	return nil
+}
+
+// pop 弹出n个元素，返回值按栈顶在前排列
+func (f *evmFrame) pop(n int) ([]*big.Int, error) {
+	if len(f.stack) < n {
+		return nil, errors.New("栈元素不足")
+	}
+	items := make([]*big.Int, n)
+	for i := range items {
+		items[i] = f.stack[len(f.stack)-1-i]
+	}
+	f.stack = f.stack[:len(f.stack)-n]
+	return items, nil
+}
+
+// memoryRange 检查[offset, offset+size)并按需扩展内存，扩展按字数的二次函数计费
+func (f *evmFrame) memoryRange(offset, size *big.Int) (int, int, error) {
+	if size.Sign() == 0 {
+		return 0, 0, nil
+	}
+	if offset.Cmp(big.NewInt(MaxEVMMemory)) > 0 || size.Cmp(big.NewInt(MaxEVMMemory)) > 0 ||
+		offset.Uint64()+size.Uint64() > MaxEVMMemory {
+		return 0, 0, errors.New("内存访问超出范围")
+	}
+	start, n := int(offset.Uint64()), int(size.Uint64())
+	if end := start + n; end > len(f.memory) {
+		words := uint64(end+31) / 32
+		cost := func(w uint64) uint64 { return w*gasEVMMemoryWord + w*w/512 }
+		if err := f.vm.useGas(cost(words) - cost(uint64(len(f.memory))/32)); err != nil {
+			return 0, 0, err
+		}
+		f.memory = append(f.memory, make([]byte, int(words*32)-len(f.memory))...)
+	}
+	return start, n, nil
+}
+
+// copyData 按EVM规则复制数据：超出源数据的部分补0
+func copyData(src []byte, offset *big.Int, size int) []byte {
+	out := make([]byte, size)
+	if offset.IsUint64() && offset.Uint64() < uint64(len(src)) {
+		copy(out, src[offset.Uint64():])
+	}
+	return out
+}
+
+// run 执行代码，返回RETURN的数据；REVERT时返回数据与evmRevert错误
+func (f *evmFrame) run() ([]byte, error) {
+	dests := jumpDests(f.code)
+	for pc := 0; pc < len(f.code); pc++ {
+		op := EVMOp(f.code[pc])
+		if err := f.vm.useGas(evmOpGas(op)); err != nil {
+			return nil, err
+		}
+		switch {
+		case op == EVM_PUSH0:
+			if err := f.push(new(big.Int)); err != nil {
+				return nil, err
+			}
+			continue
+		case op.pushSize() > 0:
+			data := make([]byte, op.pushSize())
+			copy(data, f.code[pc+1:min(pc+1+len(data), len(f.code))])
+			pc += len(data)
+			if err := f.push(new(big.Int).SetBytes(data)); err != nil {
+				return nil, err
+			}
+			continue
+		case op >= EVM_DUP1 && op <= EVM_DUP16:
+			n := int(op-EVM_DUP1) + 1
+			if len(f.stack) < n {
+				return nil, fmt.Errorf("偏移%d %s: 栈元素不足", pc, op)
+			}
+			if err := f.push(new(big.Int).Set(f.stack[len(f.stack)-n])); err != nil {
+				return nil, err
+			}
+			continue
+		case op >= EVM_SWAP1 && op <= EVM_SWAP16:
+			n := int(op-EVM_SWAP1) + 1
+			if len(f.stack) <= n {
+				return nil, fmt.Errorf("偏移%d %s: 栈元素不足", pc, op)
+			}
+			top := len(f.stack) - 1
+			f.stack[top], f.stack[top-n] = f.stack[top-n], f.stack[top]
+			continue
+		case op >= EVM_LOG0 && op <= EVM_LOG4:
+			if err := f.log(int(op - EVM_LOG0)); err != nil {
+				return nil, fmt.Errorf("偏移%d %s: %w", pc, op, err)
+			}
+			continue
+		}
+
+		switch op {
+		case EVM_STOP:
+			return nil, nil
+		case EVM_RETURN, EVM_REVERT:
+			args, err := f.pop(2)
+			if err != nil {
+				return nil, err
+			}
+			start, n, err := f.memoryRange(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			data := append([]byte(nil), f.memory[start:start+n]...)
+			if op == EVM_REVERT {
+				return data, &evmRevert{data: data}
+			}
+			return data, nil
+		case EVM_JUMP, EVM_JUMPI:
+			n := 1
+			if op == EVM_JUMPI {
+				n = 2
+			}
+			args, err := f.pop(n)
+			if err != nil {
+				return nil, err
+			}
+			if op == EVM_JUMPI && args[1].Sign() == 0 {
+				continue
+			}
+			dest := args[0]
+			if !dest.IsUint64() || dest.Uint64() >= uint64(len(f.code)) || !dests[dest.Uint64()] {
+				return nil, fmt.Errorf("偏移%d %s: 跳转目标%s不是JUMPDEST", pc, op, dest)
+			}
+			// 跳到JUMPDEST本身，由循环执行它并计费
+			pc = int(dest.Uint64()) - 1
+		case EVM_PC:
+			if err := f.push(big.NewInt(int64(pc))); err != nil {
+				return nil, err
+			}
+		case EVM_JUMPDEST:
+		case EVM_INVALID:
+			return nil, fmt.Errorf("偏移%d: INVALID指令", pc)
+		default:
+			if err := f.step(op); err != nil {
+				return nil, fmt.Errorf("偏移%d %s: %w", pc, op, err)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// step 执行不改变控制流的指令
+func (f *evmFrame) step(op EVMOp) error {
+	switch op {
+	case EVM_ADD, EVM_MUL, EVM_SUB, EVM_DIV, EVM_SDIV, EVM_MOD, EVM_SMOD, EVM_EXP, EVM_SIGNEXTEND,
+		EVM_LT, EVM_GT, EVM_SLT, EVM_SGT, EVM_EQ, EVM_AND, EVM_OR, EVM_XOR, EVM_BYTE, EVM_SHL, EVM_SHR, EVM_SAR:
+		args, err := f.pop(2)
+		if err != nil {
+			return err
+		}
+		result, err := f.binary(op, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return f.push(result)
+	case EVM_ADDMOD, EVM_MULMOD:
+		args, err := f.pop(3)
+		if err != nil {
+			return err
+		}
+		if args[2].Sign() == 0 {
+			return f.push(new(big.Int))
+		}
+		r := new(big.Int)
+		if op == EVM_ADDMOD {
+			r.Add(args[0], args[1])
+		} else {
+			r.Mul(args[0], args[1])
+		}
+		return f.push(r.Mod(r, args[2]))
+	case EVM_ISZERO, EVM_NOT:
+		args, err := f.pop(1)
+		if err != nil {
+			return err
+		}
+		if op == EVM_ISZERO {
+			return f.push(evmBool(args[0].Sign() == 0))
+		}
+		return f.push(new(big.Int).Xor(args[0], tt256m1))
+	case EVM_POP:
+		_, err := f.pop(1)
+		return err
+	case EVM_ADDRESS:
+		return f.push(evmAddressWord(f.self))
+	case EVM_ORIGIN:
+		return f.push(evmAddressWord(f.vm.ctx.Origin))
+	case EVM_CALLER:
+		return f.push(evmAddressWord(f.caller))
+	case EVM_CALLVALUE:
+		// 合约不持有余额，调用金额恒为0
+		return f.push(new(big.Int))
+	case EVM_CALLDATASIZE:
+		return f.push(big.NewInt(int64(len(f.calldata))))
+	case EVM_CODESIZE:
+		return f.push(big.NewInt(int64(len(f.code))))
+	case EVM_TIMESTAMP:
+		return f.push(big.NewInt(f.vm.ctx.BlockTime / 1e9))
+	case EVM_NUMBER:
+		return f.push(big.NewInt(int64(f.vm.ctx.BlockHeight)))
+	case EVM_MSIZE:
+		return f.push(big.NewInt(int64(len(f.memory))))
+	case EVM_GAS:
+		return f.push(new(big.Int).SetUint64(f.vm.gas))
+	case EVM_CALLDATALOAD:
+		args, err := f.pop(1)
+		if err != nil {
+			return err
+		}
+		return f.push(new(big.Int).SetBytes(copyData(f.calldata, args[0], 32)))
+	case EVM_CALLDATACOPY, EVM_CODECOPY:
+		args, err := f.pop(3)
+		if err != nil {
+			return err
+		}
+		start, n, err := f.memoryRange(args[0], args[2])
+		if err != nil {
+			return err
+		}
+		if err := f.vm.useGas(uint64(n+31) / 32 * gasEVMCopyWord); err != nil {
+			return err
+		}
+		src := f.calldata
+		if op == EVM_CODECOPY {
+			src = f.code
+		}
+		copy(f.memory[start:], copyData(src, args[1], n))
+	case EVM_MLOAD:
+		args, err := f.pop(1)
+		if err != nil {
+			return err
+		}
+		start, _, err := f.memoryRange(args[0], big.NewInt(32))
+		if err != nil {
+			return err
+		}
+		return f.push(new(big.Int).SetBytes(f.memory[start : start+32]))
+	case EVM_MSTORE, EVM_MSTORE8:
+		args, err := f.pop(2)
+		if err != nil {
+			return err
+		}
+		if op == EVM_MSTORE8 {
+			start, _, err := f.memoryRange(args[0], big.NewInt(1))
+			if err != nil {
+				return err
+			}
+			f.memory[start] = byte(args[1].Uint64())
+			return nil
+		}
+		start, _, err := f.memoryRange(args[0], big.NewInt(32))
+		if err != nil {
+			return err
+		}
+		copy(f.memory[start:], word32(args[1]))
+	case EVM_SLOAD:
+		args, err := f.pop(1)
+		if err != nil {
+			return err
+		}
+		value := f.vm.state[f.self].storage[string(word32(args[0]))]
+		return f.push(new(big.Int).SetBytes(value))
+	case EVM_SSTORE:
+		args, err := f.pop(2)
+		if err != nil {
+			return err
+		}
+		key := word32(args[0])
+		_, existed := f.vm.state[f.self].storage[string(key)]
+		cost := uint64(gasEVMSStoreReset)
+		if !existed && args[1].Sign() != 0 {
+			cost = gasEVMSStoreSet
+		}
+		if err := f.vm.useGas(cost); err != nil {
+			return err
+		}
+		// 零值即删除，存储中不保留
+		var value []byte
+		if args[1].Sign() != 0 {
+			value = word32(args[1])
+		}
+		f.vm.setStorage(f.self, key, value)
+	default:
+		return errors.New("不支持的操作码")
+	}
+	return nil
+}
+
+// binary 二元运算，a为原栈顶
+func (f *evmFrame) binary(op EVMOp, a, b *big.Int) (*big.Int, error) {
+	r := new(big.Int)
+	switch op {
+	case EVM_ADD:
+		return u256(r.Add(a, b)), nil
+	case EVM_MUL:
+		return u256(r.Mul(a, b)), nil
+	case EVM_SUB:
+		return u256(r.Sub(a, b)), nil
+	case EVM_DIV:
+		if b.Sign() == 0 {
+			return r, nil
+		}
+		return r.Div(a, b), nil
+	case EVM_MOD:
+		if b.Sign() == 0 {
+			return r, nil
+		}
+		return r.Mod(a, b), nil
+	case EVM_SDIV:
+		if b.Sign() == 0 {
+			return r, nil
+		}
+		return u256(r.Quo(s256(a), s256(b))), nil
+	case EVM_SMOD:
+		if b.Sign() == 0 {
+			return r, nil
+		}
+		return u256(r.Rem(s256(a), s256(b))), nil
+	case EVM_EXP:
+		if err := f.vm.useGas(uint64(len(b.Bytes())) * gasEVMExpByte); err != nil {
+			return nil, err
+		}
+		return r.Exp(a, b, tt256), nil
+	case EVM_SIGNEXTEND:
+		// a为字节序号，b为待扩展的值
+		if a.Cmp(big.NewInt(31)) >= 0 {
+			return r.Set(b), nil
+		}
+		bit := uint(a.Uint64()*8 + 7)
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bit+1), big.NewInt(1))
+		if b.Bit(int(bit)) == 1 {
+			return r.Or(b, new(big.Int).Xor(mask, tt256m1)), nil
+		}
+		return r.And(b, mask), nil
+	case EVM_LT:
+		return evmBool(a.Cmp(b) < 0), nil
+	case EVM_GT:
+		return evmBool(a.Cmp(b) > 0), nil
+	case EVM_SLT:
+		return evmBool(s256(a).Cmp(s256(b)) < 0), nil
+	case EVM_SGT:
+		return evmBool(s256(a).Cmp(s256(b)) > 0), nil
+	case EVM_EQ:
+		return evmBool(a.Cmp(b) == 0), nil
+	case EVM_AND:
+		return r.And(a, b), nil
+	case EVM_OR:
+		return r.Or(a, b), nil
+	case EVM_XOR:
+		return r.Xor(a, b), nil
+	case EVM_BYTE:
+		// a为字节序号（0为最高位字节），b为值
+		if a.Cmp(big.NewInt(32)) >= 0 {
+			return r, nil
+		}
+		return r.SetUint64(uint64(word32(b)[a.Uint64()])), nil
+	case EVM_SHL, EVM_SHR, EVM_SAR:
+		// a为位移量，b为值
+		if a.Cmp(big.NewInt(256)) >= 0 {
+			if op == EVM_SAR && b.Bit(255) == 1 {
+				return r.Set(tt256m1), nil
+			}
+			return r, nil
+		}
+		shift := uint(a.Uint64())
+		switch op {
+		case EVM_SHL:
+			return u256(r.Lsh(b, shift)), nil
+		case EVM_SHR:
+			return r.Rsh(b, shift), nil
+		}
+		return u256(r.Rsh(s256(b), shift)), nil
+	}
+	return nil, errors.New("不支持的操作码")
+}
+
+// log 记录事件：弹出内存位置、长度与n个主题
+func (f *evmFrame) log(n int) error {
+	args, err := f.pop(2 + n)
+	if err != nil {
+		return err
+	}
+	start, size, err := f.memoryRange(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if err := f.vm.useGas(uint64(size) * gasEVMLogByte); err != nil {
+		return err
+	}
+	entry := Log{Address: f.self, Data: append([]byte(nil), f.memory[start:start+size]...)}
+	for _, topic := range args[2:] {
+		entry.Topics = append(entry.Topics, hex.EncodeToString(word32(topic)))
+	}
+	f.logs = append(f.logs, entry)
+	return nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------
+// 区块浏览器：最近区块、区块详情、交易详情、地址余额与历史，支持按哈希/高度/地址搜索
+// ------------------------------
+
+// explorerRecentBlocks 首页显示的最近区块数
+const explorerRecentBlocks = 20
+
+// Explorer 区块浏览器，实现 http.Handler
+type Explorer struct {
+	bc   *Blockchain
+	mux  *http.ServeMux
+	tmpl *template.Template
+}
+
+// NewExplorer 创建区块浏览器
+func NewExplorer(bc *Blockchain) *Explorer {
+	e := &Explorer{
+		bc:  bc,
+		mux: http.NewServeMux(),
+		tmpl: template.Must(template.New("explorer").Funcs(template.FuncMap{
+			"short":   shortHash,
+			"time":    func(ns int64) string { return time.Unix(0, ns).Format("2006-01-02 15:04:05") },
+			"add":     func(a, b int) int { return a + b },
+			"txCount": func(b *Block) int { return len(b.Transactions()) },
+			"producer": func(b *Block) string {
+				if producer, ok := b.Producer(); ok {
+					return producer.String()
+				}
+				return ""
+			},
+		}).Parse(explorerTemplates)),
+	}
+	e.mux.HandleFunc("GET /{$}", e.handleIndex)
+	e.mux.HandleFunc("GET /block/{id}", e.handleBlock)
+	e.mux.HandleFunc("GET /tx/{id}", e.handleTransaction)
+	e.mux.HandleFunc("GET /address/{addr}", e.handleAddress)
+	e.mux.HandleFunc("GET /search", e.handleSearch)
+	return e
+}
+
+// ServeHTTP 实现 http.Handler
+func (e *Explorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+func (e *Explorer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	blocks := e.bc.Blocks()
+	recent := make([]*Block, 0, explorerRecentBlocks)
+	for i := len(blocks) - 1; i >= 0 && len(recent) < explorerRecentBlocks; i-- {
+		recent = append(recent, blocks[i])
+	}
+	e.render(w, "index", map[string]interface{}{
+		"Height":  len(blocks) - 1,
+		"ChainID": e.bc.ChainID(),
+		"Blocks":  recent,
+		"Pending": e.bc.PendingTransactions(),
+	})
+}
+
+// handleBlock 区块详情，id可以是哈希或高度
+func (e *Explorer) handleBlock(w http.ResponseWriter, r *http.Request) {
+	block, err := e.findBlock(r.PathValue("id"))
+	if err != nil {
+		e.notFound(w, r.PathValue("id")+": "+err.Error())
+		return
+	}
+	e.render(w, "block", block)
+}
+
+func (e *Explorer) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	txid := r.PathValue("id")
+	loc, err := e.bc.GetTransaction(txid)
+	if err == nil {
+		e.render(w, "tx", map[string]interface{}{"Tx": loc.Transaction, "Block": loc.Block, "Position": loc.Position})
+		return
+	}
+	if tx, ok := e.bc.Mempool().Get(txid); ok {
+		e.render(w, "tx", map[string]interface{}{"Tx": tx})
+		return
+	}
+	e.notFound(w, err.Error())
+}
+
+func (e *Explorer) handleAddress(w http.ResponseWriter, r *http.Request) {
+	addr, err := ParseAddress(r.PathValue("addr"))
+	if err != nil {
+		e.notFound(w, err.Error())
+		return
+	}
+	page := 0
+	if raw := r.URL.Query().Get("page"); raw != "" {
+		if page, err = strconv.Atoi(raw); err != nil || page < 0 {
+			e.badRequest(w, "无效的页码: "+raw)
+			return
+		}
+	}
+	history, total, err := e.bc.GetTransactionsByAddress(addr, Page{Number: page, Size: DefaultPageSize})
+	if last := max(total-1, 0) / DefaultPageSize; page > last {
+		// 页码超出范围时显示最后一页
+		page = last
+		history, total, err = e.bc.GetTransactionsByAddress(addr, Page{Number: page, Size: DefaultPageSize})
+	}
+	if err != nil {
+		e.notFound(w, err.Error())
+		return
+	}
+	prev, next := -1, -1
+	if page > 0 {
+		prev = page - 1
+	}
+	if (page+1)*DefaultPageSize < total {
+		next = page + 1
+	}
+	e.render(w, "address", map[string]interface{}{
+		"Address":   addr,
+		"Balance":   e.bc.Balance(addr),
+		"Spendable": e.bc.SpendableBalance(addr),
+		"Total":     total,
+		"History":   history,
+		"Prev":      prev,
+		"Next":      next,
+	})
+}
+
+// handleSearch 依次尝试高度、区块哈希、交易ID与地址
+func (e *Explorer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if block, err := e.findBlock(q); err == nil {
+		http.Redirect(w, r, "/block/"+block.Hash(), http.StatusFound)
+		return
+	}
+	if _, err := e.bc.GetTransaction(q); err == nil {
+		http.Redirect(w, r, "/tx/"+q, http.StatusFound)
+		return
+	}
+	if _, ok := e.bc.Mempool().Get(q); ok {
+		http.Redirect(w, r, "/tx/"+q, http.StatusFound)
+		return
+	}
+	if addr, err := ParseAddress(q); err == nil {
+		http.Redirect(w, r, "/address/"+addr.String(), http.StatusFound)
+		return
+	}
+	e.notFound(w, "未找到与 \""+q+"\" 匹配的区块、交易或地址")
+}
+
+// findBlock 按高度或哈希查找区块
+func (e *Explorer) findBlock(id string) (*Block, error) {
+	if height, err := strconv.Atoi(id); err == nil {
+		return e.bc.GetBlockByHeight(height)
+	}
+	return e.bc.GetBlockByHash(id)
+}
+
+func (e *Explorer) notFound(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusNotFound)
+	e.render(w, "notfound", message)
+}
+
+func (e *Explorer) badRequest(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	e.render(w, "badrequest", message)
+}
+
+func (e *Explorer) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := e.tmpl.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("渲染页面 %s 失败: %v", name, err)
+	}
+}
+
+// shortHash 截断长哈希用于列表显示
+func shortHash(s string) string {
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:8] + "…" + s[len(s)-8:]
+}
+
+// explorerTemplates 页面模板，layout为公共头尾
+const explorerTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>区块浏览器</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+code { font-size: 0.9em; word-break: break-all; }
+nav form { display: inline; margin-left: 1em; }
+</style>
+</head>
+<body>
+<nav><a href="/">首页</a>
+<form action="/search"><input name="q" size="60" placeholder="区块高度 / 区块哈希 / 交易ID / 地址"> <button>搜索</button></form>
+</nav>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "txrow"}}<tr>
+<td><a href="/tx/{{.ID}}"><code>{{short .ID}}</code></a></td>
+<td>{{if .IsCoinbase}}挖矿奖励{{else}}<a href="/address/{{.Sender}}">{{.Sender}}</a>{{end}}</td>
+<td><a href="/address/{{.Recipient}}">{{.Recipient}}</a></td>
+<td>{{.Amount}}</td>
+<td>{{.Fee}}</td>
+</tr>{{end}}
+
+{{define "index"}}{{template "header"}}
+<h1>区块浏览器</h1>
+<p>链ID: <code>{{.ChainID}}</code>，当前高度: {{.Height}}，待打包交易: {{len .Pending}}</p>
+<h2>最近区块</h2>
+<table>
+<tr><th>高度</th><th>哈希</th><th>时间</th><th>交易数</th></tr>
+{{range .Blocks}}<tr>
+<td><a href="/block/{{.Index}}">{{.Index}}</a></td>
+<td><a href="/block/{{.Hash}}"><code>{{short .Hash}}</code></a></td>
+<td>{{time .Timestamp}}</td>
+<td>{{txCount .}}</td>
+</tr>{{end}}
+</table>
+{{if .Pending}}<h2>待打包交易</h2>
+<table>
+<tr><th>交易ID</th><th>发送方</th><th>接收方</th><th>金额</th><th>手续费</th></tr>
+{{range .Pending}}{{template "txrow" .}}{{end}}
+</table>{{end}}
+{{template "footer"}}{{end}}
+
+{{define "block"}}{{template "header"}}
+<h1>区块 #{{.Index}}</h1>
+<table>
+<tr><th>哈希</th><td><code>{{.Hash}}</code></td></tr>
+<tr><th>前一区块</th><td>{{if .Index}}<a href="/block/{{.PreviousHash}}"><code>{{.PreviousHash}}</code></a>{{else}}<code>{{.PreviousHash}}</code>{{end}}</td></tr>
+<tr><th>时间</th><td>{{time .Timestamp}}（{{.Timestamp}}）</td></tr>
+<tr><th>Proof</th><td>{{.Proof}}</td></tr>
+{{with producer .}}<tr><th>出块者</th><td><a href="/address/{{.}}"><code>{{.}}</code></a></td></tr>{{end}}
+{{if .BaseFee}}<tr><th>基础费用</th><td>{{.BaseFee}} / gas</td></tr>
+<tr><th>gas用量</th><td>{{.GasUsed}}</td></tr>{{end}}
+<tr><th>交易数</th><td>{{txCount .}}</td></tr>
+</table>
+<h2>交易</h2>
+<table>
+<tr><th>交易ID</th><th>发送方</th><th>接收方</th><th>金额</th><th>手续费</th></tr>
+{{range .Transactions}}{{template "txrow" .}}{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "tx"}}{{template "header"}}
+<h1>交易</h1>
+{{with .Tx}}<table>
+<tr><th>交易ID</th><td><code>{{.ID}}</code></td></tr>
+<tr><th>发送方</th><td>{{if .IsCoinbase}}挖矿奖励{{else}}<a href="/address/{{.Sender}}">{{.Sender}}</a>{{end}}</td></tr>
+<tr><th>接收方</th><td><a href="/address/{{.Recipient}}">{{.Recipient}}</a></td></tr>
+<tr><th>金额</th><td>{{.Amount}}</td></tr>
+<tr><th>最高手续费</th><td>{{.Fee}}</td></tr>
+{{if .HasTip}}<tr><th>最高小费</th><td>{{.Tip}}</td></tr>{{end}}
+<tr><th>序号</th><td>{{.Nonce}}</td></tr>
+<tr><th>链ID</th><td><code>{{.ChainID}}</code></td></tr>
+<tr><th>绝对时间锁</th><td>{{.LockTime}}</td></tr>
+<tr><th>相对时间锁</th><td>{{.RelativeLock}} 个区块</td></tr>
+<tr><th>锁定脚本</th><td><code>{{.LockScript}}</code></td></tr>
+<tr><th>解锁脚本</th><td><code>{{.UnlockScript}}</code></td></tr>
+{{end}}
+<tr><th>状态</th><td>{{if .Block}}已打包于区块 <a href="/block/{{.Block.Hash}}">#{{.Block.Index}}</a>，第{{add .Position 1}}笔{{else}}待打包{{end}}</td></tr>
+</table>
+{{template "footer"}}{{end}}
+
+{{define "address"}}{{template "header"}}
+<h1>地址</h1>
+<p><code>{{.Address}}</code>{{if .Address.IsScriptHash}}（脚本哈希地址）{{end}}</p>
+<table>
+<tr><th>余额</th><td>{{.Balance}}</td></tr>
+<tr><th>可花费</th><td>{{.Spendable}}</td></tr>
+<tr><th>交易数</th><td>{{.Total}}</td></tr>
+</table>
+<h2>历史</h2>
+<table>
+<tr><th>区块</th><th>交易ID</th><th>发送方</th><th>接收方</th><th>金额</th><th>手续费</th></tr>
+{{range .History}}<tr>
+<td><a href="/block/{{.Block.Hash}}">#{{.Block.Index}}</a></td>
+<td><a href="/tx/{{.Transaction.ID}}"><code>{{short .Transaction.ID}}</code></a></td>
+<td>{{if .Transaction.IsCoinbase}}挖矿奖励{{else}}<a href="/address/{{.Transaction.Sender}}">{{.Transaction.Sender}}</a>{{end}}</td>
+<td><a href="/address/{{.Transaction.Recipient}}">{{.Transaction.Recipient}}</a></td>
+<td>{{.Transaction.Amount}}</td>
+<td>{{.Transaction.Fee}}</td>
+</tr>{{end}}
+</table>
+<p>{{if ge .Prev 0}}<a href="?page={{.Prev}}">上一页</a>{{end}} {{if ge .Next 0}}<a href="?page={{.Next}}">下一页</a>{{end}}</p>
+{{template "footer"}}{{end}}
+
+{{define "notfound"}}{{template "header"}}
+<h1>未找到</h1>
+<p>{{.}}</p>
+{{template "footer"}}{{end}}
+
+{{define "badrequest"}}{{template "header"}}
+<h1>请求错误</h1>
+<p>{{.}}</p>
+{{template "footer"}}{{end}}
+`
+
+// ------------------------------
+// 演示使用：生成示例链并启动浏览器
+// ------------------------------
+
+// runExplorer 生成一条带有示例交易的链，并在指定地址提供浏览器服务
+func runExplorer(listen string) error {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	carol, _ := wallet.NewKey("carol")
+
+	bc := NewDevBlockchain(3)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+	for i := 1; i <= 5; i++ {
+		if _, err := wallet.Send(bc, alice, bob, Amount(i)*Coin); err != nil {
+			return err
+		}
+		if _, err := wallet.Send(bc, alice, carol, Coin/2); err != nil {
+			return err
+		}
+		bc.MineBlock()
+	}
+	if _, err := wallet.Send(bc, bob, carol, Coin); err != nil {
+		return err
+	}
+
+	fmt.Printf("区块浏览器已启动: http://%s/ （高度%d，Alice地址 %s）\n", displayHost(listen), bc.LastBlock().Index(), alice)
+	return http.ListenAndServe(listen, NewExplorer(bc))
+}
+
+// displayHost 监听地址只有端口时补全为localhost
+func displayHost(listen string) string {
+	if strings.HasPrefix(listen, ":") {
+		return "localhost" + listen
+	}
+	return listen
+}
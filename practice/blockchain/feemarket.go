@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// ------------------------------
+// 手续费市场（EIP-1559）：每个区块有每单位gas的基础费用，按父区块gas用量相对目标值的偏离上下调整；
+// 交易给出最高手续费与最高小费，基础费用×gas被销毁，小费归出块者，两者之和不超过最高手续费。
+// 未指定小费的交易按传统交易处理：扣除销毁部分后余下的手续费全部作为小费
+// ------------------------------
+
+// 手续费市场参数
+const (
+	GasTxTransfer            = 1000 // 非合约交易占用的gas
+	ElasticityMultiplier     = 2    // 区块gas上限为目标值的倍数
+	BaseFeeChangeDenominator = 8    // 基础费用每个区块最多调整1/8
+
+	DefaultGasTarget      uint64 = 5_000_000
+	DefaultInitialBaseFee Amount = 100
+	MinBaseFee            Amount = 1
+	DefaultTipPerGas      Amount = 10 // 没有手续费历史时钱包使用的每单位gas小费
+)
+
+// Gas 交易占用的区块gas：合约交易按gas上限计（未用完的gas不退还），其他交易为固定值
+func (t *Transaction) Gas() uint64 {
+	if t.isContractTx() {
+		return t.gasLimit
+	}
+	return GasTxTransfer
+}
+
+// feesAt 交易在基础费用为baseFee的区块中销毁的基础费用与支付给出块者的小费；
+// 最高手续费不足以支付基础费用时返回错误
+func (t *Transaction) feesAt(baseFee Amount) (burn, tip Amount, err error) {
+	if burn, err = baseFee.Mul(t.Gas()); err != nil {
+		return 0, 0, err
+	}
+	if t.fee < burn {
+		return 0, 0, fmt.Errorf("最高手续费%s不足以支付基础费用%s", t.fee, burn)
+	}
+	tip = t.fee - burn
+	if t.hasTip && t.tip < tip {
+		tip = t.tip
+	}
+	return burn, tip, nil
+}
+
+// totalGas 区块内交易占用的gas合计，挖矿奖励交易不占用gas
+func totalGas(txs []*Transaction) uint64 {
+	var gas uint64
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			gas += tx.Gas()
+		}
+	}
+	return gas
+}
+
+// gasTarget 每个区块的目标gas用量
+func (p ConsensusParams) gasTarget() uint64 {
+	if p.GasTarget == 0 {
+		return DefaultGasTarget
+	}
+	return p.GasTarget
+}
+
+// initialBaseFee 第一个带基础费用的区块的基础费用
+func (p ConsensusParams) initialBaseFee() Amount {
+	if p.InitialBaseFee == 0 {
+		return DefaultInitialBaseFee
+	}
+	return p.InitialBaseFee
+}
+
+// nextBaseFee 父区块之后的区块的基础费用：父区块gas用量高于目标时上调、低于目标时下调，
+// 幅度与偏离成正比，最多1/8；上调至少1，下调不低于MinBaseFee
+func (p ConsensusParams) nextBaseFee(parent BlockHeader) Amount {
+	if parent.BaseFee == 0 {
+		return p.initialBaseFee()
+	}
+	target := p.gasTarget()
+	if parent.GasUsed == target {
+		return parent.BaseFee
+	}
+	var diff uint64
+	if parent.GasUsed > target {
+		diff = parent.GasUsed - target
+	} else {
+		diff = target - parent.GasUsed
+	}
+	delta := new(big.Int).SetUint64(uint64(parent.BaseFee))
+	delta.Mul(delta, new(big.Int).SetUint64(diff))
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, big.NewInt(BaseFeeChangeDenominator))
+	next := new(big.Int).SetUint64(uint64(parent.BaseFee))
+	if parent.GasUsed > target {
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		next.Add(next, delta)
+		if next.Cmp(new(big.Int).SetUint64(uint64(MaxAmount))) > 0 {
+			return MaxAmount
+		}
+	} else {
+		next.Sub(next, delta)
+		if next.Cmp(new(big.Int).SetUint64(uint64(MinBaseFee))) < 0 {
+			return MinBaseFee
+		}
+	}
+	return Amount(next.Uint64())
+}
+
+// NextBaseFee 下一个区块的基础费用
+func (bc *Blockchain) NextBaseFee() Amount {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.genesis.Params.nextBaseFee(bc.lastBlock().Header())
+}
+
+// checkMaxFee 入池检查：最高手续费须足以支付下一个区块的基础费用
+func (bc *Blockchain) checkMaxFee(tx *Transaction) error {
+	baseFee := bc.genesis.Params.nextBaseFee(bc.lastBlock().Header())
+	_, _, err := tx.feesAt(baseFee)
+	return err
+}
+
+// checkBlockFees 区块的基础费用须由父区块计算得出，gas用量须与交易一致，
+// 每笔交易的最高手续费须足以支付基础费用
+func (bc *Blockchain) checkBlockFees(block *Block) error {
+	if expected := bc.genesis.Params.nextBaseFee(bc.lastBlock().Header()); block.BaseFee() != expected {
+		return fmt.Errorf("区块基础费用应为%s，实际%s", expected, block.BaseFee())
+	}
+	if gas := totalGas(block.Transactions()); block.GasUsed() != gas {
+		return fmt.Errorf("区块gas用量应为%d，实际%d", gas, block.GasUsed())
+	}
+	for i, tx := range block.Transactions() {
+		if tx.IsCoinbase() {
+			continue
+		}
+		if _, _, err := tx.feesAt(block.BaseFee()); err != nil {
+			return fmt.Errorf("第%d笔交易: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ------------------------------
+// 手续费历史：供钱包估算手续费
+// ------------------------------
+
+// FeeHistory 最近若干区块的基础费用、gas用量与小费分布
+type FeeHistory struct {
+	OldestBlock  int        `json:"oldest_block"`
+	BaseFees     []Amount   `json:"base_fees"`      // 每个区块的基础费用，最后一项为下一个区块的基础费用
+	GasUsedRatio []float64  `json:"gas_used_ratio"` // 每个区块gas用量与目标值之比
+	Rewards      [][]Amount `json:"rewards"`        // 每个区块按gas加权的每单位gas小费分位数
+}
+
+// FeeHistory 查询截至链尾的最近blockCount个区块（不含创世区块）的手续费历史，
+// percentiles为0到100之间的升序分位数；区块体已裁剪时返回ErrPruned
+func (bc *Blockchain) FeeHistory(blockCount int, percentiles []float64) (*FeeHistory, error) {
+	if blockCount <= 0 {
+		return nil, errors.New("区块数必须为正数")
+	}
+	for i, p := range percentiles {
+		if p < 0 || p > 100 || (i > 0 && p < percentiles[i-1]) {
+			return nil, errors.New("分位数须在0到100之间且升序排列")
+		}
+	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	last := bc.lastBlock().Index()
+	oldest := max(last-blockCount+1, 1)
+	history := &FeeHistory{OldestBlock: oldest}
+	target := float64(bc.genesis.Params.gasTarget())
+	for _, block := range bc.chain[oldest : last+1] {
+		if _, err := checkPruned(block); err != nil {
+			return nil, err
+		}
+		history.BaseFees = append(history.BaseFees, block.BaseFee())
+		history.GasUsedRatio = append(history.GasUsedRatio, float64(block.GasUsed())/target)
+		history.Rewards = append(history.Rewards, tipPercentiles(block, percentiles))
+	}
+	history.BaseFees = append(history.BaseFees, bc.genesis.Params.nextBaseFee(bc.lastBlock().Header()))
+	return history, nil
+}
+
+// tipPercentiles 区块内交易每单位gas小费的分位数，按交易gas加权；没有交易时全为0
+func tipPercentiles(block *Block, percentiles []float64) []Amount {
+	type gasTip struct {
+		gas uint64
+		tip Amount
+	}
+	var tips []gasTip
+	for _, tx := range block.Transactions() {
+		if tx.IsCoinbase() {
+			continue
+		}
+		if _, tip, err := tx.feesAt(block.BaseFee()); err == nil {
+			tips = append(tips, gasTip{gas: tx.Gas(), tip: tip / Amount(tx.Gas())})
+		}
+	}
+	rewards := make([]Amount, len(percentiles))
+	if len(tips) == 0 {
+		return rewards
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].tip < tips[j].tip })
+	total := totalGas(block.Transactions())
+	var cumulative uint64
+	i := 0
+	for j, p := range percentiles {
+		threshold := uint64(float64(total) * p / 100)
+		for i < len(tips)-1 && cumulative+tips[i].gas < threshold {
+			cumulative += tips[i].gas
+			i++
+		}
+		rewards[j] = tips[i].tip
+	}
+	return rewards
+}
+
+// suggestTipPerGas 建议的每单位gas小费：最近区块小费中位数的最大值，没有交易时取默认值
+func (bc *Blockchain) suggestTipPerGas() Amount {
+	const recentBlocks = 10
+	history, err := bc.FeeHistory(recentBlocks, []float64{50})
+	if err != nil {
+		return DefaultTipPerGas
+	}
+	tip := DefaultTipPerGas
+	for _, rewards := range history.Rewards {
+		tip = max(tip, rewards[0])
+	}
+	return tip
+}
+
+// estimateFees 为未指定最高手续费的交易估算手续费：小费按建议值，
+// 最高手续费预留两倍于下一个区块的基础费用，基础费用连续上调几个区块后交易仍可打包
+func (bc *Blockchain) estimateFees(tx *Transaction) error {
+	gas := tx.Gas()
+	if !tx.hasTip {
+		tip, err := bc.suggestTipPerGas().Mul(gas)
+		if err != nil {
+			return err
+		}
+		tx.tip, tx.hasTip = tip, true
+	}
+	burn, err := bc.NextBaseFee().Mul(gas * 2)
+	if err != nil {
+		return err
+	}
+	tx.fee, err = burn.Add(tx.tip)
+	return err
+}
+
+// ------------------------------
+// 演示使用：区块装满时基础费用上涨、空块时回落，钱包按手续费历史估算手续费
+// ------------------------------
+
+// runFeeMarketDemo 目标gas为两笔转账的链上，连续出满块再出空块，观察基础费用与销毁
+func runFeeMarketDemo() {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+	miner, _ := wallet.NewKey("miner")
+	genesis := DevGenesis(1)
+	genesis.ChainID = "upchain-feemarket-demo"
+	genesis.Params.GasTarget = 2 * GasTxTransfer
+	genesis.Alloc = []GenesisAlloc{{Address: alice, Balance: 100 * Coin}}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		fmt.Printf("创建区块链失败: %v\n", err)
+		return
+	}
+	bc.SetMinerAddress(miner)
+
+	produce := func(transfers int) bool {
+		for i := 0; i < transfers; i++ {
+			if _, err := wallet.Send(bc, alice, bob, Coin); err != nil {
+				fmt.Printf("转账失败: %v\n", err)
+				return false
+			}
+		}
+		block := bc.MineBlock()
+		burnt, _ := block.BaseFee().Mul(block.GasUsed())
+		fmt.Printf("区块%d: 基础费用 %s/gas，gas用量 %d（目标 %d），销毁 %s\n",
+			block.Index(), block.BaseFee(), block.GasUsed(), genesis.Params.gasTarget(), burnt)
+		return true
+	}
+	// 每块打包4笔转账，gas用量为目标的两倍，基础费用每块上涨1/8
+	for i := 0; i < 4; i++ {
+		if !produce(4) {
+			return
+		}
+	}
+	// 空块使基础费用回落
+	for i := 0; i < 3; i++ {
+		if !produce(0) {
+			return
+		}
+	}
+
+	history, err := bc.FeeHistory(8, []float64{10, 50, 90})
+	if err != nil {
+		fmt.Printf("查询手续费历史失败: %v\n", err)
+		return
+	}
+	fmt.Printf("手续费历史（自区块%d起）:\n", history.OldestBlock)
+	for i, ratio := range history.GasUsedRatio {
+		fmt.Printf("  区块%d: 基础费用 %s，gas用量比 %.2f，小费分位数 %v\n",
+			history.OldestBlock+i, history.BaseFees[i], ratio, history.Rewards[i])
+	}
+	fmt.Printf("下一个区块的基础费用: %s/gas\n", history.BaseFees[len(history.BaseFees)-1])
+
+	tx, err := wallet.BuildTransaction(bc, alice, bob, Coin)
+	if err != nil {
+		fmt.Printf("构造交易失败: %v\n", err)
+		return
+	}
+	fmt.Printf("钱包估算: 最高手续费 %s，最高小费 %s\n", tx.Fee(), tx.Tip())
+	fmt.Printf("矿工余额（奖励与小费）: %s，Alice余额: %s\n", bc.Balance(miner), bc.Balance(alice))
+}
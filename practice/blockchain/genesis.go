@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ------------------------------
+// 创世配置：链ID、创世时间、初始难度、POW哈希算法、共识参数与预分配余额。
+// 同一份配置总是生成同一个创世区块，创世哈希即可用来识别网络
+// ------------------------------
+
+// HashAlgorithm 工作量证明使用的哈希算法
+type HashAlgorithm string
+
+// 支持的哈希算法
+const (
+	HashSHA256   HashAlgorithm = "sha256"
+	HashSHA3_256 HashAlgorithm = "sha3-256"
+)
+
+// sum 计算哈希，算法不支持时panic（创世配置加载时已校验）
+func (a HashAlgorithm) sum(data []byte) []byte {
+	switch a {
+	case HashSHA256, "":
+		h := sha256.Sum256(data)
+		return h[:]
+	case HashSHA3_256:
+		h := sha3.Sum256(data)
+		return h[:]
+	}
+	panic(fmt.Sprintf("不支持的哈希算法: %s", a))
+}
+
+func (a HashAlgorithm) valid() bool {
+	return a == HashSHA256 || a == HashSHA3_256
+}
+
+// ConsensusParams 共识参数，同一网络的节点必须一致
+type ConsensusParams struct {
+	MaxBlockBytes        int    `json:"max_block_bytes"`
+	MaxBlockTransactions int    `json:"max_block_transactions"` // 含挖矿奖励交易
+	BlockReward          Amount `json:"block_reward"`           // 每个区块的挖矿奖励，最小单位
+	// AllowUnsignedBlocks 工作量证明区块可以不带出块者签名（默认必须签名，其他共识总是要求签名）
+	AllowUnsignedBlocks bool `json:"allow_unsigned_blocks,omitempty"`
+	// GasTarget 每个区块的目标gas用量，区块gas上限为其ElasticityMultiplier倍；0表示使用DefaultGasTarget
+	GasTarget uint64 `json:"gas_target,omitempty"`
+	// InitialBaseFee 第一个区块每单位gas的基础费用；0表示使用DefaultInitialBaseFee
+	InitialBaseFee Amount `json:"initial_base_fee,omitempty"`
+}
+
+// DefaultConsensusParams 默认共识参数
+var DefaultConsensusParams = ConsensusParams{
+	MaxBlockBytes:        DefaultBlockLimits.MaxBytes,
+	MaxBlockTransactions: DefaultBlockLimits.MaxTransactions,
+	BlockReward:          MiningReward,
+}
+
+// blockLimits 区块大小上限
+func (p ConsensusParams) blockLimits() BlockLimits {
+	return BlockLimits{
+		MaxBytes:        p.MaxBlockBytes,
+		MaxTransactions: p.MaxBlockTransactions,
+		MaxGas:          p.gasTarget() * ElasticityMultiplier,
+	}
+}
+
+// GenesisAlloc 创世时预分配的余额与质押
+type GenesisAlloc struct {
+	Address Address `json:"address"`
+	Balance Amount  `json:"balance"`         // 最小单位
+	Stake   Amount  `json:"stake,omitempty"` // 初始质押（仅权益证明），最小单位
+}
+
+// Genesis 创世配置
+type Genesis struct {
+	ChainID       string          `json:"chain_id"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Consensus     string          `json:"consensus,omitempty"` // 共识：pow（默认）、pos、poa或bft
+	Difficulty    int             `json:"difficulty"`          // 初始POW难度（前导零数量）
+	HashAlgorithm HashAlgorithm   `json:"hash_algorithm"`
+	PoS           *PoSConfig      `json:"pos,omitempty"` // 权益证明参数，consensus为pos时必填
+	PoA           *PoAConfig      `json:"poa,omitempty"` // 权威证明参数，consensus为poa时必填
+	BFT           *BFTConfig      `json:"bft,omitempty"` // 拜占庭容错参数，consensus为bft时必填
+	Params        ConsensusParams `json:"params"`
+	Alloc         []GenesisAlloc  `json:"alloc"`
+}
+
+// devGenesisTime 开发链固定的创世时间
+var devGenesisTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DevGenesis 开发链的创世配置：默认链ID与共识参数，没有预分配
+func DevGenesis(difficulty int) *Genesis {
+	return &Genesis{
+		ChainID:       DefaultChainID,
+		Consensus:     ConsensusPoW,
+		Timestamp:     devGenesisTime,
+		Difficulty:    difficulty,
+		HashAlgorithm: HashSHA256,
+		Params:        DefaultConsensusParams,
+	}
+}
+
+// LoadGenesis 从JSON文件加载创世配置并校验
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g Genesis
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("创世文件格式错误: %w", err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Save 保存创世配置到文件
+func (g *Genesis) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Validate 检查创世配置
+func (g *Genesis) Validate() error {
+	if g.ChainID == "" {
+		return errors.New("创世配置缺少链ID")
+	}
+	if g.Timestamp.IsZero() {
+		return errors.New("创世配置缺少创世时间")
+	}
+	switch g.consensus() {
+	case ConsensusPoW:
+		if g.Difficulty < 1 || g.Difficulty > sha256.Size*2 {
+			return fmt.Errorf("难度%d超出范围[1,%d]", g.Difficulty, sha256.Size*2)
+		}
+	case ConsensusPoS:
+		if g.PoS == nil {
+			return errors.New("权益证明创世配置缺少pos参数")
+		}
+		if err := g.PoS.validate(); err != nil {
+			return err
+		}
+	case ConsensusPoA:
+		if g.PoA == nil {
+			return errors.New("权威证明创世配置缺少poa参数")
+		}
+		if err := g.PoA.validate(); err != nil {
+			return err
+		}
+	case ConsensusBFT:
+		if g.BFT == nil {
+			return errors.New("拜占庭容错创世配置缺少bft参数")
+		}
+		if err := g.BFT.validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的共识: %q", g.Consensus)
+	}
+	if !g.HashAlgorithm.valid() {
+		return fmt.Errorf("不支持的哈希算法: %q", g.HashAlgorithm)
+	}
+	if g.Params.MaxBlockBytes <= 0 || g.Params.MaxBlockTransactions <= 0 {
+		return errors.New("区块大小上限必须为正数")
+	}
+	seen := make(map[Address]bool)
+	var total Amount
+	for i, alloc := range g.Alloc {
+		if alloc.Address.IsZero() || (alloc.Balance == 0 && alloc.Stake == 0) {
+			return fmt.Errorf("第%d项预分配: 地址或金额为空", i)
+		}
+		if alloc.Stake > 0 && g.consensus() != ConsensusPoS {
+			return fmt.Errorf("第%d项预分配: 只有权益证明可以预分配质押", i)
+		}
+		if seen[alloc.Address] {
+			return fmt.Errorf("第%d项预分配: 地址 %s 重复", i, alloc.Address)
+		}
+		seen[alloc.Address] = true
+		var err error
+		if total, err = SumAmounts(total, alloc.Balance, alloc.Stake); err != nil {
+			return fmt.Errorf("预分配合计: %w", err)
+		}
+	}
+	return nil
+}
+
+// consensus 共识名称，未填写时为工作量证明
+func (g *Genesis) consensus() string {
+	if g.Consensus == "" {
+		return ConsensusPoW
+	}
+	return g.Consensus
+}
+
+// configHash 区块头之外的配置（链ID、共识、难度、算法、共识参数）的哈希，
+// 写入创世区块的前一区块哈希字段，使配置不同的网络创世哈希也不同
+func (g *Genesis) configHash() string {
+	config := map[string]interface{}{
+		"chain_id":       g.ChainID,
+		"difficulty":     g.Difficulty,
+		"hash_algorithm": g.HashAlgorithm,
+		"params":         g.Params,
+		"consensus":      g.consensus(),
+	}
+	if g.PoS != nil {
+		config["pos"] = g.PoS
+	}
+	if g.PoA != nil {
+		config["poa"] = g.PoA
+	}
+	if g.BFT != nil {
+		config["bft"] = g.BFT
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Block 生成创世区块：预分配的余额与质押以奖励交易的形式记入区块
+func (g *Genesis) Block() *Block {
+	transactions := make([]*Transaction, 0, len(g.Alloc))
+	add := func(addr Address, amount Amount, kind TxKind) {
+		if amount == 0 {
+			return
+		}
+		tx := NewCoinbaseTransaction(addr, amount, 0)
+		tx.chainID = g.ChainID
+		tx.kind = kind
+		transactions = append(transactions, tx)
+	}
+	for _, alloc := range g.Alloc {
+		add(alloc.Address, alloc.Balance, TxTransfer)
+		add(alloc.Address, alloc.Stake, TxStake)
+	}
+	return newBlockAt(0, g.Timestamp.UnixNano(), 1, g.configHash(), transactions)
+}
+
+// Hash 创世区块哈希
+func (g *Genesis) Hash() string {
+	return g.Block().Hash()
+}
+
+// ------------------------------
+// 命令行：打印创世哈希
+// ------------------------------
+
+// runGenesis 打印创世文件（为空时使用开发链配置）对应的创世哈希
+func runGenesis(path string) error {
+	genesis := DevGenesis(3)
+	if path != "" {
+		var err error
+		if genesis, err = LoadGenesis(path); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("链ID: %s\n", genesis.ChainID)
+	fmt.Printf("创世时间: %s\n", genesis.Timestamp.UTC().Format(time.RFC3339))
+	switch genesis.consensus() {
+	case ConsensusPoS:
+		fmt.Printf("共识: 权益证明（时隙%d秒）\n", genesis.PoS.SlotSeconds)
+	case ConsensusPoA:
+		fmt.Printf("共识: 权威证明（%d个出块者，间隔%d秒）\n", len(genesis.PoA.Signers), genesis.PoA.PeriodSeconds)
+	case ConsensusBFT:
+		fmt.Printf("共识: 拜占庭容错（%d个验证者）\n", len(genesis.BFT.Validators))
+	default:
+		fmt.Printf("共识: 工作量证明，难度%d（%s）\n", genesis.Difficulty, genesis.HashAlgorithm)
+	}
+	fmt.Printf("预分配: %d个地址\n", len(genesis.Alloc))
+	fmt.Printf("创世哈希: %s\n", genesis.Hash())
+	return nil
+}
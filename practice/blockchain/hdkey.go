@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------
+// 分层确定性(HD)密钥派生（BIP32/SLIP-0010风格）
+// ------------------------------
+
+// HardenedOffset 硬化派生的索引起点，路径中以 ' 标记
+const HardenedOffset uint32 = 0x80000000
+
+// DefaultDerivationPath 默认账户路径，第i个密钥为 <路径>/i'
+const DefaultDerivationPath = "m/44'/9000'/0'/0'"
+
+// KeyScheme 派生出的密钥所使用的签名算法
+type KeyScheme int
+
+const (
+	SchemeEd25519 KeyScheme = iota
+	SchemeECDSA
+)
+
+func (s KeyScheme) String() string {
+	switch s {
+	case SchemeEd25519:
+		return "ed25519"
+	case SchemeECDSA:
+		return "ecdsa"
+	default:
+		return fmt.Sprintf("KeyScheme(%d)", int(s))
+	}
+}
+
+// ParseKeyScheme 解析算法名称
+func ParseKeyScheme(name string) (KeyScheme, error) {
+	switch strings.ToLower(name) {
+	case "ed25519":
+		return SchemeEd25519, nil
+	case "ecdsa", "p256":
+		return SchemeECDSA, nil
+	default:
+		return 0, fmt.Errorf("不支持的密钥算法: %s", name)
+	}
+}
+
+// hmacKey 各算法主密钥派生使用的HMAC密钥（与SLIP-0010一致）
+func (s KeyScheme) hmacKey() []byte {
+	if s == SchemeECDSA {
+		return []byte("Nist256p1 seed")
+	}
+	return []byte("ed25519 seed")
+}
+
+// ExtendedKey 扩展私钥：私钥 + 链码，可继续派生子密钥
+type ExtendedKey struct {
+	scheme    KeyScheme
+	key       []byte // 32字节私钥（Ed25519为种子，ECDSA为标量）
+	chainCode []byte // 32字节链码
+	depth     uint8
+	index     uint32
+}
+
+// NewMasterKey 由种子生成主扩展密钥
+func NewMasterKey(seed []byte, scheme KeyScheme) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("种子长度应在16到64字节之间，实际%d字节", len(seed))
+	}
+	data := seed
+	for {
+		il, ir := hmacSHA512(scheme.hmacKey(), data)
+		if scheme != SchemeECDSA || isValidP256Scalar(il) {
+			return &ExtendedKey{scheme: scheme, key: il, chainCode: ir}, nil
+		}
+		// 极小概率得到无效标量，按SLIP-0010以结果重新计算
+		data = append(append([]byte(nil), il...), ir...)
+	}
+}
+
+// Child 派生索引为index的子密钥，index >= HardenedOffset 表示硬化派生
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	hardened := index >= HardenedOffset
+	if k.scheme == SchemeEd25519 && !hardened {
+		return nil, errors.New("Ed25519只支持硬化派生")
+	}
+	if k.depth == 255 {
+		return nil, errors.New("派生深度超过上限")
+	}
+
+	var data []byte
+	if hardened {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		keys, err := newECDSAKeyPairFromScalar(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = keys.PublicKeyBytes()
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	for {
+		il, ir := hmacSHA512(k.chainCode, data)
+		child := &ExtendedKey{scheme: k.scheme, chainCode: ir, depth: k.depth + 1, index: index}
+		if k.scheme == SchemeEd25519 {
+			child.key = il
+			return child, nil
+		}
+
+		// ECDSA：子私钥 = (IL + 父私钥) mod n
+		n := elliptic.P256().Params().N
+		if new(big.Int).SetBytes(il).Cmp(n) < 0 {
+			sum := new(big.Int).Add(new(big.Int).SetBytes(il), new(big.Int).SetBytes(k.key))
+			sum.Mod(sum, n)
+			if sum.Sign() != 0 {
+				child.key = sum.FillBytes(make([]byte, 32))
+				return child, nil
+			}
+		}
+		data = append([]byte{0x01}, ir...)
+		data = binary.BigEndian.AppendUint32(data, index)
+	}
+}
+
+// Derive 按路径（如 m/44'/9000'/0'/0'/1'）逐级派生
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, fmt.Errorf("派生 %s 失败: %w", path, err)
+		}
+	}
+	return key, nil
+}
+
+// KeyPair 将扩展密钥转换为可签名的密钥对
+func (k *ExtendedKey) KeyPair() (KeyPair, error) {
+	if k.scheme == SchemeECDSA {
+		return newECDSAKeyPairFromScalar(k.key)
+	}
+	return newEd25519KeyPairFromSeed(k.key), nil
+}
+
+// 其他必要的getter方法
+func (k *ExtendedKey) Scheme() KeyScheme { return k.scheme }
+func (k *ExtendedKey) Depth() uint8      { return k.depth }
+func (k *ExtendedKey) Index() uint32     { return k.index }
+
+// ParseDerivationPath 解析派生路径，返回各级索引
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("派生路径必须以 m 开头: %q", path)
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(n) >= HardenedOffset {
+			return nil, fmt.Errorf("派生路径中的索引无效: %q", path)
+		}
+		index := uint32(n)
+		if hardened {
+			index += HardenedOffset
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// DeriveAccountKeys 从种子派生默认路径下的前count个密钥
+func DeriveAccountKeys(seed []byte, scheme KeyScheme, count int) ([]KeyPair, error) {
+	master, err := NewMasterKey(seed, scheme)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(DefaultDerivationPath)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]KeyPair, 0, count)
+	for i := 0; i < count; i++ {
+		child, err := account.Child(HardenedOffset + uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		kp, err := child.KeyPair()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, kp)
+	}
+	return keys, nil
+}
+
+func hmacSHA512(key, data []byte) (il, ir []byte) {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+func isValidP256Scalar(b []byte) bool {
+	v := new(big.Int).SetBytes(b)
+	return v.Sign() > 0 && v.Cmp(elliptic.P256().Params().N) < 0
+}
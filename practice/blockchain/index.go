@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ------------------------------
+// 区块与交易索引：按哈希/高度查区块、按交易ID查交易、按地址分页查交易，
+// 以及基准快照之后各地址的序号与收支。区块接入、回滚或并入基准快照时同步更新
+// ------------------------------
+
+// TxLocation 交易在链上的位置
+type TxLocation struct {
+	Transaction *Transaction
+	Block       *Block
+	Position    int // 交易在区块中的序号
+}
+
+// Page 分页参数，Number从0开始
+type Page struct {
+	Number int
+	Size   int
+}
+
+// DefaultPageSize 未指定分页大小时每页的条数
+const DefaultPageSize = 20
+
+// chainIndex 链索引（由Blockchain的锁保护）
+type chainIndex struct {
+	blocks    map[string]*Block
+	txs       map[string]TxLocation
+	addresses map[Address][]TxLocation // 按上链顺序排列
+	accounts  map[Address]*accountDelta
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		blocks:    make(map[string]*Block),
+		txs:       make(map[string]TxLocation),
+		addresses: make(map[Address][]TxLocation),
+		accounts:  make(map[Address]*accountDelta),
+	}
+}
+
+// accountDelta 基准快照之后的区块对账户的累计影响
+type accountDelta struct {
+	nonce    uint64         // 发送的非奖励交易数
+	received Amount         // 入账合计，含未到期的相对时间锁资金
+	spent    Amount         // 支出合计
+	locked   []lockedCredit // 带相对时间锁的入账
+	burned   []lockedCredit // 因双签被惩罚而销毁的解除质押资金，高度为惩罚交易所在区块
+}
+
+// lockedCredit 带相对时间锁的入账及其所在区块的高度
+type lockedCredit struct {
+	height int
+	LockedAmount
+}
+
+// spendableAt 在基准快照中可花费的base之上，计算在指定高度的区块中可花费的余额
+func (d *accountDelta) spendableAt(base Amount, height int) (Amount, error) {
+	if d == nil {
+		return base, nil
+	}
+	balance, err := base.Add(d.received)
+	if err != nil {
+		return 0, err
+	}
+	for _, locked := range d.locked {
+		if locked.UnlockHeight > height {
+			if balance, err = balance.Sub(locked.Amount); err != nil {
+				return 0, err
+			}
+		}
+	}
+	// 销毁的资金仍记在基准快照或locked中，到期后才会被计入，此时扣除
+	for _, burned := range d.burned {
+		if burned.UnlockHeight <= height {
+			if balance, err = balance.Sub(burned.Amount); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return balance.Sub(d.spent)
+}
+
+// account 返回地址的累计影响，不存在时创建
+func (idx *chainIndex) account(addr Address) *accountDelta {
+	d, ok := idx.accounts[addr]
+	if !ok {
+		d = &accountDelta{}
+		idx.accounts[addr] = d
+	}
+	return d
+}
+
+// connect 区块接入链尾时建立索引，base为当前的基准快照
+func (idx *chainIndex) connect(block *Block, base *StateSnapshot) {
+	idx.blocks[block.Hash()] = block
+	for i, tx := range block.Transactions() {
+		loc := TxLocation{Transaction: tx, Block: block, Position: i}
+		idx.txs[tx.ID()] = loc
+		for _, addr := range txAddresses(tx) {
+			idx.addresses[addr] = append(idx.addresses[addr], loc)
+		}
+	}
+	idx.applyAccounts(block, base)
+}
+
+// applyAccounts 累加区块中交易对各地址序号与收支的影响；区块已通过校验，计算出错说明链数据已损坏
+func (idx *chainIndex) applyAccounts(block *Block, base *StateSnapshot) {
+	for _, tx := range block.Transactions() {
+		if credit := tx.Credit(); credit > 0 {
+			d := idx.account(tx.Recipient())
+			d.received = mustBalance(d.received.Add(credit))
+			if tx.RelativeLock() > 0 {
+				d.locked = append(d.locked, lockedCredit{height: block.Index(), LockedAmount: LockedAmount{
+					UnlockHeight: block.Index() + tx.RelativeLock(),
+					Amount:       credit,
+					Unbonding:    tx.Kind() == TxUnstake,
+				}})
+			}
+		}
+		if tx.Kind() == TxSlash {
+			idx.burnUnbonding(tx, block.Index(), base)
+		}
+		if !tx.IsCoinbase() {
+			d := idx.account(tx.Sender())
+			d.nonce++
+			d.spent = mustBalance(d.spent.Add(mustBalance(tx.CostAt(block.BaseFee()))))
+		}
+	}
+}
+
+// burnUnbonding 记录惩罚交易销毁的被举报者尚未到期的解除质押资金
+func (idx *chainIndex) burnUnbonding(tx *Transaction, height int, base *StateSnapshot) {
+	offender, err := tx.Evidence().offender()
+	if err != nil {
+		panic(fmt.Sprintf("链上惩罚交易无效: %v", err))
+	}
+	d := idx.account(offender)
+	pending := unbondingAfter(base.Account(offender).Locked, height)
+	for _, l := range d.locked {
+		if l.Unbonding && l.UnlockHeight > height {
+			pending = append(pending, l.LockedAmount)
+		}
+	}
+	for _, l := range pending {
+		d.burned = append(d.burned, lockedCredit{height: height, LockedAmount: l})
+	}
+	idx.dropEmpty(offender)
+}
+
+// revertAccounts 撤销区块中交易对各地址序号与收支的影响（区块回滚或并入基准快照）
+func (idx *chainIndex) revertAccounts(block *Block) {
+	for _, tx := range block.Transactions() {
+		if credit := tx.Credit(); credit > 0 {
+			d := idx.account(tx.Recipient())
+			d.received = mustBalance(d.received.Sub(credit))
+			d.locked = slices.DeleteFunc(d.locked, func(l lockedCredit) bool { return l.height == block.Index() })
+			idx.dropEmpty(tx.Recipient())
+		}
+		if !tx.IsCoinbase() {
+			d := idx.account(tx.Sender())
+			d.nonce--
+			d.spent = mustBalance(d.spent.Sub(mustBalance(tx.CostAt(block.BaseFee()))))
+			idx.dropEmpty(tx.Sender())
+		}
+		if tx.Kind() == TxSlash {
+			offender, _ := tx.Evidence().offender()
+			d := idx.account(offender)
+			d.burned = slices.DeleteFunc(d.burned, func(l lockedCredit) bool { return l.height == block.Index() })
+			idx.dropEmpty(offender)
+		}
+	}
+}
+
+func (idx *chainIndex) dropEmpty(addr Address) {
+	if d := idx.accounts[addr]; d.nonce == 0 && d.received == 0 && d.spent == 0 && len(d.locked) == 0 && len(d.burned) == 0 {
+		delete(idx.accounts, addr)
+	}
+}
+
+// prune 区块体被裁剪时删除其交易索引，区块中的交易必然位于各地址列表开头；
+// 区块已并入基准快照，一并撤销其对账户的影响
+func (idx *chainIndex) prune(block *Block) {
+	idx.revertAccounts(block)
+	for _, tx := range block.Transactions() {
+		delete(idx.txs, tx.ID())
+		for _, addr := range txAddresses(tx) {
+			list := idx.addresses[addr]
+			if len(list) <= 1 {
+				delete(idx.addresses, addr)
+				continue
+			}
+			idx.addresses[addr] = list[1:]
+		}
+	}
+}
+
+// disconnect 链尾区块回滚时删除索引，区块中的交易必然位于各地址列表末尾
+func (idx *chainIndex) disconnect(block *Block) {
+	idx.revertAccounts(block)
+	delete(idx.blocks, block.Hash())
+	txs := block.Transactions()
+	for i := len(txs) - 1; i >= 0; i-- {
+		delete(idx.txs, txs[i].ID())
+		for _, addr := range txAddresses(txs[i]) {
+			list := idx.addresses[addr]
+			if len(list) <= 1 {
+				delete(idx.addresses, addr)
+				continue
+			}
+			idx.addresses[addr] = list[:len(list)-1]
+		}
+	}
+}
+
+// txAddresses 交易涉及的地址（去重，挖矿奖励只有收款方）
+func txAddresses(tx *Transaction) []Address {
+	if tx.IsCoinbase() || tx.Sender() == tx.Recipient() {
+		return []Address{tx.Recipient()}
+	}
+	return []Address{tx.Sender(), tx.Recipient()}
+}
+
+// 查询错误
+var (
+	ErrBlockNotFound = errors.New("区块不存在")
+	ErrTxNotFound    = errors.New("交易不存在")
+)
+
+// GetBlockByHash 按区块哈希查询，区块体已裁剪时返回ErrPruned
+func (bc *Blockchain) GetBlockByHash(hash string) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	block, ok := bc.index.blocks[hash]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return checkPruned(block)
+}
+
+// GetBlockByHeight 按高度查询，区块体已裁剪时返回ErrPruned
+func (bc *Blockchain) GetBlockByHeight(height int) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 0 || height >= len(bc.chain) {
+		return nil, ErrBlockNotFound
+	}
+	return checkPruned(bc.chain[height])
+}
+
+func checkPruned(block *Block) (*Block, error) {
+	if block.IsPruned() {
+		return nil, fmt.Errorf("%w: 区块%d只保留了区块头", ErrPruned, block.Index())
+	}
+	return block, nil
+}
+
+// GetHeaderByHeight 按高度查询区块头（区块体裁剪后区块头仍保留）
+func (bc *Blockchain) GetHeaderByHeight(height int) (BlockHeader, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 0 || height >= len(bc.chain) {
+		return BlockHeader{}, false
+	}
+	return bc.chain[height].Header(), true
+}
+
+// GetTransaction 按交易ID查询已上链的交易及其所在区块和位置；
+// 有区块体被裁剪时，查不到的交易可能位于已裁剪的区块中，返回ErrPruned
+func (bc *Blockchain) GetTransaction(txid string) (TxLocation, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if loc, ok := bc.index.txs[txid]; ok {
+		return loc, nil
+	}
+	if bc.prunedHeight >= 0 {
+		return TxLocation{}, fmt.Errorf("%w: 高度%d之后的区块中没有交易 %s，更早的区块体已裁剪", ErrPruned, bc.prunedHeight, txid)
+	}
+	return TxLocation{}, ErrTxNotFound
+}
+
+// GetTransactionsByAddress 分页查询地址相关的已上链交易（最新的在前），同时返回总数；
+// 有区块体被裁剪时只统计未裁剪的区块，翻页超出范围时返回ErrPruned
+func (bc *Blockchain) GetTransactionsByAddress(addr Address, page Page) ([]TxLocation, int, error) {
+	if page.Number < 0 || page.Size < 0 {
+		return nil, 0, errors.New("分页参数不能为负数")
+	}
+	if page.Size == 0 {
+		page.Size = DefaultPageSize
+	}
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	list := bc.index.addresses[addr]
+	total := len(list)
+	// 先用除法判断页码是否越界，避免页码过大时乘法溢出
+	if total == 0 || page.Number > (total-1)/page.Size {
+		if bc.prunedHeight >= 0 {
+			return nil, total, fmt.Errorf("%w: 高度%d及以下区块中的交易无法查询", ErrPruned, bc.prunedHeight)
+		}
+		return nil, total, nil
+	}
+	start := page.Number * page.Size
+	end := total
+	if page.Size < total-start {
+		end = start + page.Size
+	}
+	result := make([]TxLocation, 0, end-start)
+	for i := start; i < end; i++ {
+		result = append(result, list[total-1-i])
+	}
+	return result, total, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ------------------------------
+// 通用密钥接口封装
+// ------------------------------
+
+// KeyPair 各类签名密钥（RSA、Ed25519、ECDSA）的公共接口
+type KeyPair interface {
+	Sign(data []byte) ([]byte, error)
+	Verify(data []byte, signature []byte) error
+	PublicKeyBytes() []byte
+	Address() Address
+}
+
+// 编译期检查各密钥类型实现了KeyPair接口
+var (
+	_ KeyPair = (*RSAKeyPair)(nil)
+	_ KeyPair = (*Ed25519KeyPair)(nil)
+	_ KeyPair = (*ECDSAKeyPair)(nil)
+)
+
+// 公钥字节格式：Ed25519为32字节，ECDSA(P-256)为33字节压缩点，RSA为PKCS#1 DER
+const (
+	ed25519PublicKeyLen = ed25519.PublicKeySize
+	ecdsaPublicKeyLen   = 33
+)
+
+// VerifySignature 根据公钥格式自动选择算法验证签名
+func VerifySignature(publicKey, data, signature []byte) error {
+	switch {
+	case len(publicKey) == ed25519PublicKeyLen:
+		if !ed25519.Verify(ed25519.PublicKey(publicKey), data, signature) {
+			return errors.New("Ed25519签名验证失败")
+		}
+		return nil
+	case len(publicKey) == ecdsaPublicKeyLen && (publicKey[0] == 0x02 || publicKey[0] == 0x03):
+		pub, err := decompressP256(publicKey)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, hash[:], signature) {
+			return errors.New("ECDSA签名验证失败")
+		}
+		return nil
+	default:
+		pub, err := x509.ParsePKCS1PublicKey(publicKey)
+		if err != nil {
+			return fmt.Errorf("无法识别的公钥格式: %w", err)
+		}
+		return (&RSAKeyPair{publicKey: pub}).Verify(data, signature)
+	}
+}
+
+// ------------------------------
+// Ed25519密钥
+// ------------------------------
+
+// Ed25519KeyPair Ed25519密钥对
+type Ed25519KeyPair struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewEd25519KeyPair 随机生成Ed25519密钥对
+func NewEd25519KeyPair() (*Ed25519KeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Ed25519KeyPair{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// newEd25519KeyPairFromSeed 由32字节种子确定性地生成密钥对
+func newEd25519KeyPairFromSeed(seed []byte) *Ed25519KeyPair {
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	return &Ed25519KeyPair{
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+}
+
+func (k *Ed25519KeyPair) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(k.privateKey, data), nil
+}
+
+func (k *Ed25519KeyPair) Verify(data []byte, signature []byte) error {
+	return VerifySignature(k.publicKey, data, signature)
+}
+
+func (k *Ed25519KeyPair) PublicKeyBytes() []byte { return append([]byte(nil), k.publicKey...) }
+func (k *Ed25519KeyPair) Address() Address       { return NewAddressFromPublicKey(k.publicKey) }
+
+// ------------------------------
+// ECDSA(P-256)密钥
+// ------------------------------
+
+// ECDSAKeyPair P-256曲线上的ECDSA密钥对
+type ECDSAKeyPair struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  []byte // 33字节压缩点
+}
+
+// NewECDSAKeyPair 随机生成ECDSA密钥对
+func NewECDSAKeyPair() (*ECDSAKeyPair, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newECDSAKeyPair(privateKey)
+}
+
+// newECDSAKeyPairFromScalar 由32字节私钥标量生成密钥对
+func newECDSAKeyPairFromScalar(scalar []byte) (*ECDSAKeyPair, error) {
+	privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), scalar)
+	if err != nil {
+		return nil, err
+	}
+	return newECDSAKeyPair(privateKey)
+}
+
+func newECDSAKeyPair(privateKey *ecdsa.PrivateKey) (*ECDSAKeyPair, error) {
+	uncompressed, err := privateKey.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return &ECDSAKeyPair{privateKey: privateKey, publicKey: compressP256(uncompressed)}, nil
+}
+
+func (k *ECDSAKeyPair) Sign(data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, k.privateKey, hash[:])
+}
+
+func (k *ECDSAKeyPair) Verify(data []byte, signature []byte) error {
+	return VerifySignature(k.publicKey, data, signature)
+}
+
+func (k *ECDSAKeyPair) PublicKeyBytes() []byte { return append([]byte(nil), k.publicKey...) }
+func (k *ECDSAKeyPair) Address() Address       { return NewAddressFromPublicKey(k.publicKey) }
+
+// compressP256 将65字节非压缩点（04||X||Y）转换为33字节压缩点
+func compressP256(uncompressed []byte) []byte {
+	out := make([]byte, ecdsaPublicKeyLen)
+	out[0] = 0x02 | (uncompressed[64] & 1)
+	copy(out[1:], uncompressed[1:33])
+	return out
+}
+
+// decompressP256 将33字节压缩点还原为ECDSA公钥
+func decompressP256(compressed []byte) (*ecdsa.PublicKey, error) {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), compressed)
+	if x == nil {
+		return nil, errors.New("无效的P-256压缩公钥")
+	}
+	uncompressed := make([]byte, 65)
+	uncompressed[0] = 0x04
+	x.FillBytes(uncompressed[1:33])
+	y.FillBytes(uncompressed[33:])
+	return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), uncompressed)
+}
+
+// ------------------------------
+// 密钥文件读写
+// ------------------------------
+
+// SaveKeyPair 以PEM格式保存私钥（RSA为PKCS#1，其余为PKCS#8）
+func SaveKeyPair(k KeyPair, path string) error {
+	block, err := marshalPrivateKeyPEM(k)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+// LoadKeyPair 从PEM文件加载任意受支持类型的私钥
+func LoadKeyPair(path string) (KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// marshalPrivateKeyPEM 将私钥编码为PEM块
+func marshalPrivateKeyPEM(k KeyPair) (*pem.Block, error) {
+	switch key := k.(type) {
+	case *RSAKeyPair:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key.privateKey)}, nil
+	case *Ed25519KeyPair:
+		der, err := x509.MarshalPKCS8PrivateKey(key.privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+	case *ECDSAKeyPair:
+		der, err := x509.MarshalPKCS8PrivateKey(key.privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+	default:
+		return nil, fmt.Errorf("不支持保存的密钥类型 %T", k)
+	}
+}
+
+// parsePrivateKeyPEM 解析PEM编码的私钥
+func parsePrivateKeyPEM(data []byte) (KeyPair, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("不是有效的PEM数据")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("解析私钥失败: %w", err)
+		}
+		return &RSAKeyPair{privateKey: privateKey, publicKey: &privateKey.PublicKey}, nil
+	case "PRIVATE KEY":
+		return parsePKCS8KeyPair(block.Bytes)
+	default:
+		return nil, fmt.Errorf("不是私钥（类型: %s）", block.Type)
+	}
+}
+
+// parsePKCS8KeyPair 解析PKCS#8编码的Ed25519或ECDSA私钥
+func parsePKCS8KeyPair(der []byte) (KeyPair, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %w", err)
+	}
+	switch priv := key.(type) {
+	case ed25519.PrivateKey:
+		return &Ed25519KeyPair{privateKey: priv, publicKey: priv.Public().(ed25519.PublicKey)}, nil
+	case *ecdsa.PrivateKey:
+		if priv.Curve != elliptic.P256() {
+			return nil, errors.New("仅支持P-256曲线的ECDSA私钥")
+		}
+		return newECDSAKeyPair(priv)
+	default:
+		return nil, fmt.Errorf("不支持的私钥类型 %T", key)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ------------------------------
+// 命令行入口：go run . <命令> [参数]
+// ------------------------------
+
+func usage() {
+	fmt.Println("用法: go run . <命令> [参数]")
+	fmt.Println("  chain                           演示交易打包与挖矿（默认）")
+	fmt.Println("  pow                             演示不同难度的POW计算")
+	fmt.Println("  rsa                             演示POW与RSA签名")
+	fmt.Println("  multisig                        演示2-of-3多签金库")
+	fmt.Println("  timelock                        演示归属期与托管时间锁")
+	fmt.Println("  spv                             演示轻节点同步区块头并验证支付")
+	fmt.Println("  snapshot                        演示区块体裁剪与从状态快照引导新节点")
+	fmt.Println("  pos                             演示权益证明出块、质押与双签惩罚")
+	fmt.Println("  poa                             演示权威证明轮值出块与投票增加出块者")
+	fmt.Println("  bft                             演示拜占庭容错共识容忍一个故障验证者")
+	fmt.Println("  contract                        演示部署并调用计数器合约")
+	fmt.Println("  feemarket                       演示基础费用随区块gas用量调整与手续费估算")
+	fmt.Println("  genesis [创世文件]               打印创世哈希（默认使用开发链配置）")
+	fmt.Println("  explorer [地址]                  生成示例链并启动区块浏览器（默认 :8080）")
+	fmt.Println("  address <密钥文件>               打印PEM密钥文件（私钥或公钥）对应的地址")
+	fmt.Println("  mnemonic new [选项]              生成助记词并打印派生出的地址")
+	fmt.Println("  mnemonic restore [选项] <助记词>  从助记词恢复全部密钥并保存为PEM文件")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		runChainDemo()
+		return
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "chain":
+		runChainDemo()
+	case "pow":
+		runPowDemo()
+	case "rsa":
+		runRSADemo()
+	case "multisig":
+		runMultisigDemo()
+	case "timelock":
+		runTimeLockDemo()
+	case "spv":
+		runSPVDemo()
+	case "snapshot":
+		runSnapshotDemo()
+	case "pos":
+		runPoSDemo()
+	case "poa":
+		runPoADemo()
+	case "bft":
+		runBFTDemo()
+	case "contract":
+		runContractDemo()
+	case "feemarket":
+		runFeeMarketDemo()
+	case "genesis":
+		path := ""
+		if len(os.Args) > 2 {
+			path = os.Args[2]
+		}
+		err = runGenesis(path)
+	case "explorer":
+		listen := ":8080"
+		if len(os.Args) > 2 {
+			listen = os.Args[2]
+		}
+		err = runExplorer(listen)
+	case "address":
+		if len(os.Args) != 3 {
+			usage()
+			os.Exit(2)
+		}
+		err = printAddress(os.Args[2])
+	case "mnemonic":
+		err = runMnemonicCommand(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printAddress 打印密钥文件对应的地址
+func printAddress(keyFile string) error {
+	publicKey, err := LoadPublicKeyBytes(keyFile)
+	if err != nil {
+		return err
+	}
+	fmt.Println(NewAddressFromPublicKey(publicKey))
+	return nil
+}
+
+// runMnemonicCommand 处理 mnemonic new / restore 子命令
+func runMnemonicCommand(args []string) error {
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("mnemonic "+args[0], flag.ExitOnError)
+	schemeName := fs.String("scheme", "ed25519", "密钥算法: ed25519 或 ecdsa")
+	count := fs.Int("n", 3, "派生的密钥数量")
+	passphrase := fs.String("passphrase", "", "可选的助记词口令")
+	bits := fs.Int("bits", 128, "熵长度（仅new）")
+	outDir := fs.String("out", "", "保存私钥PEM文件的目录（仅restore，为空则只打印地址）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	scheme, err := ParseKeyScheme(*schemeName)
+	if err != nil {
+		return err
+	}
+
+	var mnemonic string
+	switch args[0] {
+	case "new":
+		if mnemonic, err = NewMnemonic(*bits); err != nil {
+			return err
+		}
+		fmt.Println("助记词（请妥善备份，凭此可恢复全部密钥）:")
+		fmt.Println(mnemonic)
+	case "restore":
+		mnemonic = strings.Join(fs.Args(), " ")
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	seed, err := MnemonicToSeed(mnemonic, *passphrase)
+	if err != nil {
+		return err
+	}
+	keys, err := DeriveAccountKeys(seed, scheme, *count)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		fmt.Printf("%s/%d' %s\n", DefaultDerivationPath, i, k.Address())
+		if *outDir == "" {
+			continue
+		}
+		path := filepath.Join(*outDir, fmt.Sprintf("key_%d.pem", i))
+		if err := SaveKeyPair(k, path); err != nil {
+			return err
+		}
+		fmt.Printf("  已保存至 %s\n", path)
+	}
+	return nil
+}
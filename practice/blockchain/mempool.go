@@ -0,0 +1,360 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ------------------------------
+// 交易池：入池校验、按交易ID去重、容量限制与低手续费淘汰、单发送方限制、过期清理；
+// 出块时按每单位gas的实际小费从高到低挑选交易
+// ------------------------------
+
+// MempoolConfig 交易池限制
+type MempoolConfig struct {
+	MaxCount     int           // 最多容纳的交易数
+	MaxBytes     int           // 全部交易序列化后的最大总字节数
+	MaxPerSender int           // 单个发送方最多的交易数（含等待队列）
+	Expiry       time.Duration // 交易在池中的最长停留时间，0表示不过期
+}
+
+// DefaultMempoolConfig 默认交易池限制
+var DefaultMempoolConfig = MempoolConfig{
+	MaxCount:     5000,
+	MaxBytes:     8 << 20,
+	MaxPerSender: 64,
+	Expiry:       3 * time.Hour,
+}
+
+// TxValidator 入池校验：返回queued=true表示交易有效但序号超前，需进入等待队列
+type TxValidator func(tx *Transaction) (queued bool, err error)
+
+// mempoolEntry 池中的一笔交易
+type mempoolEntry struct {
+	tx     *Transaction
+	id     string
+	size   int
+	added  time.Time
+	seq    uint64 // 入池顺序，用于稳定排序
+	queued bool   // 是否在等待队列（序号超前）
+}
+
+// feeRate 每单位gas的最高手续费
+func (e *mempoolEntry) feeRate() float64 {
+	return float64(e.tx.Fee()) / float64(e.tx.Gas())
+}
+
+// Mempool 交易池，可并发使用
+type Mempool struct {
+	mu       sync.Mutex
+	config   MempoolConfig
+	validate TxValidator
+	entries  map[string]*mempoolEntry
+	bytes    int
+	nextSeq  uint64
+	clock    Clock
+}
+
+// NewMempool 创建交易池，validate在每笔交易入池时调用
+func NewMempool(config MempoolConfig, validate TxValidator) *Mempool {
+	return &Mempool{
+		config:   config,
+		validate: validate,
+		entries:  make(map[string]*mempoolEntry),
+		clock:    SystemClock,
+	}
+}
+
+// SetClock 替换时间来源（用于入池时间与过期判断）
+func (m *Mempool) SetClock(clock Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock
+}
+
+// 交易池错误
+var (
+	ErrTxAlreadyKnown = errors.New("交易已在交易池中")
+	ErrMempoolFull    = errors.New("交易池已满且手续费率过低")
+)
+
+// Add 校验并加入交易，池满时淘汰手续费率最低的交易
+func (m *Mempool) Add(tx *Transaction) error {
+	id := tx.ID()
+	m.mu.Lock()
+	m.expire()
+	_, known := m.entries[id]
+	count := m.senderCount(tx.Sender())
+	m.mu.Unlock()
+
+	if known {
+		return ErrTxAlreadyKnown
+	}
+	if m.config.MaxPerSender > 0 && count >= m.config.MaxPerSender {
+		return fmt.Errorf("发送方 %s 在交易池中的交易数已达上限%d", tx.Sender(), m.config.MaxPerSender)
+	}
+	// 校验时不持锁，校验函数可能需要查询交易池
+	queued, err := m.validate(tx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[id]; ok {
+		return ErrTxAlreadyKnown
+	}
+	entry := &mempoolEntry{tx: tx, id: id, size: tx.Size(), added: m.clock.Now(), seq: m.nextSeq, queued: queued}
+	if m.config.MaxBytes > 0 && entry.size > m.config.MaxBytes {
+		return fmt.Errorf("交易过大: %d字节", entry.size)
+	}
+	if err := m.makeRoom(entry); err != nil {
+		return err
+	}
+	m.nextSeq++
+	m.entries[id] = entry
+	m.bytes += entry.size
+	return nil
+}
+
+// makeRoom 超出数量或字节限制时，淘汰手续费率低于新交易的交易
+func (m *Mempool) makeRoom(incoming *mempoolEntry) error {
+	for m.overLimit(incoming.size) {
+		victim := m.lowestFeeRate()
+		if victim == nil || victim.feeRate() >= incoming.feeRate() {
+			return ErrMempoolFull
+		}
+		m.evict(victim)
+	}
+	return nil
+}
+
+func (m *Mempool) overLimit(extraBytes int) bool {
+	if m.config.MaxCount > 0 && len(m.entries)+1 > m.config.MaxCount {
+		return true
+	}
+	return m.config.MaxBytes > 0 && m.bytes+extraBytes > m.config.MaxBytes
+}
+
+// lowestFeeRate 找出手续费率最低的交易，同费率时淘汰较晚入池的
+func (m *Mempool) lowestFeeRate() *mempoolEntry {
+	var lowest *mempoolEntry
+	for _, e := range m.entries {
+		if lowest == nil || e.feeRate() < lowest.feeRate() ||
+			(e.feeRate() == lowest.feeRate() && e.seq > lowest.seq) {
+			lowest = e
+		}
+	}
+	return lowest
+}
+
+// evict 淘汰交易及同一发送方序号更大的交易（它们已无法按序打包）
+func (m *Mempool) evict(victim *mempoolEntry) {
+	for id, e := range m.entries {
+		if e.tx.Sender() == victim.tx.Sender() && e.tx.Nonce() >= victim.tx.Nonce() {
+			m.remove(id)
+		}
+	}
+}
+
+func (m *Mempool) remove(id string) {
+	if e, ok := m.entries[id]; ok {
+		m.bytes -= e.size
+		delete(m.entries, id)
+	}
+}
+
+// Expire 清理超过停留时间的交易
+func (m *Mempool) Expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+}
+
+func (m *Mempool) expire() {
+	if m.config.Expiry <= 0 {
+		return
+	}
+	deadline := m.clock.Now().Add(-m.config.Expiry)
+	for _, e := range m.sorted(func(*mempoolEntry) bool { return true }) {
+		if _, ok := m.entries[e.id]; ok && e.added.Before(deadline) {
+			m.evict(e)
+		}
+	}
+}
+
+// Remove 按交易ID移除（如已被打包）
+func (m *Mempool) Remove(txids []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range txids {
+		m.remove(id)
+	}
+}
+
+// Get 按交易ID查询
+func (m *Mempool) Get(txid string) (*Transaction, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[txid]
+	if !ok {
+		return nil, false
+	}
+	return e.tx, true
+}
+
+// Pending 可直接打包的交易，按入池顺序排列
+func (m *Mempool) Pending() []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return entryTxs(m.sorted(func(e *mempoolEntry) bool { return !e.queued }))
+}
+
+// Queued 序号超前、等待前序交易的交易
+func (m *Mempool) Queued() []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return entryTxs(m.sorted(func(e *mempoolEntry) bool { return e.queued }))
+}
+
+// Count 交易数
+func (m *Mempool) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Bytes 交易总字节数
+func (m *Mempool) Bytes() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bytes
+}
+
+// BlockTemplate 从可打包交易中按基础费用为baseFee时每单位gas的实际小费从高到低挑选，
+// 至多maxCount笔、合计至多maxBytes字节。
+// 同一发送方的交易按序号依次参与排序：前序交易入选后，下一笔才成为候选。
+// include用于判断交易在本区块中能否打包（如时间锁、序号连续性、最高手续费与剩余gas），
+// 交易被跳过或放不下时，该发送方后续的交易也不再打包，留在池中
+func (m *Mempool) BlockTemplate(maxCount, maxBytes int, baseFee Amount, include func(*Transaction) bool) []*Transaction {
+	m.mu.Lock()
+	bySender := make(map[Address][]*mempoolEntry)
+	for _, e := range m.sorted(func(e *mempoolEntry) bool { return !e.queued }) {
+		bySender[e.tx.Sender()] = append(bySender[e.tx.Sender()], e)
+	}
+	m.mu.Unlock()
+
+	candidates := make(tipHeap, 0, len(bySender))
+	for sender, list := range bySender {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].tx.Nonce() < list[j].tx.Nonce() })
+		candidates = append(candidates, newTipCandidate(list[0], baseFee))
+		bySender[sender] = list[1:]
+	}
+	heap.Init(&candidates)
+
+	var selected []*Transaction
+	for candidates.Len() > 0 && len(selected) < maxCount {
+		e := heap.Pop(&candidates).(tipCandidate).entry
+		if e.size > maxBytes || !include(e.tx) {
+			continue
+		}
+		selected = append(selected, e.tx)
+		maxBytes -= e.size
+		if rest := bySender[e.tx.Sender()]; len(rest) > 0 {
+			heap.Push(&candidates, newTipCandidate(rest[0], baseFee))
+			bySender[e.tx.Sender()] = rest[1:]
+		}
+	}
+	return selected
+}
+
+// tipCandidate 出块候选交易及其每单位gas的实际小费
+type tipCandidate struct {
+	entry     *mempoolEntry
+	tipPerGas float64
+}
+
+// newTipCandidate 最高手续费不足以支付基础费用的交易小费记为-1，排在最后
+func newTipCandidate(e *mempoolEntry, baseFee Amount) tipCandidate {
+	_, tip, err := e.tx.feesAt(baseFee)
+	if err != nil {
+		return tipCandidate{entry: e, tipPerGas: -1}
+	}
+	return tipCandidate{entry: e, tipPerGas: float64(tip) / float64(e.tx.Gas())}
+}
+
+// tipHeap 按每单位gas实际小费排列的候选交易，小费相同时先入池的优先
+type tipHeap []tipCandidate
+
+func (h tipHeap) Len() int { return len(h) }
+func (h tipHeap) Less(i, j int) bool {
+	if h[i].tipPerGas != h[j].tipPerGas {
+		return h[i].tipPerGas > h[j].tipPerGas
+	}
+	return h[i].entry.seq < h[j].entry.seq
+}
+func (h tipHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *tipHeap) Push(x interface{}) { *h = append(*h, x.(tipCandidate)) }
+func (h *tipHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// promote 将等待队列中的交易转为可打包，排在当前所有交易之后
+func (m *Mempool) promote(txid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[txid]; ok && e.queued {
+		e.queued = false
+		e.seq = m.nextSeq
+		m.nextSeq++
+	}
+}
+
+// find 按发送方与序号查找交易，返回交易及其是否在等待队列
+func (m *Mempool) find(sender Address, nonce uint64) (tx *Transaction, queued bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if e.tx.Sender() == sender && e.tx.Nonce() == nonce {
+			return e.tx, e.queued
+		}
+	}
+	return nil, false
+}
+
+func (m *Mempool) senderCount(sender Address) int {
+	n := 0
+	for _, e := range m.entries {
+		if e.tx.Sender() == sender {
+			n++
+		}
+	}
+	return n
+}
+
+// sorted 按入池顺序返回满足条件的条目
+func (m *Mempool) sorted(keep func(*mempoolEntry) bool) []*mempoolEntry {
+	list := make([]*mempoolEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		if keep(e) {
+			list = append(list, e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+	return list
+}
+
+func entryTxs(entries []*mempoolEntry) []*Transaction {
+	txs := make([]*Transaction, 0, len(entries))
+	for _, e := range entries {
+		txs = append(txs, e.tx)
+	}
+	return txs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ------------------------------
+// Merkle树：区块头以交易ID的Merkle根承诺区块内全部交易，
+// 轻节点凭包含证明即可确认交易在区块中，无需下载区块体
+// ------------------------------
+
+// emptyMerkleRoot 没有交易时的Merkle根
+var emptyMerkleRoot = hex.EncodeToString(make([]byte, sha256.Size))
+
+// MerkleRoot 计算交易ID列表的Merkle根；某层节点数为奇数时复制最后一个节点
+func MerkleRoot(txids []string) string {
+	if len(txids) == 0 {
+		return emptyMerkleRoot
+	}
+	level, err := decodeHashes(txids)
+	if err != nil {
+		panic(err)
+	}
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// MerkleProof 交易的Merkle包含证明：从叶子到根路径上每一层的兄弟节点
+type MerkleProof struct {
+	TxID     string   `json:"txid"`
+	Position int      `json:"position"` // 交易在区块中的序号，决定每层兄弟节点在左还是在右
+	Siblings []string `json:"siblings"`
+}
+
+// NewMerkleProof 为第position笔交易生成包含证明
+func NewMerkleProof(txids []string, position int) (MerkleProof, error) {
+	if position < 0 || position >= len(txids) {
+		return MerkleProof{}, fmt.Errorf("交易序号%d超出范围[0,%d)", position, len(txids))
+	}
+	level, err := decodeHashes(txids)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	proof := MerkleProof{TxID: txids[position], Position: position}
+	for i := position; len(level) > 1; i /= 2 {
+		sibling := i ^ 1
+		if sibling >= len(level) {
+			sibling = i
+		}
+		proof.Siblings = append(proof.Siblings, hex.EncodeToString(level[sibling]))
+		level = nextMerkleLevel(level)
+	}
+	return proof, nil
+}
+
+// Verify 检查证明能否从交易ID还原出给定的Merkle根
+func (p MerkleProof) Verify(root string) error {
+	if len(p.Siblings) > 32 || p.Position < 0 || p.Position >= 1<<len(p.Siblings) {
+		return errors.New("Merkle证明的交易序号与路径长度不符")
+	}
+	hashes, err := decodeHashes(append([]string{p.TxID}, p.Siblings...))
+	if err != nil {
+		return err
+	}
+	node, i := hashes[0], p.Position
+	for _, sibling := range hashes[1:] {
+		if i%2 == 0 {
+			node = hashPair(node, sibling)
+		} else {
+			node = hashPair(sibling, node)
+		}
+		i /= 2
+	}
+	if hex.EncodeToString(node) != root {
+		return errors.New("Merkle证明与区块头的Merkle根不符")
+	}
+	return nil
+}
+
+func nextMerkleLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		next = append(next, hashPair(level[i], right))
+	}
+	return next
+}
+
+func hashPair(left, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte(nil), left...), right...))
+	return sum[:]
+}
+
+func decodeHashes(hexes []string) ([][]byte, error) {
+	hashes := make([][]byte, len(hexes))
+	for i, h := range hexes {
+		b, err := hex.DecodeString(h)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("哈希格式错误: %q", h)
+		}
+		hashes[i] = b
+	}
+	return hashes, nil
+}
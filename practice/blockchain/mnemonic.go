@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"strings"
+)
+
+// ------------------------------
+// 助记词编码（BIP39风格，使用自有词表）
+// ------------------------------
+
+// mnemonicWordList 2048个词的词表，由 辅音+元音+辅音+元音 组合生成（如 "baka"、"zipo"），
+// 每个词对应11比特，便于抄写且不依赖外部词表文件
+var mnemonicWordList, mnemonicWordIndex = func() ([]string, map[string]int) {
+	const (
+		consonants = "bdfghjklmnprstvz" // 16个
+		vowels     = "aeio"             // 4个
+		endings    = "ao"               // 2个
+	)
+	words := make([]string, 0, 2048)
+	for _, c1 := range consonants {
+		for _, v1 := range vowels {
+			for _, c2 := range consonants {
+				for _, v2 := range endings {
+					words = append(words, string([]rune{c1, v1, c2, v2}))
+				}
+			}
+		}
+	}
+	index := make(map[string]int, len(words))
+	for i, w := range words {
+		index[w] = i
+	}
+	return words, index
+}()
+
+// NewMnemonic 生成指定熵长度（128~256比特，32的倍数）的随机助记词
+func NewMnemonic(entropyBits int) (string, error) {
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", fmt.Errorf("熵长度必须为128~256之间32的倍数，实际%d", entropyBits)
+	}
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return MnemonicFromEntropy(entropy)
+}
+
+// MnemonicFromEntropy 将熵编码为助记词：熵 + SHA-256前(熵比特数/32)位作为校验
+func MnemonicFromEntropy(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", fmt.Errorf("熵长度必须为16~32之间4的倍数字节，实际%d字节", len(entropy))
+	}
+	hash := sha256.Sum256(entropy)
+	data := append(append([]byte(nil), entropy...), hash[0])
+	total := bits + bits/32
+
+	words := make([]string, 0, total/11)
+	for i := 0; i < total; i += 11 {
+		words = append(words, mnemonicWordList[readBits(data, i, 11)])
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy 解析助记词并校验，写错或漏写的词会被拒绝
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("助记词数量应为12~24之间3的倍数，实际%d个", len(words))
+	}
+
+	total := len(words) * 11
+	data := make([]byte, (total+7)/8)
+	for i, w := range words {
+		idx, ok := mnemonicWordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("第%d个助记词不在词表中: %q", i+1, w)
+		}
+		writeBits(data, i*11, 11, idx)
+	}
+
+	checksumBits := total / 33
+	entropy := data[:(total-checksumBits)/8]
+	hash := sha256.Sum256(entropy)
+	if readBits(data, total-checksumBits, checksumBits) != readBits(hash[:], 0, checksumBits) {
+		return nil, fmt.Errorf("助记词校验和不匹配")
+	}
+	return append([]byte(nil), entropy...), nil
+}
+
+// MnemonicToSeed 校验助记词后派生64字节种子（PBKDF2-HMAC-SHA512，2048轮）
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	return pbkdf2.Key(sha512.New, normalized, []byte("mnemonic"+passphrase), 2048, 64)
+}
+
+// readBits 从data的第offset位起读取n位（大端位序）
+func readBits(data []byte, offset, n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit := (data[(offset+i)/8] >> (7 - uint((offset+i)%8))) & 1
+		v = v<<1 | int(bit)
+	}
+	return v
+}
+
+// writeBits 将v的低n位写入data的第offset位起
+func writeBits(data []byte, offset, n, v int) {
+	for i := 0; i < n; i++ {
+		if (v>>(n-1-i))&1 == 1 {
+			data[(offset+i)/8] |= 1 << (7 - uint((offset+i)%8))
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ------------------------------
+// M-of-N 多重签名（以脚本哈希地址 + OP_CHECKMULTISIG 赎回脚本实现）
+// ------------------------------
+
+// MaxMultisigKeys 多签策略允许的最大公钥数
+const MaxMultisigKeys = 15
+
+// MultisigPolicy 多签策略：N个公钥中任意M个签名即可花费
+type MultisigPolicy struct {
+	m          int
+	publicKeys [][]byte // 按字节序排序，保证同一组公钥得到同一地址
+}
+
+// NewMultisigPolicy 创建M-of-N多签策略，公钥顺序不影响结果
+func NewMultisigPolicy(m int, publicKeys [][]byte) (*MultisigPolicy, error) {
+	n := len(publicKeys)
+	if n == 0 || n > MaxMultisigKeys {
+		return nil, fmt.Errorf("多签公钥数量应在1到%d之间，实际%d", MaxMultisigKeys, n)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("所需签名数M应在1到%d之间，实际%d", n, m)
+	}
+
+	keys := make([][]byte, n)
+	for i, k := range publicKeys {
+		keys[i] = append([]byte(nil), k...)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	for i := 1; i < n; i++ {
+		if bytes.Equal(keys[i-1], keys[i]) {
+			return nil, errors.New("多签策略中存在重复公钥")
+		}
+	}
+	return &MultisigPolicy{m: m, publicKeys: keys}, nil
+}
+
+// ParseMultisigPolicy 从赎回脚本 <m> <公钥1>...<公钥n> <n> OP_CHECKMULTISIG 还原策略
+func ParseMultisigPolicy(redeem Script) (*MultisigPolicy, error) {
+	ops, err := redeem.parse()
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) < 4 || ops[len(ops)-1].opcode != OP_CHECKMULTISIG {
+		return nil, errors.New("不是多签赎回脚本")
+	}
+	m, okM := smallInt(ops[0])
+	n, okN := smallInt(ops[len(ops)-2])
+	if !okM || !okN || n != len(ops)-3 {
+		return nil, errors.New("多签赎回脚本格式错误")
+	}
+	keys := make([][]byte, 0, n)
+	for _, op := range ops[1 : len(ops)-2] {
+		if op.data == nil {
+			return nil, errors.New("多签赎回脚本中公钥格式错误")
+		}
+		keys = append(keys, op.data)
+	}
+	policy, err := NewMultisigPolicy(m, keys)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(policy.RedeemScript(), redeem) {
+		return nil, errors.New("多签赎回脚本不规范（公钥未排序）")
+	}
+	return policy, nil
+}
+
+// smallInt 解析 OP_1 ~ OP_16
+func smallInt(op scriptOp) (int, bool) {
+	if op.opcode >= OP_1 && op.opcode <= OP_16 {
+		return int(op.opcode-OP_1) + 1, true
+	}
+	return 0, false
+}
+
+// RedeemScript 多签赎回脚本：<m> <公钥1>...<公钥n> <n> OP_CHECKMULTISIG
+func (p *MultisigPolicy) RedeemScript() Script {
+	b := NewScriptBuilder().AddInt(int64(p.m))
+	for _, k := range p.publicKeys {
+		b.AddData(k)
+	}
+	return b.AddInt(int64(len(p.publicKeys))).AddOp(OP_CHECKMULTISIG).Script()
+}
+
+// Address 多签地址即赎回脚本的脚本哈希地址
+func (p *MultisigPolicy) Address() Address {
+	return NewScriptAddress(p.RedeemScript())
+}
+
+// 其他必要的getter方法
+func (p *MultisigPolicy) M() int               { return p.m }
+func (p *MultisigPolicy) N() int               { return len(p.publicKeys) }
+func (p *MultisigPolicy) PublicKeys() [][]byte { return p.publicKeys }
+
+// keyIndex 返回公钥在策略中的位置，不存在返回-1
+func (p *MultisigPolicy) keyIndex(publicKey []byte) int {
+	for i, k := range p.publicKeys {
+		if bytes.Equal(k, publicKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MultisigSignature 多签中的单个签名
+type MultisigSignature struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// ------------------------------
+// 部分签名交易（在各签名人之间传递）
+// ------------------------------
+
+// PartiallySignedTransaction 待收集签名的多签交易
+type PartiallySignedTransaction struct {
+	tx         *Transaction
+	policy     *MultisigPolicy
+	signatures []MultisigSignature
+}
+
+// NewPartiallySignedTransaction 由多签地址发起一笔转账，等待签名；
+// 序号与链ID取自区块链当前状态，手续费按手续费历史估算
+func NewPartiallySignedTransaction(bc *Blockchain, policy *MultisigPolicy, recipient Address, amount Amount) (*PartiallySignedTransaction, error) {
+	tx := NewTransaction(policy.Address(), recipient, amount)
+	tx.nonce = bc.NextNonce(tx.sender)
+	tx.chainID = bc.ChainID()
+	if err := bc.estimateFees(tx); err != nil {
+		return nil, fmt.Errorf("估算手续费失败: %w", err)
+	}
+	return &PartiallySignedTransaction{tx: tx, policy: policy}, nil
+}
+
+// Sign 用一位签名人的密钥追加签名
+func (p *PartiallySignedTransaction) Sign(keys KeyPair) error {
+	publicKey := keys.PublicKeyBytes()
+	if p.policy.keyIndex(publicKey) < 0 {
+		return fmt.Errorf("密钥 %s 不是该多签策略的签名人", keys.Address())
+	}
+	for _, sig := range p.signatures {
+		if bytes.Equal(sig.PublicKey, publicKey) {
+			return fmt.Errorf("密钥 %s 已签名", keys.Address())
+		}
+	}
+	signature, err := keys.Sign(p.tx.signingBytes())
+	if err != nil {
+		return err
+	}
+	p.signatures = append(p.signatures, MultisigSignature{PublicKey: publicKey, Signature: signature})
+	return nil
+}
+
+// SignatureCount 已收集的签名数
+func (p *PartiallySignedTransaction) SignatureCount() int { return len(p.signatures) }
+
+// IsComplete 签名数是否已达到M
+func (p *PartiallySignedTransaction) IsComplete() bool { return len(p.signatures) >= p.policy.m }
+
+// Transaction 返回未签名的交易内容，便于签名人核对
+func (p *PartiallySignedTransaction) Transaction() *Transaction { return p.tx }
+
+// Finalize 签名足够后生成可提交的交易，解锁脚本为：
+// <签名...>（按公钥顺序） <赎回脚本>
+func (p *PartiallySignedTransaction) Finalize() (*Transaction, error) {
+	if !p.IsComplete() {
+		return nil, fmt.Errorf("多签签名不足: 需要%d个，实际%d个", p.policy.m, len(p.signatures))
+	}
+	sigs := append([]MultisigSignature(nil), p.signatures...)
+	sort.Slice(sigs, func(i, j int) bool {
+		return p.policy.keyIndex(sigs[i].PublicKey) < p.policy.keyIndex(sigs[j].PublicKey)
+	})
+
+	b := NewScriptBuilder()
+	for _, sig := range sigs[:p.policy.m] {
+		b.AddData(sig.Signature)
+	}
+	tx := *p.tx
+	tx.unlockScript = b.AddData(p.policy.RedeemScript()).Script()
+	if err := tx.Verify(); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// psbtFile 部分签名交易的传输格式
+type psbtFile struct {
+	Sender     Address             `json:"sender"`
+	Recipient  Address             `json:"recipient"`
+	Amount     Amount              `json:"amount"`
+	Fee        Amount              `json:"fee"`
+	Tip        *Amount             `json:"tip,omitempty"` // 未指定最高小费时为空
+	Nonce      uint64              `json:"nonce"`
+	ChainID    string              `json:"chain_id"`
+	Redeem     string              `json:"redeem"`
+	Signatures []MultisigSignature `json:"signatures"`
+}
+
+// Encode 编码为base64字符串，可通过任意渠道传给下一位签名人
+func (p *PartiallySignedTransaction) Encode() (string, error) {
+	file := psbtFile{
+		Sender:     p.tx.sender,
+		Recipient:  p.tx.recipient,
+		Amount:     p.tx.amount,
+		Fee:        p.tx.fee,
+		Nonce:      p.tx.nonce,
+		ChainID:    p.tx.chainID,
+		Redeem:     hex.EncodeToString(p.policy.RedeemScript()),
+		Signatures: p.signatures,
+	}
+	if p.tx.hasTip {
+		tip := p.tx.tip
+		file.Tip = &tip
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecodePartiallySignedTransaction 解码并校验已有签名
+func DecodePartiallySignedTransaction(s string) (*PartiallySignedTransaction, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("部分签名交易编码错误: %w", err)
+	}
+	var file psbtFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("部分签名交易格式错误: %w", err)
+	}
+	redeem, err := hex.DecodeString(file.Redeem)
+	if err != nil {
+		return nil, fmt.Errorf("多签策略编码错误: %w", err)
+	}
+	policy, err := ParseMultisigPolicy(redeem)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Address() != file.Sender {
+		return nil, errors.New("多签策略与发送方地址不匹配")
+	}
+
+	tx := NewTransaction(file.Sender, file.Recipient, file.Amount)
+	tx.nonce = file.Nonce
+	tx.chainID = file.ChainID
+	tx.fee = file.Fee
+	if file.Tip != nil {
+		tx.tip, tx.hasTip = *file.Tip, true
+	}
+	p := &PartiallySignedTransaction{tx: tx, policy: policy}
+	for _, sig := range file.Signatures {
+		if p.policy.keyIndex(sig.PublicKey) < 0 {
+			return nil, fmt.Errorf("签名公钥 %x 不属于多签策略", sig.PublicKey)
+		}
+		if err := VerifySignature(sig.PublicKey, p.tx.signingBytes(), sig.Signature); err != nil {
+			return nil, fmt.Errorf("已有签名无效: %w", err)
+		}
+		p.signatures = append(p.signatures, sig)
+	}
+	return p, nil
+}
+
+// ------------------------------
+// 演示使用：2-of-3 金库
+// ------------------------------
+
+// runMultisigDemo 演示多签金库的收款、签名传递与提交
+func runMultisigDemo() {
+	// 三位管理员各自持有钱包
+	admins := make([]*Wallet, 3)
+	publicKeys := make([][]byte, 3)
+	for i := range admins {
+		keys, err := NewEd25519KeyPair()
+		if err != nil {
+			fmt.Printf("密钥生成失败: %v\n", err)
+			return
+		}
+		admins[i] = NewWallet("")
+		admins[i].ImportKey(fmt.Sprintf("admin%d", i+1), keys)
+		publicKeys[i] = keys.PublicKeyBytes()
+	}
+
+	policy, err := NewMultisigPolicy(2, publicKeys)
+	if err != nil {
+		fmt.Printf("创建多签策略失败: %v\n", err)
+		return
+	}
+	treasury := policy.Address()
+	fmt.Printf("2-of-3 金库地址: %s\n", treasury)
+
+	// 挖矿奖励直接进入金库
+	bc := NewDevBlockchain(3)
+	bc.SetMinerAddress(treasury)
+	bc.MineBlock()
+	fmt.Printf("金库余额: %s\n", bc.Balance(treasury))
+
+	user, _ := NewEd25519KeyPair()
+	psbt, err := NewPartiallySignedTransaction(bc, policy, user.Address(), 20*Coin)
+	if err != nil {
+		fmt.Printf("创建交易失败: %v\n", err)
+		return
+	}
+
+	// 管理员1签名后，将编码后的交易交给管理员3
+	admins[0].SignMultisig(psbt)
+	encoded, err := psbt.Encode()
+	if err != nil {
+		fmt.Printf("编码失败: %v\n", err)
+		return
+	}
+	if _, err := psbt.Finalize(); err != nil {
+		fmt.Printf("仅1个签名时无法提交: %v\n", err)
+	}
+
+	received, err := DecodePartiallySignedTransaction(encoded)
+	if err != nil {
+		fmt.Printf("解码失败: %v\n", err)
+		return
+	}
+	admins[2].SignMultisig(received)
+	tx, err := received.Finalize()
+	if err != nil {
+		fmt.Printf("生成交易失败: %v\n", err)
+		return
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		fmt.Printf("提交失败: %v\n", err)
+		return
+	}
+	bc.MineBlock()
+	fmt.Printf("已从金库转出 %s，金库余额: %s，收款方余额: %s\n",
+		tx.Amount(), bc.Balance(treasury), bc.Balance(user.Address()))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ------------------------------
+// 重放保护：发送方序号（nonce）与链ID
+// ------------------------------
+
+// MaxNonceGap 允许进入等待队列的最大序号间隔，超出的交易直接拒绝
+const MaxNonceGap = 64
+
+// confirmedNonce 发送方下一笔应打包的序号，即已确认的交易数
+func (bc *Blockchain) confirmedNonce(addr Address) uint64 {
+	n := bc.base.Account(addr).Nonce
+	if d, ok := bc.index.accounts[addr]; ok {
+		n += d.nonce
+	}
+	return n
+}
+
+// NextNonce 发送方下一笔新交易应使用的序号（已考虑待打包和等待队列中的交易）
+func (bc *Blockchain) NextNonce(addr Address) uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	n := bc.confirmedNonce(addr)
+	for bc.findPending(addr, n) != nil || bc.findQueued(addr, n) != nil {
+		n++
+	}
+	return n
+}
+
+// WithNonce 手动指定交易序号（如替换一笔尚未打包的交易）
+func WithNonce(nonce uint64) TxOption {
+	return func(t *Transaction) { t.nonce = nonce }
+}
+
+// QueuedTransactions 返回因序号超前而等待的交易
+func (bc *Blockchain) QueuedTransactions() []*Transaction {
+	return bc.mempool.Queued()
+}
+
+// checkNonce 检查交易序号：过旧或重复的拒绝，超前的返回queued=true
+func (bc *Blockchain) checkNonce(tx *Transaction) (queued bool, err error) {
+	confirmed := bc.confirmedNonce(tx.Sender())
+	if tx.Nonce() < confirmed {
+		return false, fmt.Errorf("交易序号过旧: 已确认到%d，实际%d", confirmed, tx.Nonce())
+	}
+	if bc.findPending(tx.Sender(), tx.Nonce()) != nil || bc.findQueued(tx.Sender(), tx.Nonce()) != nil {
+		return false, fmt.Errorf("交易序号%d重复", tx.Nonce())
+	}
+
+	next := bc.pendingNonce(tx.Sender(), confirmed)
+	if tx.Nonce() == next {
+		return false, nil
+	}
+	if tx.Nonce()-next > MaxNonceGap {
+		return false, fmt.Errorf("交易序号超前过多: 期望%d，实际%d", next, tx.Nonce())
+	}
+	return true, nil
+}
+
+// pendingNonce 从已确认序号起跳过待打包列表中连续的序号，得到下一个可直接打包的序号
+func (bc *Blockchain) pendingNonce(addr Address, confirmed uint64) uint64 {
+	next := confirmed
+	for bc.findPending(addr, next) != nil {
+		next++
+	}
+	return next
+}
+
+// promoteQueued 将前序交易已到齐的等待交易转入待打包列表，余额不足的继续等待，
+// 同序号已被打包的直接丢弃
+func (bc *Blockchain) promoteQueued() {
+	for changed := true; changed; {
+		changed = false
+		for _, tx := range bc.mempool.Queued() {
+			confirmed := bc.confirmedNonce(tx.Sender())
+			if tx.Nonce() < confirmed {
+				bc.mempool.Remove([]string{tx.ID()})
+				changed = true
+				continue
+			}
+			if tx.Nonce() == bc.pendingNonce(tx.Sender(), confirmed) && bc.checkPendingBalance(tx) == nil {
+				bc.mempool.promote(tx.ID())
+				bc.events.publish(EventPendingTx, nil, []*Transaction{tx})
+				changed = true
+			}
+		}
+	}
+}
+
+func (bc *Blockchain) findPending(addr Address, nonce uint64) *Transaction {
+	if tx, queued := bc.mempool.find(addr, nonce); !queued {
+		return tx
+	}
+	return nil
+}
+
+func (bc *Blockchain) findQueued(addr Address, nonce uint64) *Transaction {
+	if tx, queued := bc.mempool.find(addr, nonce); queued {
+		return tx
+	}
+	return nil
+}
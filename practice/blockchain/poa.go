@@ -0,0 +1,529 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ------------------------------
+// 权威证明：创世配置指定一组授权出块者，按高度轮流出块（轮值），出块者用RSA密钥签名区块头。
+// 轮值出块者缺席时，其他出块者多等一个出块间隔后可代为出块，
+// 但每个出块者在最近N/2+1个区块中最多出一个，防止少数出块者连续代出。
+// 出块者集合通过区块头中的投票变更，超过半数出块者投同一票后生效
+// ------------------------------
+
+// PoAConfig 权威证明参数
+type PoAConfig struct {
+	PeriodSeconds int       `json:"period_seconds"` // 出块间隔，非轮值出块者需等待两个间隔
+	Signers       []Address `json:"signers"`        // 初始授权出块者
+}
+
+func (c PoAConfig) validate() error {
+	if c.PeriodSeconds <= 0 {
+		return errors.New("权威证明的出块间隔必须为正数")
+	}
+	if len(c.Signers) == 0 {
+		return errors.New("权威证明至少需要一个出块者")
+	}
+	seen := make(map[Address]bool)
+	for i, signer := range c.Signers {
+		if signer.IsZero() || seen[signer] {
+			return fmt.Errorf("第%d个出块者地址为空或重复", i)
+		}
+		seen[signer] = true
+	}
+	return nil
+}
+
+func (c PoAConfig) period() time.Duration {
+	return time.Duration(c.PeriodSeconds) * time.Second
+}
+
+// SignerVote 区块头中的投票：授权新的出块者或撤销已有出块者
+type SignerVote struct {
+	Address   Address `json:"address"`
+	Authorize bool    `json:"authorize"`
+}
+
+// 分叉选择权重：轮值出块的区块比代出的区块重，出块者均在线时轮值链胜出
+var (
+	poaInTurnWeight    = big.NewInt(2)
+	poaOutOfTurnWeight = big.NewInt(1)
+)
+
+// ProofOfAuthority 权威证明共识
+type ProofOfAuthority struct {
+	chainID string
+	config  PoAConfig
+
+	mu        sync.Mutex
+	proposals map[Address]bool     // 本节点出块时要投的票：地址 -> 授权或撤销
+	states    map[string]*poaState // 链尾区块哈希 -> 出块者状态（只读），由mu保护
+}
+
+// poaStateCacheSize 缓存的出块者状态数，超出时清空重建
+const poaStateCacheSize = 128
+
+// NewProofOfAuthority 创建权威证明共识
+func NewProofOfAuthority(chainID string, config PoAConfig) *ProofOfAuthority {
+	return &ProofOfAuthority{
+		chainID:   chainID,
+		config:    config,
+		proposals: make(map[Address]bool),
+		states:    make(map[string]*poaState),
+	}
+}
+
+// Name 共识名称
+func (e *ProofOfAuthority) Name() string { return ConsensusPoA }
+
+// Config 返回权威证明参数
+func (e *ProofOfAuthority) Config() PoAConfig { return e.config }
+
+// Propose 本节点此后出块时投票授权（authorize为true）或撤销该地址，直到Discard或投票生效
+func (e *ProofOfAuthority) Propose(addr Address, authorize bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.proposals[addr] = authorize
+}
+
+// Discard 撤回对该地址的投票提案
+func (e *ProofOfAuthority) Discard(addr Address) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.proposals, addr)
+}
+
+// Proposals 本节点当前的投票提案
+func (e *ProofOfAuthority) Proposals() map[Address]bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	proposals := make(map[Address]bool, len(e.proposals))
+	for addr, authorize := range e.proposals {
+		proposals[addr] = authorize
+	}
+	return proposals
+}
+
+// Prepare 检查本节点能否出块，并写入一条尚未生效的投票提案
+func (e *ProofOfAuthority) Prepare(chain ChainReader, header *BlockHeader, signer KeyPair) error {
+	if _, ok := signer.(*RSAKeyPair); !ok {
+		return errors.New("权威证明出块需要设置RSA签名密钥")
+	}
+	state, err := e.state(chain)
+	if err != nil {
+		return err
+	}
+	if err := e.checkSigner(state, chain.Tip(), *header, signer.Address()); err != nil {
+		return err
+	}
+	header.Vote = e.pickVote(state)
+	return nil
+}
+
+// Seal 用出块者的RSA密钥签名区块头
+func (e *ProofOfAuthority) Seal(parent BlockHeader, header *BlockHeader, signer KeyPair) error {
+	if _, ok := signer.(*RSAKeyPair); !ok {
+		return errors.New("权威证明出块需要设置RSA签名密钥")
+	}
+	return signHeader(e.chainID, header, signer)
+}
+
+// VerifySeal 校验RSA签名、出块者授权、轮值与频率限制、出块间隔以及投票
+func (e *ProofOfAuthority) VerifySeal(chain ChainReader, header BlockHeader) error {
+	signer, err := verifySignerSeal(e.chainID, header)
+	if err != nil {
+		return err
+	}
+	seal, _ := decodeSignerSeal(header)
+	if _, err := x509.ParsePKCS1PublicKey(seal.PublicKey); err != nil {
+		return errors.New("权威证明区块头须使用RSA密钥签名")
+	}
+	parent, ok := chain.HeaderByHeight(header.Index - 1)
+	if !ok {
+		return errors.New("父区块不存在")
+	}
+	if header.Timestamp > chain.Now().Add(e.config.period()).UnixNano() {
+		return errors.New("区块时间戳超前本地时间一个出块间隔以上")
+	}
+	state, err := e.state(chain)
+	if err != nil {
+		return err
+	}
+	if err := e.checkSigner(state, parent, header, signer); err != nil {
+		return err
+	}
+	if header.Vote != nil && !state.validVote(*header.Vote) {
+		return fmt.Errorf("投票无效: 不能%s地址 %s", voteAction(header.Vote.Authorize), header.Vote.Address)
+	}
+	return nil
+}
+
+// Weight 轮值出块为2，代出为1
+func (e *ProofOfAuthority) Weight(chain ChainReader, header BlockHeader) *big.Int {
+	state, err := e.state(chain)
+	if err != nil {
+		return new(big.Int)
+	}
+	signer, err := sealSigner(header)
+	if err != nil || !state.inTurn(header.Index, signer) {
+		return new(big.Int).Set(poaOutOfTurnWeight)
+	}
+	return new(big.Int).Set(poaInTurnWeight)
+}
+
+// checkSigner 检查出块者已授权、近期未出块，且区块时间满足出块间隔（代出需多等一个间隔）
+func (e *ProofOfAuthority) checkSigner(state *poaState, parent, header BlockHeader, signer Address) error {
+	if !state.signers[signer] {
+		return fmt.Errorf("%w: %s 不是授权出块者", ErrNotProposer, signer)
+	}
+	if state.recentlySigned(header.Index, signer) {
+		return fmt.Errorf("%w: %s 在最近%d个区块中已出块", ErrNotProposer, signer, state.signLimit())
+	}
+	wait := e.config.period()
+	if !state.inTurn(header.Index, signer) {
+		wait *= 2
+	}
+	if earliest := parent.Timestamp + int64(wait); header.Timestamp < earliest {
+		return fmt.Errorf("%w: %s 在高度%d须等到父区块之后%s才能出块", ErrNotProposer, signer, header.Index, wait)
+	}
+	return nil
+}
+
+// pickVote 按地址顺序选出第一条仍能改变出块者集合的提案
+func (e *ProofOfAuthority) pickVote(state *poaState) *SignerVote {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	addrs := make([]Address, 0, len(e.proposals))
+	for addr := range e.proposals {
+		addrs = append(addrs, addr)
+	}
+	sortAddresses(addrs)
+	for _, addr := range addrs {
+		vote := SignerVote{Address: addr, Authorize: e.proposals[addr]}
+		if state.validVote(vote) {
+			return &vote
+		}
+	}
+	return nil
+}
+
+// ------------------------------
+// 出块者集合：从创世配置出发按区块头重放投票
+// ------------------------------
+
+// poaState 某一链尾下的出块者集合、近期出块记录与未生效的投票
+type poaState struct {
+	signers map[Address]bool
+	recents map[int]Address              // 高度 -> 出块者
+	votes   map[Address]map[Address]bool // 被投票地址 -> 投票的出块者 -> 授权或撤销
+}
+
+// state 链尾的出块者状态：按链尾哈希缓存，父区块的状态已缓存时只应用链尾区块头，
+// 否则从创世配置重放全部区块头。返回值不能修改
+func (e *ProofOfAuthority) state(chain ChainReader) (*poaState, error) {
+	tip := chain.Tip()
+	e.mu.Lock()
+	state, ok := e.states[tip.Hash]
+	parent, hasParent := e.states[tip.PreviousHash]
+	e.mu.Unlock()
+	if ok {
+		return state, nil
+	}
+	if hasParent && tip.Index > 0 {
+		state = parent.clone()
+		if err := state.apply(tip); err != nil {
+			return nil, fmt.Errorf("区块头%d: %w", tip.Index, err)
+		}
+	} else {
+		var err error
+		if state, err = e.replay(chain); err != nil {
+			return nil, err
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.states) >= poaStateCacheSize {
+		e.states = make(map[string]*poaState)
+	}
+	e.states[tip.Hash] = state
+	return state, nil
+}
+
+// replay 重放创世之后全部区块头，得到链尾的出块者状态
+func (e *ProofOfAuthority) replay(chain ChainReader) (*poaState, error) {
+	state := &poaState{
+		signers: make(map[Address]bool),
+		recents: make(map[int]Address),
+		votes:   make(map[Address]map[Address]bool),
+	}
+	for _, signer := range e.config.Signers {
+		state.signers[signer] = true
+	}
+	for height := 1; height <= chain.Tip().Index; height++ {
+		header, ok := chain.HeaderByHeight(height)
+		if !ok {
+			return nil, fmt.Errorf("缺少高度%d的区块头", height)
+		}
+		if err := state.apply(header); err != nil {
+			return nil, fmt.Errorf("区块头%d: %w", height, err)
+		}
+	}
+	return state, nil
+}
+
+func (s *poaState) clone() *poaState {
+	c := &poaState{
+		signers: make(map[Address]bool, len(s.signers)),
+		recents: make(map[int]Address, len(s.recents)),
+		votes:   make(map[Address]map[Address]bool, len(s.votes)),
+	}
+	for signer := range s.signers {
+		c.signers[signer] = true
+	}
+	for height, signer := range s.recents {
+		c.recents[height] = signer
+	}
+	for addr, voters := range s.votes {
+		c.votes[addr] = make(map[Address]bool, len(voters))
+		for voter, authorize := range voters {
+			c.votes[addr][voter] = authorize
+		}
+	}
+	return c
+}
+
+// apply 记录已上链区块头的出块者与投票
+func (s *poaState) apply(header BlockHeader) error {
+	signer, err := sealSigner(header)
+	if err != nil {
+		return err
+	}
+	s.recents[header.Index] = signer
+	delete(s.recents, header.Index-len(s.signers)-1)
+	if header.Vote != nil && s.validVote(*header.Vote) {
+		s.cast(signer, *header.Vote)
+	}
+	return nil
+}
+
+// validVote 投票能否改变出块者集合：授权非出块者，或撤销出块者（不能撤销最后一个）
+func (s *poaState) validVote(vote SignerVote) bool {
+	if vote.Address.IsZero() || vote.Authorize == s.signers[vote.Address] {
+		return false
+	}
+	return vote.Authorize || len(s.signers) > 1
+}
+
+// cast 记录出块者的投票（覆盖其对同一地址的旧票），票数过半时变更出块者集合
+func (s *poaState) cast(voter Address, vote SignerVote) {
+	if s.votes[vote.Address] == nil {
+		s.votes[vote.Address] = make(map[Address]bool)
+	}
+	s.votes[vote.Address][voter] = vote.Authorize
+	tally := 0
+	for _, authorize := range s.votes[vote.Address] {
+		if authorize == vote.Authorize {
+			tally++
+		}
+	}
+	if tally <= len(s.signers)/2 {
+		return
+	}
+	delete(s.votes, vote.Address)
+	if vote.Authorize {
+		s.signers[vote.Address] = true
+		return
+	}
+	// 被撤销的出块者投出的票随之作废
+	delete(s.signers, vote.Address)
+	for _, voters := range s.votes {
+		delete(voters, vote.Address)
+	}
+}
+
+// signLimit 每个出块者在连续signLimit个区块中最多出一个
+func (s *poaState) signLimit() int {
+	return len(s.signers)/2 + 1
+}
+
+// recentlySigned 出块者是否在height之前的signLimit-1个区块中出过块
+func (s *poaState) recentlySigned(height int, signer Address) bool {
+	for h := height - s.signLimit() + 1; h < height; h++ {
+		if s.recents[h] == signer {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted 按地址排序的出块者列表
+func (s *poaState) sorted() []Address {
+	list := make([]Address, 0, len(s.signers))
+	for signer := range s.signers {
+		list = append(list, signer)
+	}
+	sortAddresses(list)
+	return list
+}
+
+// inTurn 出块者是否为该高度的轮值出块者
+func (s *poaState) inTurn(height int, signer Address) bool {
+	list := s.sorted()
+	return list[height%len(list)] == signer
+}
+
+func sortAddresses(addrs []Address) {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].String() < addrs[j].String() })
+}
+
+func voteAction(authorize bool) string {
+	if authorize {
+		return "授权"
+	}
+	return "撤销"
+}
+
+// Signers 当前的授权出块者，按地址排序
+func (bc *Blockchain) Signers() ([]Address, error) {
+	poa, ok := bc.engine.(*ProofOfAuthority)
+	if !ok {
+		return nil, fmt.Errorf("%s共识没有出块者集合", bc.engine.Name())
+	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	state, err := poa.state(chainView{bc})
+	if err != nil {
+		return nil, err
+	}
+	return state.sorted(), nil
+}
+
+// ------------------------------
+// 演示使用：轮值出块、代出与投票增加出块者
+// ------------------------------
+
+// runPoADemo 三个授权出块者轮流出块，一个出块者离线时由其他人代出，再投票授权第四个出块者。
+// 演示中各出块者共用一个节点，依次切换签名密钥尝试出块
+func runPoADemo() {
+	names := []string{"signer-a", "signer-b", "signer-c", "signer-d"}
+	keys := make([]*RSAKeyPair, len(names))
+	for i := range keys {
+		key, err := NewRSAKeyPair(2048)
+		if err != nil {
+			fmt.Printf("RSA密钥生成失败: %v\n", err)
+			return
+		}
+		keys[i] = key
+	}
+	nameOf := make(map[Address]string)
+	for i, key := range keys {
+		nameOf[key.Address()] = names[i]
+	}
+	genesis := &Genesis{
+		ChainID:       "upchain-poa-demo",
+		Timestamp:     devGenesisTime,
+		Consensus:     ConsensusPoA,
+		HashAlgorithm: HashSHA256,
+		PoA: &PoAConfig{
+			PeriodSeconds: 5,
+			Signers:       []Address{keys[0].Address(), keys[1].Address(), keys[2].Address()},
+		},
+		Params: DefaultConsensusParams,
+	}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		fmt.Printf("创建区块链失败: %v\n", err)
+		return
+	}
+	clock := NewFakeClock(genesis.Timestamp)
+	bc.SetClock(clock)
+	engine := bc.Engine().(*ProofOfAuthority)
+
+	// 每过一个出块间隔，在线的出块者依次尝试出块
+	online := map[int]bool{0: true, 1: true, 2: true, 3: true}
+	produce := func() bool {
+		for wait := 0; wait < 3; wait++ {
+			clock.Advance(genesis.PoA.period())
+			for i, key := range keys {
+				if !online[i] {
+					continue
+				}
+				bc.SetSigner(key)
+				bc.SetMinerAddress(key.Address())
+				block, err := bc.ProduceBlock()
+				if errors.Is(err, ErrNotProposer) {
+					continue
+				}
+				if err != nil {
+					fmt.Printf("出块失败: %v\n", err)
+					return false
+				}
+				note := "轮值"
+				if block.weight.Cmp(poaInTurnWeight) != 0 {
+					note = "代出"
+				}
+				if vote := block.Vote(); vote != nil {
+					note += fmt.Sprintf("，投票%s %s", voteAction(vote.Authorize), nameOf[vote.Address])
+				}
+				fmt.Printf("区块%d由 %s 出块（%s）\n", block.Index(), names[i], note)
+				return true
+			}
+		}
+		fmt.Println("没有出块者能够出块")
+		return false
+	}
+	printSigners := func() {
+		signers, err := bc.Signers()
+		if err != nil {
+			fmt.Printf("查询出块者失败: %v\n", err)
+			return
+		}
+		fmt.Print("当前出块者:")
+		for _, signer := range signers {
+			fmt.Printf(" %s", nameOf[signer])
+		}
+		fmt.Println()
+	}
+
+	printSigners()
+	for i := 0; i < 3; i++ {
+		if !produce() {
+			return
+		}
+	}
+
+	// signer-c离线：轮到它时由其他出块者多等一个间隔后代出
+	online[2] = false
+	fmt.Println("signer-c离线")
+	for i := 0; i < 3; i++ {
+		if !produce() {
+			return
+		}
+	}
+	online[2] = true
+
+	// 投票授权signer-d：三个出块者中两票即过半
+	engine.Propose(keys[3].Address(), true)
+	for {
+		signers, _ := bc.Signers()
+		if len(signers) == 4 {
+			break
+		}
+		if !produce() {
+			return
+		}
+	}
+	engine.Discard(keys[3].Address())
+	printSigners()
+	for i := 0; i < 4; i++ {
+		if !produce() {
+			return
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ------------------------------
+// 权益证明：每个高度按轮次选出块者，轮次由区块时间距父区块经过的时隙数决定，
+// 出块者按质押加权、以父区块哈希、高度和轮次的哈希为种子抽取，任何节点都可复算验证；
+// 出块者用密钥签名区块头，同一高度签名两个不同区块头会被举报并销毁质押
+// ------------------------------
+
+// PoSConfig 权益证明参数
+type PoSConfig struct {
+	SlotSeconds     int    `json:"slot_seconds"`     // 每轮的时长，出块者未按时出块时由下一轮的出块者接替
+	MinStake        Amount `json:"min_stake"`        // 成为验证者的最低质押，最小单位
+	UnbondingBlocks int    `json:"unbonding_blocks"` // 解除质押的资金须锁定的区块数
+}
+
+func (c PoSConfig) validate() error {
+	if c.SlotSeconds <= 0 {
+		return errors.New("权益证明的时隙长度必须为正数")
+	}
+	if c.UnbondingBlocks < 0 {
+		return errors.New("解绑期不能为负数")
+	}
+	return nil
+}
+
+func (c PoSConfig) slot() time.Duration {
+	return time.Duration(c.SlotSeconds) * time.Second
+}
+
+// ErrNotProposer 本节点不是当前轮次的出块者
+var ErrNotProposer = errors.New("不是当前轮次的出块者")
+
+// ProofOfStake 权益证明共识
+type ProofOfStake struct {
+	chainID string
+	config  PoSConfig
+}
+
+// NewProofOfStake 创建权益证明共识，签名覆盖链ID，使区块头不能在其他链上冒用
+func NewProofOfStake(chainID string, config PoSConfig) *ProofOfStake {
+	return &ProofOfStake{chainID: chainID, config: config}
+}
+
+// Name 共识名称
+func (e *ProofOfStake) Name() string { return ConsensusPoS }
+
+// Config 返回权益证明参数
+func (e *ProofOfStake) Config() PoSConfig { return e.config }
+
+// round 区块所在的轮次：距父区块经过的完整时隙数
+func (e *ProofOfStake) round(parent BlockHeader, timestamp int64) (int, error) {
+	if timestamp <= parent.Timestamp {
+		return 0, errors.New("区块时间戳必须晚于父区块")
+	}
+	return int((timestamp - parent.Timestamp) / int64(e.config.slot())), nil
+}
+
+// Proposer 父区块之后第round轮的出块者
+func (e *ProofOfStake) Proposer(chain ChainReader, parent BlockHeader, round int) (Address, error) {
+	return selectProposer(chain.Validators(e.config.MinStake), proposerSeed(parent.Hash, parent.Index+1, round))
+}
+
+// proposerSeed 出块者抽取种子：父区块哈希、高度与轮次的哈希
+func proposerSeed(parentHash string, height, round int) []byte {
+	data := fmt.Sprintf("%s:%d:%d", parentHash, height, round)
+	seed := sha256.Sum256([]byte(data))
+	return seed[:]
+}
+
+// selectProposer 按质押加权抽取：种子对总质押取模，落在哪个验证者的区间即由其出块
+func selectProposer(validators []Validator, seed []byte) (Address, error) {
+	stakes := make([]Amount, len(validators))
+	for i, v := range validators {
+		stakes[i] = v.Stake
+	}
+	total, err := SumAmounts(stakes...)
+	if err != nil {
+		return Address{}, err
+	}
+	if total == 0 {
+		return Address{}, errors.New("没有可出块的验证者")
+	}
+	point := Amount(binary.BigEndian.Uint64(seed[:8]) % uint64(total))
+	for _, v := range validators {
+		if point < v.Stake {
+			return v.Address, nil
+		}
+		point -= v.Stake
+	}
+	panic("unreachable")
+}
+
+// Prepare 检查本节点的签名密钥是否为当前轮次的出块者
+func (e *ProofOfStake) Prepare(chain ChainReader, header *BlockHeader, signer KeyPair) error {
+	if signer == nil {
+		return errors.New("权益证明出块需要设置签名密钥")
+	}
+	parent := chain.Tip()
+	round, err := e.round(parent, header.Timestamp)
+	if err != nil {
+		return err
+	}
+	proposer, err := e.Proposer(chain, parent, round)
+	if err != nil {
+		return err
+	}
+	if proposer != signer.Address() {
+		return fmt.Errorf("%w: 高度%d第%d轮应由 %s 出块", ErrNotProposer, header.Index, round, proposer)
+	}
+	return nil
+}
+
+// Seal 用出块者密钥签名区块头
+func (e *ProofOfStake) Seal(parent BlockHeader, header *BlockHeader, signer KeyPair) error {
+	if signer == nil {
+		return errors.New("权益证明出块需要设置签名密钥")
+	}
+	return signHeader(e.chainID, header, signer)
+}
+
+// VerifySeal 校验签名、出块者是否为该轮次抽中的验证者，以及时间戳未超前一个时隙以上
+func (e *ProofOfStake) VerifySeal(chain ChainReader, header BlockHeader) error {
+	signer, err := verifySignerSeal(e.chainID, header)
+	if err != nil {
+		return err
+	}
+	parent, ok := chain.HeaderByHeight(header.Index - 1)
+	if !ok {
+		return errors.New("父区块不存在")
+	}
+	if header.Timestamp > chain.Now().Add(e.config.slot()).UnixNano() {
+		return errors.New("区块时间戳超前本地时间一个时隙以上")
+	}
+	round, err := e.round(parent, header.Timestamp)
+	if err != nil {
+		return err
+	}
+	proposer, err := e.Proposer(chain, parent, round)
+	if err != nil {
+		return err
+	}
+	if proposer != signer {
+		return fmt.Errorf("%w: 高度%d第%d轮应由 %s 出块，实际为 %s", ErrNotProposer, header.Index, round, proposer, signer)
+	}
+	return nil
+}
+
+// Weight 出块者的质押：由质押更多的验证者出块的链更重
+func (e *ProofOfStake) Weight(chain ChainReader, header BlockHeader) *big.Int {
+	signer, err := sealSigner(header)
+	if err != nil {
+		return new(big.Int)
+	}
+	return new(big.Int).SetUint64(uint64(chain.StakeOf(signer)))
+}
+
+// ------------------------------
+// 演示使用：质押加权出块、解除质押与双签惩罚
+// ------------------------------
+
+// runPoSDemo 三个验证者按质押轮流出块，演示质押变化与双签举报
+func runPoSDemo() {
+	wallet := NewWallet("")
+	names := []string{"validator-a", "validator-b", "validator-c"}
+	keys := make([]KeyPair, len(names))
+	genesis := &Genesis{
+		ChainID:       "upchain-pos-demo",
+		Timestamp:     devGenesisTime,
+		Consensus:     ConsensusPoS,
+		HashAlgorithm: HashSHA256,
+		PoS:           &PoSConfig{SlotSeconds: 5, MinStake: 10 * Coin, UnbondingBlocks: 3},
+		Params:        DefaultConsensusParams,
+	}
+	for i, name := range names {
+		key, err := NewEd25519KeyPair()
+		if err != nil {
+			fmt.Printf("生成密钥失败: %v\n", err)
+			return
+		}
+		keys[i] = key
+		wallet.ImportKey(name, key)
+		genesis.Alloc = append(genesis.Alloc, GenesisAlloc{
+			Address: key.Address(),
+			Balance: 100 * Coin,
+			Stake:   Amount(i+1) * 100 * Coin,
+		})
+	}
+	bc, err := NewBlockchain(genesis)
+	if err != nil {
+		fmt.Printf("创建区块链失败: %v\n", err)
+		return
+	}
+	clock := NewFakeClock(genesis.Timestamp)
+	bc.SetClock(clock)
+
+	// 每过一个时隙，由抽中的验证者出块
+	produce := func() bool {
+		clock.Advance(genesis.PoS.slot())
+		for i, key := range keys {
+			bc.SetSigner(key)
+			bc.SetMinerAddress(key.Address())
+			block, err := bc.ProduceBlock()
+			if errors.Is(err, ErrNotProposer) {
+				continue
+			}
+			if err != nil {
+				fmt.Printf("出块失败: %v\n", err)
+				return false
+			}
+			fmt.Printf("区块%d由 %s 出块，打包交易%d笔\n", block.Index(), names[i], len(block.Transactions())-1)
+			return true
+		}
+		fmt.Println("本时隙没有可出块的验证者")
+		return false
+	}
+	printStakes := func() {
+		for i, key := range keys {
+			fmt.Printf("  %s: 质押 %s，余额 %s（可花费 %s）", names[i],
+				bc.StakeOf(key.Address()), bc.Balance(key.Address()), bc.SpendableBalance(key.Address()))
+			if bc.IsJailed(key.Address()) {
+				fmt.Print("，已被惩罚")
+			}
+			fmt.Println()
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if !produce() {
+			return
+		}
+	}
+	printStakes()
+
+	// 追加质押与解除质押：解除的资金需锁定解绑期
+	if _, err := wallet.Stake(bc, keys[0].Address(), 50*Coin); err != nil {
+		fmt.Printf("质押失败: %v\n", err)
+		return
+	}
+	if _, err := wallet.Unstake(bc, keys[1].Address(), 100*Coin); err != nil {
+		fmt.Printf("解除质押失败: %v\n", err)
+		return
+	}
+	if !produce() {
+		return
+	}
+	fmt.Printf("%s追加质押50，%s解除质押100（锁定%d个区块）:\n", names[0], names[1], genesis.PoS.UnbondingBlocks)
+	printStakes()
+
+	// 双签：validator-c在同一高度签名两个不同的区块头，被validator-a举报
+	tip := bc.LastBlock().Header()
+	var conflicting []BlockHeader
+	for _, offset := range []time.Duration{time.Second, 2 * time.Second} {
+		header := BlockHeader{
+			Index:        tip.Index + 1,
+			Timestamp:    tip.Timestamp + int64(offset),
+			MerkleRoot:   transactionsMerkleRoot(nil),
+			PreviousHash: tip.Hash,
+		}
+		if err := bc.Engine().Seal(tip, &header, keys[2]); err != nil {
+			fmt.Printf("签名区块头失败: %v\n", err)
+			return
+		}
+		header.Hash = header.calculateHash()
+		conflicting = append(conflicting, header)
+	}
+	evidence := NewDoubleSignEvidence(conflicting[0], conflicting[1])
+	if _, err := wallet.ReportDoubleSign(bc, keys[0].Address(), evidence); err != nil {
+		fmt.Printf("举报失败: %v\n", err)
+		return
+	}
+	if !produce() {
+		return
+	}
+	fmt.Printf("%s双签被举报后:\n", names[2])
+	printStakes()
+	for i := 0; i < 3; i++ {
+		if !produce() {
+			return
+		}
+	}
+}
@@ -122,7 +122,8 @@ func (p *Pow) Run() (string, string, time.Duration) {
 	}
 }
 
-func main() {
+// runPowDemo 演示不同难度下的POW计算
+func runPowDemo() {
 	// 配置参数
 	nickname := "Lumos"
 
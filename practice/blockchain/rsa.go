@@ -277,6 +277,74 @@ func (k *RSAKeyPair) Verify(data []byte, signature []byte) error {
 	return rsa.VerifyPKCS1v15(k.publicKey, crypto.SHA256, hash[:], signature)
 }
 
+// PublicKeyBytes 返回PKCS#1 DER编码的公钥，用于派生地址
+func (k *RSAKeyPair) PublicKeyBytes() []byte {
+	return x509.MarshalPKCS1PublicKey(k.publicKey)
+}
+
+// Address 返回该密钥对应的地址
+func (k *RSAKeyPair) Address() Address {
+	return NewAddressFromPublicKey(k.PublicKeyBytes())
+}
+
+// LoadRSAKeyPair 从PEM文件加载私钥
+func LoadRSAKeyPair(path string) (*RSAKeyPair, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("%s 不是RSA私钥文件（类型: %s）", path, block.Type)
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %w", err)
+	}
+	return &RSAKeyPair{privateKey: privateKey, publicKey: &privateKey.PublicKey}, nil
+}
+
+// LoadPublicKeyBytes 从PEM文件读取公钥字节（支持RSA私钥/公钥及PKCS#8私钥）
+func LoadPublicKeyBytes(path string) ([]byte, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("解析私钥失败: %w", err)
+		}
+		return x509.MarshalPKCS1PublicKey(&privateKey.PublicKey), nil
+	case "RSA PUBLIC KEY":
+		if _, err := x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("解析公钥失败: %w", err)
+		}
+		return block.Bytes, nil
+	case "PRIVATE KEY":
+		keys, err := parsePKCS8KeyPair(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return keys.PublicKeyBytes(), nil
+	default:
+		return nil, fmt.Errorf("%s 不支持的密钥类型: %s", path, block.Type)
+	}
+}
+
+// readPEMFile 读取并解码PEM文件
+func readPEMFile(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s 不是有效的PEM文件", path)
+	}
+	return block, nil
+}
+
 // SavePrivateKey 保存私钥到代码文件所在目录
 func (k *RSAKeyPair) SavePrivateKey(filename string) error {
 	// 1. 动态获取当前代码文件所在的目录
@@ -313,8 +381,8 @@ func (k *RSAKeyPair) SavePublicKey(filename string) error {
 	return os.WriteFile(fullPath, pemData, 0644)
 }
 
-// 主函数协调各模块
-func main() {
+// runRSADemo 协调POW与RSA签名模块
+func runRSADemo() {
 	// 1. 初始化组件
 	pow := NewPOW("Lumos", 4)
 	rsaKeys, err := NewRSAKeyPair(2048)
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ------------------------------
+// 基于栈的锁定脚本引擎
+// ------------------------------
+
+// Opcode 脚本操作码
+type Opcode byte
+
+// 操作码定义（数值沿用比特币脚本）
+const (
+	OP_0         Opcode = 0x00 // 压入空字节串（即false）
+	OP_PUSHDATA1 Opcode = 0x4c // 后跟1字节长度
+	OP_PUSHDATA2 Opcode = 0x4d // 后跟2字节长度（小端）
+	OP_1NEGATE   Opcode = 0x4f
+	OP_1         Opcode = 0x51 // OP_1 ~ OP_16 压入对应整数
+	OP_16        Opcode = 0x60
+
+	OP_IF     Opcode = 0x63
+	OP_NOTIF  Opcode = 0x64
+	OP_ELSE   Opcode = 0x67
+	OP_ENDIF  Opcode = 0x68
+	OP_VERIFY Opcode = 0x69
+	OP_RETURN Opcode = 0x6a
+
+	OP_DROP Opcode = 0x75
+	OP_DUP  Opcode = 0x76
+	OP_SWAP Opcode = 0x7c
+
+	OP_EQUAL       Opcode = 0x87
+	OP_EQUALVERIFY Opcode = 0x88
+
+	OP_SHA256              Opcode = 0xa8
+	OP_HASH160             Opcode = 0xa9 // 与地址相同的公钥哈希（双SHA-256取前20字节）
+	OP_CHECKSIG            Opcode = 0xac
+	OP_CHECKSIGVERIFY      Opcode = 0xad
+	OP_CHECKMULTISIG       Opcode = 0xae
+	OP_CHECKMULTISIGVERIFY Opcode = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY Opcode = 0xb1
+)
+
+// 脚本执行限制
+const (
+	MaxScriptSize      = 10000 // 单个脚本最大字节数
+	MaxScriptOps       = 201   // 单次验证最多执行的非压栈操作数
+	MaxStackSize       = 1000  // 栈元素数上限
+	MaxScriptElement   = 520   // 单个栈元素最大字节数
+	maxScriptNumLength = 5     // 数值元素最大字节数
+)
+
+var opcodeNames = map[Opcode]string{
+	OP_0: "OP_0", OP_PUSHDATA1: "OP_PUSHDATA1", OP_PUSHDATA2: "OP_PUSHDATA2", OP_1NEGATE: "OP_1NEGATE",
+	OP_IF: "OP_IF", OP_NOTIF: "OP_NOTIF", OP_ELSE: "OP_ELSE", OP_ENDIF: "OP_ENDIF",
+	OP_VERIFY: "OP_VERIFY", OP_RETURN: "OP_RETURN",
+	OP_DROP: "OP_DROP", OP_DUP: "OP_DUP", OP_SWAP: "OP_SWAP",
+	OP_EQUAL: "OP_EQUAL", OP_EQUALVERIFY: "OP_EQUALVERIFY",
+	OP_SHA256: "OP_SHA256", OP_HASH160: "OP_HASH160",
+	OP_CHECKSIG: "OP_CHECKSIG", OP_CHECKSIGVERIFY: "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG: "OP_CHECKMULTISIG", OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	if op >= OP_1 && op <= OP_16 {
+		return fmt.Sprintf("OP_%d", op-OP_1+1)
+	}
+	return fmt.Sprintf("OP_UNKNOWN(0x%02x)", byte(op))
+}
+
+// Script 脚本字节码
+type Script []byte
+
+// scriptOp 解析后的一条指令
+type scriptOp struct {
+	opcode Opcode
+	data   []byte // 压栈指令携带的数据
+}
+
+// isPush 是否为压栈指令（不计入操作数）
+func (op scriptOp) isPush() bool {
+	return op.opcode <= OP_16 && op.opcode != 0x50
+}
+
+// parse 将字节码解析为指令序列
+func (s Script) parse() ([]scriptOp, error) {
+	if len(s) > MaxScriptSize {
+		return nil, fmt.Errorf("脚本过长: %d字节", len(s))
+	}
+	var ops []scriptOp
+	for i := 0; i < len(s); {
+		op := Opcode(s[i])
+		i++
+		size := -1
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			size = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(s) {
+				return nil, errors.New("脚本被截断: OP_PUSHDATA1缺少长度")
+			}
+			size = int(s[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(s) {
+				return nil, errors.New("脚本被截断: OP_PUSHDATA2缺少长度")
+			}
+			size = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		}
+		if size < 0 {
+			ops = append(ops, scriptOp{opcode: op})
+			continue
+		}
+		if i+size > len(s) {
+			return nil, fmt.Errorf("脚本被截断: 需要%d字节数据", size)
+		}
+		ops = append(ops, scriptOp{opcode: op, data: s[i : i+size]})
+		i += size
+	}
+	return ops, nil
+}
+
+// IsPushOnly 脚本是否只包含压栈指令（解锁脚本必须满足）
+func (s Script) IsPushOnly() bool {
+	ops, err := s.parse()
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !op.isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// String 反汇编为可读文本
+func (s Script) String() string {
+	ops, err := s.parse()
+	if err != nil {
+		return "[无效脚本] " + hex.EncodeToString(s)
+	}
+	parts := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if op.data != nil {
+			parts = append(parts, hex.EncodeToString(op.data))
+		} else {
+			parts = append(parts, op.opcode.String())
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ------------------------------
+// 脚本构造器
+// ------------------------------
+
+// ScriptBuilder 以链式调用构造脚本
+type ScriptBuilder struct {
+	script Script
+}
+
+func NewScriptBuilder() *ScriptBuilder { return &ScriptBuilder{} }
+
+// AddOp 追加操作码
+func (b *ScriptBuilder) AddOp(op Opcode) *ScriptBuilder {
+	b.script = append(b.script, byte(op))
+	return b
+}
+
+// AddData 追加压栈数据，自动选择最短的压栈方式
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	switch n := len(data); {
+	case n == 0:
+		b.script = append(b.script, byte(OP_0))
+	case n < int(OP_PUSHDATA1):
+		b.script = append(b.script, byte(n))
+	case n <= 0xff:
+		b.script = append(b.script, byte(OP_PUSHDATA1), byte(n))
+	default:
+		b.script = append(b.script, byte(OP_PUSHDATA2))
+		b.script = binary.LittleEndian.AppendUint16(b.script, uint16(n))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt 追加整数，0~16使用单字节操作码
+func (b *ScriptBuilder) AddInt(n int64) *ScriptBuilder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(OP_1 + Opcode(n-1))
+	default:
+		return b.AddData(encodeScriptNum(n))
+	}
+}
+
+// Script 返回构造好的脚本
+func (b *ScriptBuilder) Script() Script {
+	return append(Script(nil), b.script...)
+}
+
+// ------------------------------
+// 标准脚本模板
+// ------------------------------
+
+// PayToPubKeyHashScript 标准P2PKH锁定脚本：
+// OP_DUP OP_HASH160 <公钥哈希> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHashScript(addr Address) Script {
+	hash := addr.Hash()
+	return NewScriptBuilder().
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(hash[:]).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).
+		Script()
+}
+
+// PayToPubKeyHashUnlockScript P2PKH解锁脚本：<签名> <公钥>
+func PayToPubKeyHashUnlockScript(signature, publicKey []byte) Script {
+	return NewScriptBuilder().AddData(signature).AddData(publicKey).Script()
+}
+
+// PayToScriptHashScript 脚本哈希锁定脚本：OP_HASH160 <脚本哈希> OP_EQUAL，
+// 解锁时最后压入的元素作为赎回脚本继续执行
+func PayToScriptHashScript(addr Address) Script {
+	hash := addr.Hash()
+	return NewScriptBuilder().AddOp(OP_HASH160).AddData(hash[:]).AddOp(OP_EQUAL).Script()
+}
+
+// NewScriptAddress 自定义赎回脚本对应的脚本哈希地址
+func NewScriptAddress(redeem Script) Address {
+	return Address{version: AddressVersionScriptHash, hash: hashPublicKey(redeem)}
+}
+
+// LockScriptForAddress 地址对应的标准锁定脚本
+func LockScriptForAddress(addr Address) Script {
+	if addr.IsScriptHash() {
+		return PayToScriptHashScript(addr)
+	}
+	return PayToPubKeyHashScript(addr)
+}
+
+// isPayToScriptHash 判断是否为脚本哈希锁定脚本
+func (s Script) isPayToScriptHash() bool {
+	return len(s) == 23 && Opcode(s[0]) == OP_HASH160 && s[1] == AddressHashLen && Opcode(s[22]) == OP_EQUAL
+}
+
+// ------------------------------
+// 脚本解释器
+// ------------------------------
+
+// ScriptContext 脚本执行所需的交易与区块上下文
+type ScriptContext struct {
+	SigData     []byte // 签名覆盖的交易内容
+	BlockHeight int    // 交易所在（或将要进入）区块的高度
+	BlockTime   int64  // 区块时间戳（纳秒）
+}
+
+// lockTimeThreshold 锁定时间小于该值按区块高度解释，否则按Unix秒解释
+const lockTimeThreshold = 500_000_000
+
+// scriptEngine 单次验证的执行状态
+type scriptEngine struct {
+	ctx   ScriptContext
+	stack [][]byte
+	ops   int
+}
+
+// VerifyScripts 先执行解锁脚本，再以其结果栈执行锁定脚本；
+// 锁定脚本为脚本哈希模板时，继续执行解锁脚本提供的赎回脚本
+func VerifyScripts(unlock, lock Script, ctx ScriptContext) error {
+	if !unlock.IsPushOnly() {
+		return errors.New("解锁脚本只能包含压栈指令")
+	}
+	e := &scriptEngine{ctx: ctx}
+	if err := e.execute(unlock); err != nil {
+		return fmt.Errorf("执行解锁脚本失败: %w", err)
+	}
+	unlockStack := append([][]byte(nil), e.stack...)
+
+	if err := e.execute(lock); err != nil {
+		return fmt.Errorf("执行锁定脚本失败: %w", err)
+	}
+	if !e.topIsTrue() {
+		return errors.New("锁定脚本执行结果为false")
+	}
+
+	if lock.isPayToScriptHash() {
+		if len(unlockStack) == 0 {
+			return errors.New("缺少赎回脚本")
+		}
+		redeem := Script(unlockStack[len(unlockStack)-1])
+		e.stack = unlockStack[:len(unlockStack)-1]
+		if err := e.execute(redeem); err != nil {
+			return fmt.Errorf("执行赎回脚本失败: %w", err)
+		}
+		if !e.topIsTrue() {
+			return errors.New("赎回脚本执行结果为false")
+		}
+	}
+	return nil
+}
+
+func (e *scriptEngine) topIsTrue() bool {
+	return len(e.stack) > 0 && castToBool(e.stack[len(e.stack)-1])
+}
+
+func (e *scriptEngine) push(data []byte) error {
+	if len(data) > MaxScriptElement {
+		return fmt.Errorf("栈元素过大: %d字节", len(data))
+	}
+	if len(e.stack) >= MaxStackSize {
+		return errors.New("栈溢出")
+	}
+	e.stack = append(e.stack, data)
+	return nil
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("栈为空")
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return top, nil
+}
+
+func (e *scriptEngine) popInt() (int64, error) {
+	data, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeScriptNum(data)
+}
+
+func (e *scriptEngine) peek() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("栈为空")
+	}
+	return e.stack[len(e.stack)-1], nil
+}
+
+// countOps 累计操作数并检查上限
+func (e *scriptEngine) countOps(n int) error {
+	e.ops += n
+	if e.ops > MaxScriptOps {
+		return fmt.Errorf("操作数超过上限%d", MaxScriptOps)
+	}
+	return nil
+}
+
+// execute 执行一段脚本，条件分支用执行标记栈实现
+func (e *scriptEngine) execute(script Script) error {
+	ops, err := script.parse()
+	if err != nil {
+		return err
+	}
+
+	var cond []bool // 每层OP_IF是否处于执行分支
+	executing := func() bool {
+		for _, c := range cond {
+			if !c {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, op := range ops {
+		if !op.isPush() {
+			if err := e.countOps(1); err != nil {
+				return err
+			}
+		}
+
+		// 条件控制指令无论是否处于执行分支都要处理
+		switch op.opcode {
+		case OP_IF, OP_NOTIF:
+			branch := false
+			if executing() {
+				top, err := e.pop()
+				if err != nil {
+					return err
+				}
+				branch = castToBool(top) == (op.opcode == OP_IF)
+			}
+			cond = append(cond, branch)
+			continue
+		case OP_ELSE:
+			if len(cond) == 0 {
+				return errors.New("OP_ELSE缺少对应的OP_IF")
+			}
+			cond[len(cond)-1] = !cond[len(cond)-1]
+			continue
+		case OP_ENDIF:
+			if len(cond) == 0 {
+				return errors.New("OP_ENDIF缺少对应的OP_IF")
+			}
+			cond = cond[:len(cond)-1]
+			continue
+		}
+		if !executing() {
+			continue
+		}
+		if err := e.step(op); err != nil {
+			return fmt.Errorf("%s: %w", op.opcode, err)
+		}
+	}
+	if len(cond) != 0 {
+		return errors.New("OP_IF缺少对应的OP_ENDIF")
+	}
+	return nil
+}
+
+// step 执行单条指令
+func (e *scriptEngine) step(op scriptOp) error {
+	switch {
+	case op.data != nil || op.opcode == OP_0:
+		return e.push(op.data)
+	case op.opcode == OP_1NEGATE:
+		return e.push(encodeScriptNum(-1))
+	case op.opcode >= OP_1 && op.opcode <= OP_16:
+		return e.push(encodeScriptNum(int64(op.opcode - OP_1 + 1)))
+	}
+
+	switch op.opcode {
+	case OP_VERIFY:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if !castToBool(top) {
+			return errors.New("验证失败")
+		}
+	case OP_RETURN:
+		return errors.New("脚本被标记为不可花费")
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+	case OP_DUP:
+		top, err := e.peek()
+		if err != nil {
+			return err
+		}
+		return e.push(top)
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return errors.New("栈元素不足")
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if op.opcode == OP_EQUALVERIFY {
+			if !equal {
+				return errors.New("栈顶两元素不相等")
+			}
+			return nil
+		}
+		return e.push(boolToStack(equal))
+	case OP_SHA256:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(top)
+		return e.push(hash[:])
+	case OP_HASH160:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := hashPublicKey(top)
+		return e.push(hash[:])
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		publicKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		ok := VerifySignature(publicKey, e.ctx.SigData, signature) == nil
+		if op.opcode == OP_CHECKSIGVERIFY {
+			if !ok {
+				return errors.New("签名验证失败")
+			}
+			return nil
+		}
+		return e.push(boolToStack(ok))
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		ok, err := e.checkMultisig()
+		if err != nil {
+			return err
+		}
+		if op.opcode == OP_CHECKMULTISIGVERIFY {
+			if !ok {
+				return errors.New("多签验证失败")
+			}
+			return nil
+		}
+		return e.push(boolToStack(ok))
+	case OP_CHECKLOCKTIMEVERIFY:
+		return e.checkLockTime()
+	default:
+		return errors.New("不支持的操作码")
+	}
+	return nil
+}
+
+// checkMultisig 栈布局（自底向上）：<签名1>...<签名m> <m> <公钥1>...<公钥n> <n>，
+// 签名须按公钥顺序排列，每个公钥最多匹配一个签名
+func (e *scriptEngine) checkMultisig() (bool, error) {
+	n, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxMultisigKeys {
+		return false, fmt.Errorf("公钥数量无效: %d", n)
+	}
+	if err := e.countOps(int(n)); err != nil {
+		return false, err
+	}
+	publicKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if publicKeys[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+	m, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("签名数量无效: %d", m)
+	}
+	signatures := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if signatures[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	k := 0
+	for _, sig := range signatures {
+		for k < len(publicKeys) && VerifySignature(publicKeys[k], e.ctx.SigData, sig) != nil {
+			k++
+		}
+		if k == len(publicKeys) {
+			return false, nil
+		}
+		k++
+	}
+	return true, nil
+}
+
+// checkLockTime 栈顶数值为锁定时间：小于阈值比较区块高度，否则比较区块时间（Unix秒），
+// 未到期则失败；数值保留在栈上
+func (e *scriptEngine) checkLockTime() error {
+	top, err := e.peek()
+	if err != nil {
+		return err
+	}
+	lockTime, err := decodeScriptNum(top)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return errors.New("锁定时间为负数")
+	}
+	if lockTime < lockTimeThreshold {
+		if int64(e.ctx.BlockHeight) < lockTime {
+			return fmt.Errorf("未到锁定高度: 当前%d，需要%d", e.ctx.BlockHeight, lockTime)
+		}
+		return nil
+	}
+	if now := e.ctx.BlockTime / 1e9; now < lockTime {
+		return fmt.Errorf("未到锁定时间: 当前%d，需要%d", now, lockTime)
+	}
+	return nil
+}
+
+// ------------------------------
+// 栈元素编码
+// ------------------------------
+
+// castToBool 空串或全零（允许负零）为false
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+func boolToStack(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return nil
+}
+
+// encodeScriptNum 小端符号-数值编码，最高字节的最高位为符号位
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+	var out []byte
+	for abs > 0 {
+		out = append(out, byte(abs&0xff))
+		abs >>= 8
+	}
+	if out[len(out)-1]&0x80 != 0 {
+		extra := byte(0)
+		if negative {
+			extra = 0x80
+		}
+		out = append(out, extra)
+	} else if negative {
+		out[len(out)-1] |= 0x80
+	}
+	return out
+}
+
+// decodeScriptNum 解码数值元素，长度不超过5字节
+func decodeScriptNum(data []byte) (int64, error) {
+	if len(data) > maxScriptNumLength {
+		return 0, fmt.Errorf("数值元素过长: %d字节", len(data))
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var v int64
+	for i, b := range data {
+		v |= int64(b) << (8 * uint(i))
+	}
+	last := data[len(data)-1]
+	if last&0x80 != 0 {
+		v &^= int64(0x80) << (8 * uint(len(data)-1))
+		return -v, nil
+	}
+	return v, nil
+}
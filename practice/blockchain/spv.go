@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ------------------------------
+// SPV轻节点：只同步并校验区块头（链接关系与工作量证明），
+// 通过向全节点请求Merkle包含证明来确认交易已上链
+// ------------------------------
+
+// MaxHeadersPerResponse 每次响应最多返回的区块头数
+const MaxHeadersPerResponse = 2000
+
+// SPV请求类型
+const (
+	SPVGetHeaders = "get_headers" // 从指定高度起获取区块头
+	SPVGetProof   = "get_proof"   // 获取交易的Merkle包含证明
+)
+
+// SPVRequest 轻节点发给全节点的请求
+type SPVRequest struct {
+	Type string `json:"type"`
+	From int    `json:"from,omitempty"` // get_headers: 起始高度
+	TxID string `json:"txid,omitempty"` // get_proof: 交易ID
+}
+
+// SPVResponse 全节点的响应，Error非空表示请求失败
+type SPVResponse struct {
+	Headers []BlockHeader `json:"headers,omitempty"`
+	Proof   *TxProof      `json:"proof,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// TxProof 交易所在区块及其Merkle包含证明
+type TxProof struct {
+	BlockHash   string      `json:"block_hash"`
+	BlockHeight int         `json:"block_height"`
+	Merkle      MerkleProof `json:"merkle"`
+}
+
+// ------------------------------
+// 全节点侧：响应轻节点请求
+// ------------------------------
+
+// SPVServer 为轻节点提供区块头与交易证明，同时实现 http.Handler（POST JSON）
+type SPVServer struct {
+	bc *Blockchain
+}
+
+// NewSPVServer 创建SPV服务
+func NewSPVServer(bc *Blockchain) *SPVServer {
+	return &SPVServer{bc: bc}
+}
+
+// Handle 处理一条请求
+func (s *SPVServer) Handle(req SPVRequest) SPVResponse {
+	switch req.Type {
+	case SPVGetHeaders:
+		var headers []BlockHeader
+		for height := req.From; len(headers) < MaxHeadersPerResponse; height++ {
+			header, ok := s.bc.GetHeaderByHeight(height)
+			if !ok {
+				break
+			}
+			headers = append(headers, header)
+		}
+		return SPVResponse{Headers: headers}
+	case SPVGetProof:
+		loc, err := s.bc.GetTransaction(req.TxID)
+		if err != nil {
+			return SPVResponse{Error: err.Error()}
+		}
+		merkle, err := NewMerkleProof(transactionIDs(loc.Block.Transactions()), loc.Position)
+		if err != nil {
+			return SPVResponse{Error: err.Error()}
+		}
+		return SPVResponse{Proof: &TxProof{
+			BlockHash:   loc.Block.Hash(),
+			BlockHeight: loc.Block.Index(),
+			Merkle:      merkle,
+		}}
+	default:
+		return SPVResponse{Error: "未知的请求类型: " + req.Type}
+	}
+}
+
+// ServeHTTP 以JSON接收SPVRequest并返回SPVResponse
+func (s *SPVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req SPVRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "请求格式错误: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Handle(req))
+}
+
+// ------------------------------
+// 传输层
+// ------------------------------
+
+// SPVTransport 轻节点与全节点之间的请求/响应通道
+type SPVTransport interface {
+	RoundTrip(req SPVRequest) (SPVResponse, error)
+}
+
+// localTransport 进程内传输，仍经过JSON编解码以保持与网络传输一致
+type localTransport struct {
+	server *SPVServer
+}
+
+// NewLocalTransport 直接连接同一进程内的全节点
+func NewLocalTransport(server *SPVServer) SPVTransport {
+	return localTransport{server: server}
+}
+
+func (t localTransport) RoundTrip(req SPVRequest) (SPVResponse, error) {
+	var decoded SPVRequest
+	if err := jsonRoundTrip(req, &decoded); err != nil {
+		return SPVResponse{}, err
+	}
+	var resp SPVResponse
+	err := jsonRoundTrip(t.server.Handle(decoded), &resp)
+	return resp, err
+}
+
+func jsonRoundTrip(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// HTTPTransport 通过HTTP连接全节点的SPVServer
+type HTTPTransport struct {
+	URL    string
+	Client *http.Client // 为nil时使用http.DefaultClient
+}
+
+// RoundTrip 发送请求并解析响应
+func (t HTTPTransport) RoundTrip(req SPVRequest) (SPVResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return SPVResponse{}, err
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpResp, err := client.Post(t.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return SPVResponse{}, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return SPVResponse{}, fmt.Errorf("全节点返回 %s", httpResp.Status)
+	}
+	var resp SPVResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return SPVResponse{}, fmt.Errorf("响应格式错误: %w", err)
+	}
+	return resp, nil
+}
+
+// ------------------------------
+// 轻节点
+// ------------------------------
+
+// LightClient 只保存区块头的轻节点，可并发使用
+type LightClient struct {
+	mu        sync.RWMutex
+	path      string // 区块头持久化文件，为空则只保存在内存
+	transport SPVTransport
+	genesis   *Genesis       // 受信任的创世配置，决定创世区块头与工作量证明参数
+	headers   []BlockHeader  // 按高度排列，headers[0]为创世区块头
+	byHash    map[string]int // 区块哈希 -> 高度
+}
+
+// NewLightClient 以受信任的创世配置创建轻节点
+func NewLightClient(path string, transport SPVTransport, genesis *Genesis) (*LightClient, error) {
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+	if genesis.consensus() != ConsensusPoW {
+		return nil, errors.New("轻节点目前只支持工作量证明链")
+	}
+	header := genesis.Block().Header()
+	return &LightClient{
+		path:      path,
+		transport: transport,
+		genesis:   genesis,
+		headers:   []BlockHeader{header},
+		byHash:    map[string]int{header.Hash: 0},
+	}, nil
+}
+
+// Height 本地区块头链的高度
+func (c *LightClient) Height() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.headers) - 1
+}
+
+// Header 按高度获取本地区块头
+func (c *LightClient) Header(height int) (BlockHeader, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if height < 0 || height >= len(c.headers) {
+		return BlockHeader{}, false
+	}
+	return c.headers[height], true
+}
+
+// Sync 从全节点同步新的区块头，返回本地高度的净增加量。
+// 全节点的链与本地分叉时，比较双方自分叉点起的累计权重，只有全节点的分支更重才切换；
+// 创世区块头不回退
+func (c *LightClient) Sync() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	height := len(c.headers) - 1
+	fork, err := c.findFork()
+	if err != nil {
+		return 0, err
+	}
+	branch, err := c.fetchBranch(fork)
+	if fork < height {
+		if err != nil {
+			return 0, err
+		}
+		if c.weight(branch).Cmp(c.weight(c.headers[fork+1:])) <= 0 {
+			return 0, fmt.Errorf("全节点自高度%d起的分叉不比本地链重，保留本地链", fork+1)
+		}
+		for len(c.headers) > fork+1 {
+			c.rollback()
+		}
+	}
+	for _, header := range branch {
+		c.headers = append(c.headers, header)
+		c.byHash[header.Hash] = header.Index
+	}
+	return len(c.headers) - 1 - height, err
+}
+
+// findFork 从本地链尾向前查找与全节点相同的最高区块头，返回其高度
+func (c *LightClient) findFork() (int, error) {
+	for height := len(c.headers) - 1; height >= 0; height-- {
+		resp, err := c.request(SPVRequest{Type: SPVGetHeaders, From: height})
+		if err != nil {
+			return 0, err
+		}
+		if len(resp.Headers) > 0 && resp.Headers[0].Hash == c.headers[height].Hash {
+			return height, nil
+		}
+	}
+	return 0, errors.New("全节点的链与受信任的创世区块不一致")
+}
+
+// fetchBranch 获取并逐个校验全节点在fork之后的区块头，出错时同时返回已校验的部分
+func (c *LightClient) fetchBranch(fork int) ([]BlockHeader, error) {
+	parent := c.headers[fork]
+	var branch []BlockHeader
+	for {
+		resp, err := c.request(SPVRequest{Type: SPVGetHeaders, From: parent.Index + 1})
+		if err != nil {
+			return branch, err
+		}
+		if len(resp.Headers) == 0 {
+			return branch, nil
+		}
+		for _, header := range resp.Headers {
+			if err := c.checkHeader(parent, header); err != nil {
+				return branch, fmt.Errorf("区块头%d无效: %w", header.Index, err)
+			}
+			branch = append(branch, header)
+			parent = header
+		}
+	}
+}
+
+// weight 区块头的累计分叉选择权重
+func (c *LightClient) weight(headers []BlockHeader) *big.Int {
+	pow := newProofOfWork(c.genesis)
+	total := new(big.Int)
+	for _, header := range headers {
+		total.Add(total, pow.Weight(nil, header))
+	}
+	return total
+}
+
+// checkHeader 校验区块头能否接在parent之后：高度、链接、哈希与工作量证明
+func (c *LightClient) checkHeader(parent, header BlockHeader) error {
+	if header.Index != parent.Index+1 {
+		return fmt.Errorf("高度应为%d", parent.Index+1)
+	}
+	if header.PreviousHash != parent.Hash {
+		return errors.New("前一区块哈希不匹配")
+	}
+	if header.Hash != header.calculateHash() {
+		return errors.New("区块哈希与区块头不符")
+	}
+	return newProofOfWork(c.genesis).verifyHeader(parent, header)
+}
+
+func (c *LightClient) rollback() {
+	tip := c.headers[len(c.headers)-1]
+	delete(c.byHash, tip.Hash)
+	c.headers = c.headers[:len(c.headers)-1]
+}
+
+// VerifyPayment 向全节点请求交易的Merkle证明，并用本地区块头校验，
+// 返回交易所在区块的确认数（所在区块本身算1个确认）
+func (c *LightClient) VerifyPayment(txid string) (confirmations int, err error) {
+	resp, err := c.request(SPVRequest{Type: SPVGetProof, TxID: txid})
+	if err != nil {
+		return 0, err
+	}
+	proof := resp.Proof
+	if proof == nil {
+		return 0, errors.New("全节点未返回证明")
+	}
+	if proof.Merkle.TxID != txid {
+		return 0, errors.New("证明中的交易ID与请求不符")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	height, ok := c.byHash[proof.BlockHash]
+	if !ok || height != proof.BlockHeight {
+		return 0, fmt.Errorf("区块 %s 不在本地区块头链上，请先同步", proof.BlockHash)
+	}
+	if err := proof.Merkle.Verify(c.headers[height].MerkleRoot); err != nil {
+		return 0, err
+	}
+	return len(c.headers) - height, nil
+}
+
+func (c *LightClient) request(req SPVRequest) (SPVResponse, error) {
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return SPVResponse{}, err
+	}
+	if resp.Error != "" {
+		return SPVResponse{}, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// lightClientFile 区块头的持久化格式
+type lightClientFile struct {
+	Genesis *Genesis      `json:"genesis"`
+	Headers []BlockHeader `json:"headers"`
+}
+
+// Save 将区块头保存到文件
+func (c *LightClient) Save() error {
+	if c.path == "" {
+		return errors.New("轻节点未设置保存路径")
+	}
+	c.mu.RLock()
+	data, err := json.MarshalIndent(lightClientFile{Genesis: c.genesis, Headers: c.headers}, "", "  ")
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0644)
+}
+
+// LoadLightClient 从文件加载区块头，逐个重新校验
+func LoadLightClient(path string, transport SPVTransport) (*LightClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file lightClientFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("区块头文件格式错误: %w", err)
+	}
+	if file.Genesis == nil || len(file.Headers) == 0 {
+		return nil, errors.New("区块头文件缺少创世配置或区块头")
+	}
+	c, err := NewLightClient(path, transport, file.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	if first := file.Headers[0]; first.Hash != c.headers[0].Hash || first.Hash != first.calculateHash() {
+		return nil, errors.New("区块头文件的创世区块头与创世配置不符")
+	}
+	for _, header := range file.Headers[1:] {
+		if err := c.checkHeader(c.headers[len(c.headers)-1], header); err != nil {
+			return nil, fmt.Errorf("区块头%d无效: %w", header.Index, err)
+		}
+		c.headers = append(c.headers, header)
+		c.byHash[header.Hash] = header.Index
+	}
+	return c, nil
+}
+
+// ------------------------------
+// 演示使用：轻节点验证支付
+// ------------------------------
+
+// runSPVDemo 全节点出块，轻节点只同步区块头并验证一笔付款
+func runSPVDemo() {
+	wallet := NewWallet("")
+	alice, _ := wallet.NewKey("alice")
+	bob, _ := wallet.NewKey("bob")
+
+	bc := NewDevBlockchain(3)
+	bc.SetMinerAddress(alice)
+	bc.MineBlock()
+	payment, err := wallet.Send(bc, alice, bob, 3*Coin)
+	if err != nil {
+		fmt.Printf("付款失败: %v\n", err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		bc.MineBlock()
+	}
+
+	client, err := NewLightClient("", NewLocalTransport(NewSPVServer(bc)), bc.Genesis())
+	if err != nil {
+		fmt.Printf("创建轻节点失败: %v\n", err)
+		return
+	}
+	added, err := client.Sync()
+	if err != nil {
+		fmt.Printf("同步失败: %v\n", err)
+		return
+	}
+	fmt.Printf("轻节点同步了%d个区块头，当前高度%d\n", added, client.Height())
+
+	confirmations, err := client.VerifyPayment(payment.ID())
+	if err != nil {
+		fmt.Printf("付款验证失败: %v\n", err)
+		return
+	}
+	fmt.Printf("付款 %s 已上链，确认数 %d\n", shortHash(payment.ID()), confirmations)
+
+	if _, err := client.VerifyPayment(NewTransaction(alice, bob, Coin).ID()); err != nil {
+		fmt.Printf("未上链的交易验证失败: %v\n", err)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ------------------------------
+// 质押：质押、解除质押与双签惩罚都以交易形式上链。
+// 质押金额从可花费余额转入质押；解除质押的资金带相对时间锁返还；
+// 双签被举报的验证者质押与尚未到期的解除质押资金全部销毁，并永久失去出块资格
+// ------------------------------
+
+// TxKind 交易类型
+type TxKind uint8
+
+// 交易类型
+const (
+	TxTransfer  TxKind = iota // 普通转账
+	TxStake                   // 质押：金额从发送方余额转入其质押
+	TxUnstake                 // 解除质押：金额从发送方质押返还其余额
+	TxSlash                   // 惩罚：举报双签，被举报者的质押与解绑中的资金全部销毁
+	TxDeploy                  // 部署合约：数据为合约代码，收款方为由发送方与序号派生的合约地址
+	TxInvoke                  // 调用合约：数据为调用参数（EVM合约为calldata），收款方为合约地址
+	TxDeployEVM               // 部署EVM合约：数据为初始化代码，其返回值作为运行时代码
+)
+
+var txKindNames = map[TxKind]string{
+	TxTransfer:  "transfer",
+	TxStake:     "stake",
+	TxUnstake:   "unstake",
+	TxSlash:     "slash",
+	TxDeploy:    "deploy",
+	TxInvoke:    "invoke",
+	TxDeployEVM: "deploy_evm",
+}
+
+func (k TxKind) String() string {
+	if name, ok := txKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("TxKind(%d)", uint8(k))
+}
+
+// MarshalText 序列化为类型名
+func (k TxKind) MarshalText() ([]byte, error) {
+	if _, ok := txKindNames[k]; !ok {
+		return nil, fmt.Errorf("未知的交易类型: %d", uint8(k))
+	}
+	return []byte(k.String()), nil
+}
+
+// checkKind 检查交易类型与金额、收款方、证据是否匹配
+func (t *Transaction) checkKind() error {
+	switch t.kind {
+	case TxTransfer:
+		if t.amount == 0 {
+			return errors.New("交易金额必须为正数")
+		}
+	case TxStake, TxUnstake:
+		if t.amount == 0 {
+			return errors.New("交易金额必须为正数")
+		}
+		if t.recipient != t.sender {
+			return fmt.Errorf("%s交易的收款方必须是发送方", t.kind)
+		}
+	case TxSlash:
+		if t.amount != 0 || t.evidence == nil || t.recipient != t.sender {
+			return errors.New("惩罚交易须由举报者发给自己、金额为0并携带双签证据")
+		}
+	case TxDeploy, TxInvoke, TxDeployEVM:
+		if err := t.checkContract(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("未知的交易类型: %d", uint8(t.kind))
+	}
+	if t.kind != TxSlash && t.evidence != nil {
+		return errors.New("只有惩罚交易可以携带双签证据")
+	}
+	if !t.isContractTx() {
+		if len(t.data) > 0 || t.gasLimit != 0 {
+			return errors.New("只有合约交易可以携带数据与gas上限")
+		}
+		if t.recipient.IsContract() {
+			return errors.New("不能向合约地址转账")
+		}
+	}
+	return nil
+}
+
+// withKind 设置交易类型
+func withKind(kind TxKind) TxOption {
+	return func(t *Transaction) { t.kind = kind }
+}
+
+// ------------------------------
+// 质押状态
+// ------------------------------
+
+// stakeState 地址的质押状态
+type stakeState struct {
+	stake  Amount
+	jailed bool // 因双签被惩罚，不能再质押或出块
+}
+
+// stakeTable 各地址的质押状态
+type stakeTable map[Address]stakeState
+
+func (s stakeTable) clone() stakeTable {
+	c := make(stakeTable, len(s))
+	for addr, st := range s {
+		c[addr] = st
+	}
+	return c
+}
+
+// apply 按交易更新质押状态（创世区块以奖励交易的形式记录初始质押）
+func (s stakeTable) apply(tx *Transaction) error {
+	switch tx.Kind() {
+	case TxStake:
+		st := s[tx.Recipient()]
+		if st.jailed {
+			return fmt.Errorf("地址 %s 已因双签被惩罚，不能再质押", tx.Recipient())
+		}
+		var err error
+		if st.stake, err = st.stake.Add(tx.Amount()); err != nil {
+			return err
+		}
+		s[tx.Recipient()] = st
+	case TxUnstake:
+		st := s[tx.Sender()]
+		remaining, err := st.stake.Sub(tx.Amount())
+		if err != nil {
+			return fmt.Errorf("质押不足: 已质押 %s，解除 %s", st.stake, tx.Amount())
+		}
+		st.stake = remaining
+		s[tx.Sender()] = st
+	case TxSlash:
+		offender, err := tx.Evidence().offender()
+		if err != nil {
+			return err
+		}
+		if s[offender].jailed {
+			return fmt.Errorf("地址 %s 已被惩罚", offender)
+		}
+		s[offender] = stakeState{jailed: true}
+	}
+	return nil
+}
+
+// stakeTable 由基准快照与其后的区块重新计算质押状态，调用方需持有锁
+func (bc *Blockchain) stakeTable() (stakeTable, error) {
+	stakes := make(stakeTable)
+	if bc.base != nil {
+		for _, acc := range bc.base.Accounts {
+			if acc.Stake > 0 || acc.Jailed {
+				stakes[acc.Address] = stakeState{stake: acc.Stake, jailed: acc.Jailed}
+			}
+		}
+	}
+	for _, block := range bc.unsnapshotted() {
+		for _, tx := range block.Transactions() {
+			if err := stakes.apply(tx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stakes, nil
+}
+
+// tipStakes 链尾的质押状态，随区块接入增量更新，调用方需持有锁且不能修改返回值
+func (bc *Blockchain) tipStakes() stakeTable {
+	return bc.stakes
+}
+
+// connectStakes 区块接入链尾时更新质押状态，调用方需持有写锁；
+// 已确认区块均经过质押校验，出错说明链数据已损坏
+func (bc *Blockchain) connectStakes(block *Block) {
+	for _, tx := range block.Transactions() {
+		if err := bc.stakes.apply(tx); err != nil {
+			panic(fmt.Sprintf("链上质押状态不一致: %v", err))
+		}
+	}
+}
+
+// resetStakes 回滚区块或更换基准快照后重新计算质押状态，调用方需持有写锁
+func (bc *Blockchain) resetStakes() {
+	stakes, err := bc.stakeTable()
+	if err != nil {
+		panic(fmt.Sprintf("链上质押状态不一致: %v", err))
+	}
+	bc.stakes = stakes
+}
+
+// checkStakingTx 检查质押相关交易并更新stakes，调用方需持有锁
+func (bc *Blockchain) checkStakingTx(tx *Transaction, stakes stakeTable) error {
+	switch tx.Kind() {
+	case TxTransfer, TxDeploy, TxInvoke, TxDeployEVM:
+		return nil
+	}
+	pos, ok := bc.engine.(*ProofOfStake)
+	if !ok {
+		return fmt.Errorf("%s共识不支持%s交易", bc.engine.Name(), tx.Kind())
+	}
+	switch tx.Kind() {
+	case TxUnstake:
+		if tx.RelativeLock() < pos.config.UnbondingBlocks {
+			return fmt.Errorf("解除质押的资金须至少锁定%d个区块", pos.config.UnbondingBlocks)
+		}
+	case TxSlash:
+		if _, err := tx.Evidence().Verify(bc.chainID); err != nil {
+			return fmt.Errorf("双签证据无效: %w", err)
+		}
+	}
+	return stakes.apply(tx)
+}
+
+// Validator 验证者及其质押
+type Validator struct {
+	Address Address
+	Stake   Amount
+}
+
+// validators 质押不低于minStake且未被惩罚的验证者，按地址排序
+func (s stakeTable) validators(minStake Amount) []Validator {
+	var list []Validator
+	for addr, st := range s {
+		if !st.jailed && st.stake > 0 && st.stake >= minStake {
+			list = append(list, Validator{Address: addr, Stake: st.stake})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address.String() < list[j].Address.String() })
+	return list
+}
+
+// StakeOf 查询地址当前的质押金额
+func (bc *Blockchain) StakeOf(addr Address) Amount {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.tipStakes()[addr].stake
+}
+
+// IsJailed 查询地址是否因双签被惩罚
+func (bc *Blockchain) IsJailed(addr Address) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.tipStakes()[addr].jailed
+}
+
+// ------------------------------
+// 双签证据
+// ------------------------------
+
+// DoubleSignEvidence 同一出块者在同一高度、同一父区块、同一轮次签名了两个不同区块头的证据；
+// 链重组后在新父区块上出块，或BFT换轮后重新提案，都不算双签
+type DoubleSignEvidence struct {
+	First  BlockHeader `json:"first"`
+	Second BlockHeader `json:"second"`
+}
+
+// NewDoubleSignEvidence 由两个冲突的区块头生成证据，按哈希排序使同一对区块头的证据唯一
+func NewDoubleSignEvidence(a, b BlockHeader) *DoubleSignEvidence {
+	if b.Hash < a.Hash {
+		a, b = b, a
+	}
+	return &DoubleSignEvidence{First: a, Second: b}
+}
+
+// offender 被举报的出块者（不校验签名，用于已上链的证据）
+func (e *DoubleSignEvidence) offender() (Address, error) {
+	return sealSigner(e.First)
+}
+
+// Verify 校验证据：两个区块头的高度、父区块与轮次相同而内容不同，且由同一出块者为本链签名，返回该出块者
+func (e *DoubleSignEvidence) Verify(chainID string) (Address, error) {
+	if e.First.Index != e.Second.Index {
+		return Address{}, errors.New("两个区块头的高度不同")
+	}
+	if e.First.PreviousHash != e.Second.PreviousHash {
+		return Address{}, errors.New("两个区块头的父区块不同")
+	}
+	if e.First.Round != e.Second.Round {
+		return Address{}, errors.New("两个区块头的轮次不同")
+	}
+	if e.First.Hash >= e.Second.Hash {
+		return Address{}, errors.New("两个区块头相同或未按哈希排序")
+	}
+	var signers [2]Address
+	for i, header := range []BlockHeader{e.First, e.Second} {
+		if header.Hash != header.calculateHash() {
+			return Address{}, fmt.Errorf("第%d个区块头的哈希与内容不符", i+1)
+		}
+		signer, err := verifySignerSeal(chainID, header)
+		if err != nil {
+			return Address{}, fmt.Errorf("第%d个区块头: %w", i+1, err)
+		}
+		signers[i] = signer
+	}
+	if signers[0] != signers[1] {
+		return Address{}, errors.New("两个区块头的出块者不同")
+	}
+	return signers[0], nil
+}
+
+// ------------------------------
+// 钱包：质押操作
+// ------------------------------
+
+// Stake 将金额从地址余额转入其质押
+func (w *Wallet) Stake(bc *Blockchain, from Address, amount Amount, opts ...TxOption) (*Transaction, error) {
+	return w.Send(bc, from, from, amount, append([]TxOption{withKind(TxStake)}, opts...)...)
+}
+
+// Unstake 解除质押，资金按共识规定的解绑期锁定后返还余额
+func (w *Wallet) Unstake(bc *Blockchain, from Address, amount Amount, opts ...TxOption) (*Transaction, error) {
+	pos, ok := bc.Engine().(*ProofOfStake)
+	if !ok {
+		return nil, fmt.Errorf("%s共识不支持质押", bc.Engine().Name())
+	}
+	base := []TxOption{withKind(TxUnstake), WithRelativeLock(pos.config.UnbondingBlocks)}
+	return w.Send(bc, from, from, amount, append(base, opts...)...)
+}
+
+// ReportDoubleSign 提交双签证据，被举报者的质押与尚未到期的解除质押资金将被销毁
+func (w *Wallet) ReportDoubleSign(bc *Blockchain, from Address, evidence *DoubleSignEvidence, opts ...TxOption) (*Transaction, error) {
+	base := []TxOption{withKind(TxSlash), func(t *Transaction) { t.evidence = evidence }}
+	return w.Send(bc, from, from, 0, append(base, opts...)...)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ------------------------------
+// 时间锁：绝对时间锁（交易最早可打包时间）与相对时间锁（输出的花费延迟）
+// ------------------------------
+
+// SetLockTime 设置绝对时间锁，需在签名前调用
+func (t *Transaction) SetLockTime(lockTime int64) {
+	t.lockTime = lockTime
+}
+
+// MaxRelativeLock 相对时间锁的区块数上限，保证解锁高度的计算不会溢出
+const MaxRelativeLock = math.MaxInt32
+
+// SetRelativeLock 设置输出的相对时间锁（区块数），需在签名前调用
+func (t *Transaction) SetRelativeLock(blocks int) {
+	t.relativeLock = blocks
+}
+
+// validTimeLocks 时间锁不能为负数，相对时间锁不能超过上限
+func (t *Transaction) validTimeLocks() bool {
+	return t.lockTime >= 0 && t.relativeLock >= 0 && t.relativeLock <= MaxRelativeLock
+}
+
+// IsFinal 判断交易能否打包进指定高度和时间戳（纳秒）的区块
+func (t *Transaction) IsFinal(blockIndex int, blockTimestamp int64) bool {
+	if t.lockTime == 0 {
+		return true
+	}
+	if t.lockTime < lockTimeThreshold {
+		return int64(blockIndex) >= t.lockTime
+	}
+	return blockTimestamp/int64(time.Second) >= t.lockTime
+}
+
+// TxOption 构造交易时的可选设置
+type TxOption func(*Transaction)
+
+// WithLockTime 交易在指定区块高度或Unix秒之前不能打包
+func WithLockTime(lockTime int64) TxOption {
+	return func(t *Transaction) { t.SetLockTime(lockTime) }
+}
+
+// WithRelativeLock 收款方需等待交易打包后指定区块数才能花费
+func WithRelativeLock(blocks int) TxOption {
+	return func(t *Transaction) { t.SetRelativeLock(blocks) }
+}
+
+// SpendableBalance 下一个区块中可花费的余额（不含未到期的相对时间锁资金）
+func (bc *Blockchain) SpendableBalance(addr Address) Amount {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return mustBalance(bc.spendableBalanceAt(addr, bc.lastBlock().Index()+1))
+}
+
+// spendableBalanceAt 计算在指定高度的区块中可花费的余额：基准快照加索引中其后区块的收支
+func (bc *Blockchain) spendableBalanceAt(addr Address, height int) (Amount, error) {
+	base, err := bc.base.spendableAt(addr, height)
+	if err != nil {
+		return 0, err
+	}
+	return bc.index.accounts[addr].spendableAt(base, height)
+}
+
+// ------------------------------
+// 演示使用：归属期（相对时间锁）与托管（绝对时间锁）
+// ------------------------------
+
+// runTimeLockDemo 演示时间锁交易在挖矿时的处理
+func runTimeLockDemo() {
+	wallet := NewWallet("")
+	company, _ := wallet.NewKey("company")
+	employee, _ := wallet.NewKey("employee")
+	shop, _ := wallet.NewKey("shop")
+
+	bc := NewDevBlockchain(3)
+	bc.SetMinerAddress(company)
+	bc.MineBlock()
+
+	// 归属期：员工收到的10需等待2个区块才能花费
+	if _, err := wallet.Send(bc, company, employee, 10*Coin, WithRelativeLock(2)); err != nil {
+		fmt.Printf("发放失败: %v\n", err)
+		return
+	}
+	bc.MineBlock()
+	fmt.Printf("高度%d: 员工余额 %s，可花费 %s\n",
+		bc.LastBlock().Index(), bc.Balance(employee), bc.SpendableBalance(employee))
+	if _, err := wallet.Send(bc, employee, shop, Coin); err != nil {
+		fmt.Printf("归属期内转账被拒绝: %v\n", err)
+	}
+	bc.MineBlock()
+	fmt.Printf("高度%d: 员工可花费 %s\n", bc.LastBlock().Index(), bc.SpendableBalance(employee))
+
+	// 托管：到达指定高度前交易留在待打包列表
+	release := int64(bc.LastBlock().Index() + 2)
+	if _, err := wallet.Send(bc, company, shop, 5*Coin, WithLockTime(release)); err != nil {
+		fmt.Printf("托管交易提交失败: %v\n", err)
+		return
+	}
+	for bc.Balance(shop) == 0 {
+		block := bc.MineBlock()
+		fmt.Printf("挖出区块%d，打包交易%d笔，待打包%d笔\n",
+			block.Index(), len(block.Transactions())-1, len(bc.PendingTransactions()))
+	}
+	fmt.Printf("托管资金已于高度%d释放，商家余额 %s\n", bc.LastBlock().Index(), bc.Balance(shop))
+}
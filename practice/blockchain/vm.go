@@ -0,0 +1,839 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------
+// 合约虚拟机：确定性的栈式虚拟机，栈元素为字节串，数值按大端无符号整数（最多8字节）解释。
+// 每条指令按gas表计费，gas耗尽或执行失败时回滚本次调用的全部存储修改；
+// 合约可读写自己的键值存储，并可调用其他合约
+// ------------------------------
+
+// VMOp 合约虚拟机操作码
+type VMOp byte
+
+// 操作码定义
+const (
+	VM_STOP VMOp = 0x00 // 结束执行，返回空数据
+	VM_PUSH VMOp = 0x01 // 后跟1字节长度与数据
+	VM_POP  VMOp = 0x02
+	VM_DUP  VMOp = 0x03 // 后跟1字节n：复制从栈顶数第n个元素（0为栈顶）
+	VM_SWAP VMOp = 0x04 // 后跟1字节n（n≥1）：交换栈顶与从栈顶数第n个元素
+
+	VM_ADD VMOp = 0x10 // 数值运算溢出、下溢或除以0时执行失败
+	VM_SUB VMOp = 0x11 // a b SUB => a-b
+	VM_MUL VMOp = 0x12
+	VM_DIV VMOp = 0x13
+	VM_MOD VMOp = 0x14
+
+	VM_LT     VMOp = 0x20 // a b LT => a<b
+	VM_GT     VMOp = 0x21
+	VM_EQ     VMOp = 0x22 // 按字节比较
+	VM_ISZERO VMOp = 0x23
+	VM_AND    VMOp = 0x24 // 按真假值做逻辑运算
+	VM_OR     VMOp = 0x25
+	VM_CONCAT VMOp = 0x28 // a b CONCAT => ab，用于拼接存储键
+
+	VM_JUMP  VMOp = 0x30 // 后跟2字节目标偏移（大端），须为指令起始位置
+	VM_JUMPI VMOp = 0x31 // 弹出条件，为真时跳转
+
+	VM_SLOAD  VMOp = 0x40 // key SLOAD => value，不存在时为空串
+	VM_SSTORE VMOp = 0x41 // key value SSTORE，写入空串即删除
+
+	VM_CALLER  VMOp = 0x50 // 调用方地址（文本形式）
+	VM_ADDRESS VMOp = 0x51 // 当前合约地址（文本形式）
+	VM_ARG     VMOp = 0x52 // 后跟1字节n：压入第n个调用参数，不存在时为空串
+	VM_ARGC    VMOp = 0x53 // 调用参数个数
+	VM_HEIGHT  VMOp = 0x54 // 所在区块高度
+	VM_TIME    VMOp = 0x55 // 所在区块时间（Unix秒）
+
+	VM_CALL VMOp = 0x60 // <参数1>...<参数n> <n> <地址> CALL => <返回数据> <成功标志>
+
+	VM_RETURN VMOp = 0x70 // 以栈顶元素为返回数据结束执行
+	VM_REVERT VMOp = 0x71 // 以栈顶元素为原因回滚本次调用
+)
+
+// 虚拟机执行限制
+const (
+	MaxContractCodeSize = 24576 // 合约代码最大字节数
+	MaxVMStack          = 1024  // 栈元素数上限
+	MaxVMElement        = 1024  // 栈元素与存储值的最大字节数
+	MaxVMCallDepth      = 64    // 合约调用的最大嵌套深度
+	MaxVMArgs           = 64    // 调用参数个数上限
+	MaxTxGas            = 1_000_000
+)
+
+// ErrOutOfGas 执行过程中gas耗尽
+var ErrOutOfGas = errors.New("gas不足")
+
+// ErrExecutionReverted 合约主动回滚（REVERT）
+var ErrExecutionReverted = errors.New("执行被回滚")
+
+var vmOpNames = map[VMOp]string{
+	VM_STOP: "STOP", VM_PUSH: "PUSH", VM_POP: "POP", VM_DUP: "DUP", VM_SWAP: "SWAP",
+	VM_ADD: "ADD", VM_SUB: "SUB", VM_MUL: "MUL", VM_DIV: "DIV", VM_MOD: "MOD",
+	VM_LT: "LT", VM_GT: "GT", VM_EQ: "EQ", VM_ISZERO: "ISZERO", VM_AND: "AND", VM_OR: "OR",
+	VM_CONCAT: "CONCAT", VM_JUMP: "JUMP", VM_JUMPI: "JUMPI",
+	VM_SLOAD: "SLOAD", VM_SSTORE: "SSTORE",
+	VM_CALLER: "CALLER", VM_ADDRESS: "ADDRESS", VM_ARG: "ARG", VM_ARGC: "ARGC",
+	VM_HEIGHT: "HEIGHT", VM_TIME: "TIME",
+	VM_CALL: "CALL", VM_RETURN: "RETURN", VM_REVERT: "REVERT",
+}
+
+// vmOpsByName 助记符到操作码，汇编器使用
+var vmOpsByName = func() map[string]VMOp {
+	m := make(map[string]VMOp, len(vmOpNames))
+	for op, name := range vmOpNames {
+		m[name] = op
+	}
+	return m
+}()
+
+func (op VMOp) String() string {
+	if name, ok := vmOpNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(0x%02x)", byte(op))
+}
+
+// immediateSize 指令后紧跟的立即数字节数（PUSH的数据另计）
+func (op VMOp) immediateSize() int {
+	switch op {
+	case VM_PUSH, VM_DUP, VM_SWAP, VM_ARG:
+		return 1
+	case VM_JUMP, VM_JUMPI:
+		return 2
+	}
+	return 0
+}
+
+// ------------------------------
+// gas表
+// ------------------------------
+
+// 各类操作的gas消耗
+const (
+	gasVMBase     = 2    // 栈操作、比较、环境查询
+	gasVMArith    = 5    // 乘除与取模
+	gasVMJump     = 8    // 跳转
+	gasVMPerWord  = 1    // CONCAT每32字节
+	gasSLoad      = 100  // 读存储
+	gasSStoreSet  = 5000 // 空键写入非空值
+	gasSStoreEdit = 800  // 修改或删除已有的值
+	gasVMCall     = 700  // 调用其他合约
+
+	gasTxContract = 1000 // 合约交易的固定开销
+	gasTxDataByte = 16   // 交易数据每字节
+	gasDeployByte = 200  // 部署时每字节代码的存储开销
+)
+
+// vmOpGas 指令的固定gas消耗，存储与拼接的额外开销执行时计算
+func vmOpGas(op VMOp) uint64 {
+	switch op {
+	case VM_MUL, VM_DIV, VM_MOD:
+		return gasVMArith
+	case VM_JUMP, VM_JUMPI:
+		return gasVMJump
+	case VM_SLOAD:
+		return gasSLoad
+	case VM_SSTORE:
+		return 0
+	case VM_CALL:
+		return gasVMCall
+	case VM_STOP:
+		return 0
+	}
+	return gasVMBase
+}
+
+// ------------------------------
+// 合约代码与汇编器
+// ------------------------------
+
+// VMCode 合约字节码
+type VMCode []byte
+
+// vmInstr 解析后的一条指令
+type vmInstr struct {
+	op     VMOp
+	offset int
+	arg    int    // DUP/SWAP/ARG的立即数，JUMP/JUMPI的目标指令序号
+	data   []byte // PUSH的数据
+}
+
+// parse 解析字节码：拒绝未知操作码、被截断的指令，以及不在指令起始位置的跳转目标
+func (c VMCode) parse() ([]vmInstr, error) {
+	if len(c) > MaxContractCodeSize {
+		return nil, fmt.Errorf("合约代码过长: %d字节", len(c))
+	}
+	var instrs []vmInstr
+	starts := make(map[int]int) // 指令偏移 -> 序号
+	for pc := 0; pc < len(c); {
+		op := VMOp(c[pc])
+		if _, ok := vmOpNames[op]; !ok {
+			return nil, fmt.Errorf("偏移%d: 未知操作码0x%02x", pc, byte(op))
+		}
+		instr := vmInstr{op: op, offset: pc}
+		next := pc + 1 + op.immediateSize()
+		if next > len(c) {
+			return nil, fmt.Errorf("偏移%d: %s指令被截断", pc, op)
+		}
+		switch op {
+		case VM_PUSH:
+			size := int(c[pc+1])
+			if next+size > len(c) {
+				return nil, fmt.Errorf("偏移%d: PUSH数据被截断", pc)
+			}
+			instr.data = append([]byte{}, c[next:next+size]...)
+			next += size
+		case VM_DUP, VM_SWAP, VM_ARG:
+			instr.arg = int(c[pc+1])
+		case VM_JUMP, VM_JUMPI:
+			instr.arg = int(binary.BigEndian.Uint16(c[pc+1:]))
+		}
+		if op == VM_SWAP && instr.arg == 0 {
+			return nil, fmt.Errorf("偏移%d: SWAP的深度不能为0", pc)
+		}
+		starts[pc] = len(instrs)
+		instrs = append(instrs, instr)
+		pc = next
+	}
+	for i, instr := range instrs {
+		if instr.op != VM_JUMP && instr.op != VM_JUMPI {
+			continue
+		}
+		target, ok := starts[instr.arg]
+		if !ok {
+			return nil, fmt.Errorf("偏移%d: 跳转目标%d不是指令起始位置", instr.offset, instr.arg)
+		}
+		instrs[i].arg = target
+	}
+	return instrs, nil
+}
+
+// String 反汇编为汇编器可读的文本，跳转目标写作偏移
+func (c VMCode) String() string {
+	instrs, err := c.parse()
+	if err != nil {
+		return "[无效代码] " + hex.EncodeToString(c)
+	}
+	lines := make([]string, 0, len(instrs))
+	for _, instr := range instrs {
+		line := fmt.Sprintf("%04d %s", instr.offset, instr.op)
+		switch instr.op {
+		case VM_PUSH:
+			line += " 0x" + hex.EncodeToString(instr.data)
+		case VM_DUP, VM_SWAP, VM_ARG:
+			line += " " + strconv.Itoa(instr.arg)
+		case VM_JUMP, VM_JUMPI:
+			line += " " + strconv.Itoa(instrs[instr.arg].offset)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AssembleVM 把汇编文本翻译为字节码。每行一条指令，";"之后为注释，"名称:"定义标签。
+// PUSH的操作数可以是十进制整数、0x开头的十六进制字节或带引号的字符串；
+// JUMP/JUMPI的操作数为标签或偏移，DUP/SWAP/ARG的操作数为整数
+func AssembleVM(source string) (VMCode, error) {
+	type pending struct {
+		line   int
+		op     VMOp
+		data   []byte
+		arg    int
+		target string // 待解析的跳转标签
+	}
+	var instrs []pending
+	labels := make(map[string]int)
+	offset := 0
+	for i, raw := range strings.Split(source, "\n") {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripAsmComment(raw))
+		if line == "" {
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			label := strings.TrimSuffix(line, ":")
+			if _, dup := labels[label]; dup || label == "" {
+				return nil, fmt.Errorf("第%d行: 标签%q重复或为空", lineNo, label)
+			}
+			labels[label] = offset
+			continue
+		}
+		name, operand := line, ""
+		if j := strings.IndexAny(line, " \t"); j >= 0 {
+			name, operand = line[:j], line[j+1:]
+		}
+		op, ok := vmOpsByName[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("第%d行: 未知指令%q", lineNo, name)
+		}
+		operand = strings.TrimSpace(operand)
+		if (op.immediateSize() > 0) != (operand != "") {
+			return nil, fmt.Errorf("第%d行: %s的操作数数量不正确", lineNo, op)
+		}
+		p := pending{line: lineNo, op: op}
+		switch op {
+		case VM_PUSH:
+			data, err := parsePushOperand(operand)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: %w", lineNo, err)
+			}
+			if len(data) > 0xff {
+				return nil, fmt.Errorf("第%d行: PUSH数据超过255字节", lineNo)
+			}
+			p.data = data
+		case VM_DUP, VM_SWAP, VM_ARG:
+			n, err := strconv.ParseUint(operand, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: 操作数%q无效", lineNo, operand)
+			}
+			p.arg = int(n)
+		case VM_JUMP, VM_JUMPI:
+			if n, err := strconv.ParseUint(operand, 10, 16); err == nil {
+				p.arg = int(n)
+			} else {
+				p.target = operand
+			}
+		}
+		instrs = append(instrs, p)
+		offset += 1 + op.immediateSize() + len(p.data)
+	}
+
+	var code VMCode
+	for _, p := range instrs {
+		code = append(code, byte(p.op))
+		switch p.op {
+		case VM_PUSH:
+			code = append(code, byte(len(p.data)))
+			code = append(code, p.data...)
+		case VM_DUP, VM_SWAP, VM_ARG:
+			code = append(code, byte(p.arg))
+		case VM_JUMP, VM_JUMPI:
+			if p.target != "" {
+				target, ok := labels[p.target]
+				if !ok {
+					return nil, fmt.Errorf("第%d行: 未定义的标签%q", p.line, p.target)
+				}
+				p.arg = target
+			}
+			if p.arg > 0xffff {
+				return nil, fmt.Errorf("第%d行: 跳转目标超出范围", p.line)
+			}
+			code = binary.BigEndian.AppendUint16(code, uint16(p.arg))
+		}
+	}
+	if _, err := code.parse(); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// stripAsmComment 去掉引号之外";"开始的注释
+func stripAsmComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// parsePushOperand 解析PUSH的操作数
+func parsePushOperand(operand string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(operand, `"`):
+		s, err := strconv.Unquote(operand)
+		if err != nil {
+			return nil, fmt.Errorf("字符串%s无效", operand)
+		}
+		return []byte(s), nil
+	case strings.HasPrefix(operand, "0x"):
+		data, err := hex.DecodeString(operand[2:])
+		if err != nil {
+			return nil, fmt.Errorf("十六进制数据%s无效", operand)
+		}
+		return data, nil
+	}
+	n, err := strconv.ParseUint(operand, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("操作数%q无效", operand)
+	}
+	return encodeVMNum(n), nil
+}
+
+// ------------------------------
+// 调用参数编码：每个参数为2字节长度（大端）加数据
+// ------------------------------
+
+// EncodeVMArgs 编码合约调用参数
+func EncodeVMArgs(args ...[]byte) []byte {
+	var data []byte
+	for _, arg := range args {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(arg)))
+		data = append(data, arg...)
+	}
+	return data
+}
+
+// decodeVMArgs 解码合约调用参数
+func decodeVMArgs(data []byte) ([][]byte, error) {
+	var args [][]byte
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("调用参数被截断")
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+size {
+			return nil, errors.New("调用参数被截断")
+		}
+		if size > MaxVMElement {
+			return nil, fmt.Errorf("调用参数超过%d字节", MaxVMElement)
+		}
+		args = append(args, data[2:2+size])
+		data = data[2+size:]
+	}
+	if len(args) > MaxVMArgs {
+		return nil, fmt.Errorf("调用参数超过%d个", MaxVMArgs)
+	}
+	return args, nil
+}
+
+// ------------------------------
+// 栈元素编码
+// ------------------------------
+
+// encodeVMNum 最短大端编码，0为空串
+func encodeVMNum(n uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	i := 0
+	for i < len(buf) && buf[i] == 0 {
+		i++
+	}
+	return append([]byte{}, buf[i:]...)
+}
+
+// decodeVMNum 解码大端无符号整数，最多8字节
+func decodeVMNum(data []byte) (uint64, error) {
+	if len(data) > 8 {
+		return 0, fmt.Errorf("数值元素过长: %d字节", len(data))
+	}
+	var n uint64
+	for _, b := range data {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+// vmTruthy 含非零字节即为真
+func vmTruthy(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func vmBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return nil
+}
+
+// ------------------------------
+// 解释器
+// ------------------------------
+
+// VMContext 合约执行所在的交易与区块上下文
+type VMContext struct {
+	Origin      Address // 发起交易的外部账户
+	BlockHeight int
+	BlockTime   int64 // 区块时间戳（纳秒）
+}
+
+// vmJournalEntry 存储修改记录，回滚时按相反顺序撤销
+type vmJournalEntry struct {
+	addr    Address
+	key     string
+	prev    []byte // 修改前的值，nil表示原先不存在
+	created bool   // 记录合约创建，回滚时删除合约
+}
+
+// VM 一笔交易的执行状态：全部调用共享gas与修改记录
+type VM struct {
+	state   contractState
+	ctx     VMContext
+	gas     uint64
+	journal []vmJournalEntry
+	depth   int
+	logs    []Log // 成功执行的EVM调用记录的事件
+}
+
+func newVM(state contractState, ctx VMContext, gas uint64) *VM {
+	return &VM{state: state, ctx: ctx, gas: gas}
+}
+
+// useGas 扣除gas，不足时清零并返回ErrOutOfGas
+func (vm *VM) useGas(amount uint64) error {
+	if vm.gas < amount {
+		vm.gas = 0
+		return ErrOutOfGas
+	}
+	vm.gas -= amount
+	return nil
+}
+
+// revert 撤销mark之后的全部修改
+func (vm *VM) revert(mark int) {
+	for i := len(vm.journal) - 1; i >= mark; i-- {
+		entry := vm.journal[i]
+		if entry.created {
+			delete(vm.state, entry.addr)
+			continue
+		}
+		contract := vm.state[entry.addr]
+		if entry.prev == nil {
+			delete(contract.storage, entry.key)
+		} else {
+			contract.storage[entry.key] = entry.prev
+		}
+	}
+	vm.journal = vm.journal[:mark]
+}
+
+// create 在addr部署合约代码
+func (vm *VM) create(addr Address, code VMCode) error {
+	if _, ok := vm.state[addr]; ok {
+		return fmt.Errorf("地址 %s 已存在合约", addr)
+	}
+	if _, err := code.parse(); err != nil {
+		return err
+	}
+	vm.state[addr] = &contractAccount{code: append(VMCode(nil), code...), storage: make(map[string][]byte)}
+	vm.journal = append(vm.journal, vmJournalEntry{addr: addr, created: true})
+	return nil
+}
+
+// sstore 写入存储并记录修改，空值即删除
+func (vm *VM) sstore(addr Address, key, value []byte) error {
+	contract := vm.state[addr]
+	_, existed := contract.storage[string(key)]
+	cost := uint64(gasSStoreEdit)
+	if !existed && len(value) > 0 {
+		cost = gasSStoreSet
+	}
+	if err := vm.useGas(cost); err != nil {
+		return err
+	}
+	vm.setStorage(addr, key, value)
+	return nil
+}
+
+// setStorage 写入存储并记录修改（不计gas），空值即删除
+func (vm *VM) setStorage(addr Address, key, value []byte) {
+	contract := vm.state[addr]
+	entry := vmJournalEntry{addr: addr, key: string(key)}
+	if prev, existed := contract.storage[string(key)]; existed {
+		entry.prev = prev
+	}
+	vm.journal = append(vm.journal, entry)
+	if len(value) == 0 {
+		delete(contract.storage, string(key))
+	} else {
+		contract.storage[string(key)] = append([]byte{}, value...)
+	}
+}
+
+// call 以caller身份调用合约；执行失败时撤销本次调用及其子调用的全部修改
+func (vm *VM) call(caller, addr Address, args [][]byte) ([]byte, error) {
+	contract, ok := vm.state[addr]
+	if !ok {
+		return nil, fmt.Errorf("地址 %s 没有合约", addr)
+	}
+	if contract.evm {
+		return nil, fmt.Errorf("地址 %s 是EVM合约，不能从合约虚拟机调用", addr)
+	}
+	if vm.depth >= MaxVMCallDepth {
+		return nil, fmt.Errorf("调用深度超过%d", MaxVMCallDepth)
+	}
+	instrs, err := contract.code.parse()
+	if err != nil {
+		return nil, err
+	}
+	mark := len(vm.journal)
+	vm.depth++
+	f := &vmFrame{vm: vm, caller: caller, self: addr, args: args}
+	ret, err := f.run(instrs)
+	vm.depth--
+	if err != nil {
+		vm.revert(mark)
+		return nil, err
+	}
+	return ret, nil
+}
+
+// vmFrame 单次合约调用的执行状态
+type vmFrame struct {
+	vm     *VM
+	caller Address
+	self   Address
+	args   [][]byte
+	stack  [][]byte
+}
+
+func (f *vmFrame) push(data []byte) error {
+	if len(data) > MaxVMElement {
+		return fmt.Errorf("栈元素过大: %d字节", len(data))
+	}
+	if len(f.stack) >= MaxVMStack {
+		return errors.New("栈溢出")
+	}
+	f.stack = append(f.stack, data)
+	return nil
+}
+
+func (f *vmFrame) pop() ([]byte, error) {
+	if len(f.stack) == 0 {
+		return nil, errors.New("栈为空")
+	}
+	top := f.stack[len(f.stack)-1]
+	f.stack = f.stack[:len(f.stack)-1]
+	return top, nil
+}
+
+func (f *vmFrame) popNum() (uint64, error) {
+	data, err := f.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeVMNum(data)
+}
+
+// pop2 弹出两个数值，先压栈的为a
+func (f *vmFrame) pop2() (a, b uint64, err error) {
+	if b, err = f.popNum(); err != nil {
+		return 0, 0, err
+	}
+	a, err = f.popNum()
+	return a, b, err
+}
+
+// run 逐条执行指令，执行到末尾等同于STOP
+func (f *vmFrame) run(instrs []vmInstr) ([]byte, error) {
+	for pc := 0; pc < len(instrs); {
+		instr := instrs[pc]
+		pc++
+		if err := f.vm.useGas(vmOpGas(instr.op)); err != nil {
+			return nil, err
+		}
+		switch instr.op {
+		case VM_STOP:
+			return nil, nil
+		case VM_RETURN:
+			return f.pop()
+		case VM_REVERT:
+			reason, err := f.pop()
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %s", ErrExecutionReverted, reason)
+		case VM_JUMP:
+			pc = instr.arg
+		case VM_JUMPI:
+			cond, err := f.pop()
+			if err != nil {
+				return nil, err
+			}
+			if vmTruthy(cond) {
+				pc = instr.arg
+			}
+		default:
+			if err := f.step(instr); err != nil {
+				return nil, fmt.Errorf("偏移%d %s: %w", instr.offset, instr.op, err)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// step 执行不改变控制流的指令
+func (f *vmFrame) step(instr vmInstr) error {
+	switch instr.op {
+	case VM_PUSH:
+		return f.push(instr.data)
+	case VM_POP:
+		_, err := f.pop()
+		return err
+	case VM_DUP:
+		if instr.arg >= len(f.stack) {
+			return errors.New("栈元素不足")
+		}
+		return f.push(f.stack[len(f.stack)-1-instr.arg])
+	case VM_SWAP:
+		if instr.arg >= len(f.stack) {
+			return errors.New("栈元素不足")
+		}
+		n := len(f.stack) - 1
+		f.stack[n], f.stack[n-instr.arg] = f.stack[n-instr.arg], f.stack[n]
+	case VM_ADD, VM_SUB, VM_MUL, VM_DIV, VM_MOD, VM_LT, VM_GT:
+		a, b, err := f.pop2()
+		if err != nil {
+			return err
+		}
+		return f.arith(instr.op, a, b)
+	case VM_EQ, VM_AND, VM_OR, VM_CONCAT:
+		b, err := f.pop()
+		if err != nil {
+			return err
+		}
+		a, err := f.pop()
+		if err != nil {
+			return err
+		}
+		switch instr.op {
+		case VM_EQ:
+			return f.push(vmBool(bytes.Equal(a, b)))
+		case VM_AND:
+			return f.push(vmBool(vmTruthy(a) && vmTruthy(b)))
+		case VM_OR:
+			return f.push(vmBool(vmTruthy(a) || vmTruthy(b)))
+		}
+		joined := append(append([]byte{}, a...), b...)
+		if err := f.vm.useGas(uint64(len(joined)+31) / 32 * gasVMPerWord); err != nil {
+			return err
+		}
+		return f.push(joined)
+	case VM_ISZERO:
+		top, err := f.pop()
+		if err != nil {
+			return err
+		}
+		return f.push(vmBool(!vmTruthy(top)))
+	case VM_SLOAD:
+		key, err := f.pop()
+		if err != nil {
+			return err
+		}
+		return f.push(f.vm.state[f.self].storage[string(key)])
+	case VM_SSTORE:
+		value, err := f.pop()
+		if err != nil {
+			return err
+		}
+		key, err := f.pop()
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 || len(key) > MaxVMElement {
+			return errors.New("存储键为空或过长")
+		}
+		return f.vm.sstore(f.self, key, value)
+	case VM_CALLER:
+		return f.push([]byte(f.caller.String()))
+	case VM_ADDRESS:
+		return f.push([]byte(f.self.String()))
+	case VM_ARG:
+		if instr.arg >= len(f.args) {
+			return f.push(nil)
+		}
+		return f.push(f.args[instr.arg])
+	case VM_ARGC:
+		return f.push(encodeVMNum(uint64(len(f.args))))
+	case VM_HEIGHT:
+		return f.push(encodeVMNum(uint64(f.vm.ctx.BlockHeight)))
+	case VM_TIME:
+		return f.push(encodeVMNum(uint64(f.vm.ctx.BlockTime / 1e9)))
+	case VM_CALL:
+		return f.call()
+	default:
+		return errors.New("不支持的操作码")
+	}
+	return nil
+}
+
+// arith 数值运算与比较
+func (f *vmFrame) arith(op VMOp, a, b uint64) error {
+	var result uint64
+	switch op {
+	case VM_ADD:
+		result = a + b
+		if result < a {
+			return errors.New("整数溢出")
+		}
+	case VM_SUB:
+		if a < b {
+			return errors.New("整数下溢")
+		}
+		result = a - b
+	case VM_MUL:
+		result = a * b
+		if a != 0 && result/a != b {
+			return errors.New("整数溢出")
+		}
+	case VM_DIV, VM_MOD:
+		if b == 0 {
+			return errors.New("除以0")
+		}
+		if op == VM_DIV {
+			result = a / b
+		} else {
+			result = a % b
+		}
+	case VM_LT:
+		return f.push(vmBool(a < b))
+	case VM_GT:
+		return f.push(vmBool(a > b))
+	}
+	return f.push(encodeVMNum(result))
+}
+
+// call 调用其他合约：被调用合约失败时其修改已撤销，压入空返回数据与失败标志，
+// 由调用方决定是否继续；gas耗尽则整笔交易失败
+func (f *vmFrame) call() error {
+	target, err := f.pop()
+	if err != nil {
+		return err
+	}
+	n, err := f.popNum()
+	if err != nil {
+		return err
+	}
+	if n > MaxVMArgs || int(n) > len(f.stack) {
+		return fmt.Errorf("调用参数个数%d无效", n)
+	}
+	args := append([][]byte(nil), f.stack[len(f.stack)-int(n):]...)
+	f.stack = f.stack[:len(f.stack)-int(n)]
+	addr, err := ParseAddress(string(target))
+	if err != nil {
+		return err
+	}
+	ret, err := f.vm.call(f.self, addr, args)
+	if errors.Is(err, ErrOutOfGas) {
+		return err
+	}
+	if err := f.push(ret); err != nil {
+		return err
+	}
+	return f.push(vmBool(err == nil))
+}
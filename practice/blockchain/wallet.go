@@ -0,0 +1,463 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ------------------------------
+// 钱包模块封装：管理多把密钥，构造、签名、提交交易并追踪余额与历史
+// ------------------------------
+
+// walletKey 钱包中的一把密钥
+type walletKey struct {
+	label string
+	keys  KeyPair
+}
+
+// Wallet 钱包，密钥可随机生成、导入，或由HD种子确定性派生
+type Wallet struct {
+	path       string
+	passphrase string // 钱包文件的加密口令，为空则明文保存
+	keys       []*walletKey
+	seed       []byte    // HD种子，为空表示非HD钱包
+	scheme     KeyScheme // HD派生使用的算法
+	nextKey    uint32    // 下一个待派生的HD索引
+}
+
+// WalletRecord 钱包相关的一条交易记录
+type WalletRecord struct {
+	TxID       string
+	BlockIndex int // -1 表示尚未打包
+	Sender     Address
+	Recipient  Address
+	Received   Amount // 钱包地址收到的金额
+	Spent      Amount // 钱包地址支出的金额（含手续费），钱包内部互转时两者都有
+}
+
+// Confirmed 是否已被打包进区块
+func (r WalletRecord) Confirmed() bool { return r.BlockIndex >= 0 }
+
+// NewWallet 创建空钱包，path为持久化文件路径
+func NewWallet(path string) *Wallet {
+	return &Wallet{path: path}
+}
+
+// NewHDWallet 创建由助记词派生密钥的钱包
+func NewHDWallet(path, mnemonic, passphrase string, scheme KeyScheme) (*Wallet, error) {
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{path: path, seed: seed, scheme: scheme}, nil
+}
+
+// NewKey 新增一把密钥：HD钱包按顺序派生，否则随机生成Ed25519密钥
+func (w *Wallet) NewKey(label string) (Address, error) {
+	var keys KeyPair
+	var err error
+	if w.seed != nil {
+		// 派生失败时不跳过该索引
+		if keys, err = w.deriveKey(w.nextKey); err == nil {
+			w.nextKey++
+		}
+	} else {
+		keys, err = NewEd25519KeyPair()
+	}
+	if err != nil {
+		return Address{}, err
+	}
+	return w.ImportKey(label, keys)
+}
+
+// deriveKey 派生默认路径下第index个密钥
+func (w *Wallet) deriveKey(index uint32) (KeyPair, error) {
+	master, err := NewMasterKey(w.seed, w.scheme)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("%s/%d'", DefaultDerivationPath, index)
+	child, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return child.KeyPair()
+}
+
+// ImportKey 导入已有密钥
+func (w *Wallet) ImportKey(label string, keys KeyPair) (Address, error) {
+	addr := keys.Address()
+	if w.key(addr) != nil {
+		return Address{}, fmt.Errorf("地址 %s 已在钱包中", addr)
+	}
+	w.keys = append(w.keys, &walletKey{label: label, keys: keys})
+	return addr, nil
+}
+
+// Addresses 返回钱包内全部地址
+func (w *Wallet) Addresses() []Address {
+	addrs := make([]Address, 0, len(w.keys))
+	for _, k := range w.keys {
+		addrs = append(addrs, k.keys.Address())
+	}
+	return addrs
+}
+
+// AddressByLabel 按标签查找地址
+func (w *Wallet) AddressByLabel(label string) (Address, bool) {
+	for _, k := range w.keys {
+		if k.label == label {
+			return k.keys.Address(), true
+		}
+	}
+	return Address{}, false
+}
+
+// Owns 判断地址是否属于钱包
+func (w *Wallet) Owns(addr Address) bool {
+	return w.key(addr) != nil
+}
+
+func (w *Wallet) key(addr Address) *walletKey {
+	for _, k := range w.keys {
+		if k.keys.Address() == addr {
+			return k
+		}
+	}
+	return nil
+}
+
+// BuildTransaction 构造并签名一笔转账，会检查可用余额
+func (w *Wallet) BuildTransaction(bc *Blockchain, from, to Address, amount Amount, opts ...TxOption) (*Transaction, error) {
+	k := w.key(from)
+	if k == nil {
+		return nil, fmt.Errorf("钱包中没有地址 %s 的私钥", from)
+	}
+	if to.IsZero() {
+		return nil, errors.New("收款地址为空")
+	}
+	// 序号与链ID自动填写，选项可覆盖；未指定最高手续费时按手续费历史估算
+	tx := NewTransaction(from, to, amount)
+	tx.nonce = bc.NextNonce(from)
+	tx.chainID = bc.ChainID()
+	for _, opt := range opts {
+		opt(tx)
+	}
+	if tx.fee == 0 {
+		if err := bc.estimateFees(tx); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.checkKind(); err != nil {
+		return nil, err
+	}
+	cost, err := tx.Cost()
+	if err != nil {
+		return nil, err
+	}
+	if available := w.AvailableBalance(bc, from); available < cost {
+		return nil, fmt.Errorf("余额不足: 可用 %s，需要 %s", available, cost)
+	}
+	if err := tx.Sign(k.keys); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// WithFee 指定最高手续费
+func WithFee(fee Amount) TxOption {
+	return func(t *Transaction) { t.fee = fee }
+}
+
+// WithTip 指定最高小费
+func WithTip(tip Amount) TxOption {
+	return func(t *Transaction) { t.tip, t.hasTip = tip, true }
+}
+
+// Send 构造、签名并提交交易到区块链
+func (w *Wallet) Send(bc *Blockchain, from, to Address, amount Amount, opts ...TxOption) (*Transaction, error) {
+	tx, err := w.BuildTransaction(bc, from, to, amount, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// SignMultisig 用钱包内属于该多签策略的全部密钥签名，返回新增签名数
+func (w *Wallet) SignMultisig(p *PartiallySignedTransaction) (int, error) {
+	signed := 0
+	for _, k := range w.keys {
+		if p.IsComplete() {
+			break
+		}
+		if p.policy.keyIndex(k.keys.PublicKeyBytes()) < 0 {
+			continue
+		}
+		if err := p.Sign(k.keys); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+	return signed, nil
+}
+
+// Balance 返回地址的已确认余额
+func (w *Wallet) Balance(bc *Blockchain, addr Address) Amount {
+	return bc.Balance(addr)
+}
+
+// AvailableBalance 可花费余额减去待打包的支出，不足时为0
+func (w *Wallet) AvailableBalance(bc *Blockchain, addr Address) Amount {
+	balance := bc.SpendableBalance(addr)
+	for _, tx := range bc.PendingTransactions() {
+		if tx.Sender() != addr {
+			continue
+		}
+		cost, err := tx.Cost()
+		if err != nil {
+			return 0
+		}
+		if balance, err = balance.Sub(cost); err != nil {
+			return 0
+		}
+	}
+	return balance
+}
+
+// TotalBalance 钱包内全部地址的已确认余额之和
+func (w *Wallet) TotalBalance(bc *Blockchain) Amount {
+	var balances []Amount
+	for _, addr := range w.Addresses() {
+		balances = append(balances, bc.Balance(addr))
+	}
+	return mustBalance(SumAmounts(balances...))
+}
+
+// History 扫描区块与待打包交易，返回与钱包地址相关的记录
+func (w *Wallet) History(bc *Blockchain) []WalletRecord {
+	var records []WalletRecord
+	for _, block := range bc.Blocks() {
+		for _, tx := range block.Transactions() {
+			if record, ok := w.record(tx, block); ok {
+				records = append(records, record)
+			}
+		}
+	}
+	for _, tx := range bc.PendingTransactions() {
+		if record, ok := w.record(tx, nil); ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// record 计算交易对钱包的收支，block为nil表示待打包交易（按最高手续费计算支出）
+func (w *Wallet) record(tx *Transaction, block *Block) (WalletRecord, bool) {
+	in, out := w.Owns(tx.Recipient()), !tx.IsCoinbase() && w.Owns(tx.Sender())
+	if !in && !out {
+		return WalletRecord{}, false
+	}
+	record := WalletRecord{
+		TxID:       tx.ID(),
+		BlockIndex: -1,
+		Sender:     tx.Sender(),
+		Recipient:  tx.Recipient(),
+	}
+	if in {
+		record.Received = tx.Credit()
+	}
+	if out {
+		// 交易已通过入池或区块校验，总支出不会溢出
+		record.Spent, _ = tx.Cost()
+	}
+	if block != nil {
+		record.BlockIndex = block.Index()
+		if out {
+			record.Spent, _ = tx.CostAt(block.BaseFee())
+		}
+	}
+	return record, true
+}
+
+// ------------------------------
+// 钱包持久化
+// ------------------------------
+
+// walletKDFIterations 由口令派生钱包文件加密密钥的PBKDF2-SHA256迭代次数
+const walletKDFIterations = 600_000
+
+// ErrWrongPassphrase 钱包口令错误或文件被篡改
+var ErrWrongPassphrase = errors.New("钱包口令错误或文件已损坏")
+
+// walletFile 钱包文件格式，私钥以PEM保存；设置了口令时除Encrypted外的字段都为空
+type walletFile struct {
+	Scheme    string            `json:"scheme,omitempty"`
+	Seed      string            `json:"seed,omitempty"`
+	NextKey   uint32            `json:"next_key,omitempty"`
+	Keys      []walletFileEntry `json:"keys"`
+	Encrypted *encryptedWallet  `json:"encrypted,omitempty"`
+}
+
+// encryptedWallet 以口令加密的钱包内容：PBKDF2-SHA256派生AES-256-GCM密钥
+type encryptedWallet struct {
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// walletCipher 由口令与盐派生AES-GCM
+func walletCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptWallet 以口令加密钱包文件内容
+func encryptWallet(plaintext []byte, passphrase string) (*encryptedWallet, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := walletCipher(passphrase, salt, walletKDFIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &encryptedWallet{
+		Salt:       hex.EncodeToString(salt),
+		Iterations: walletKDFIterations,
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, plaintext, nil)),
+	}, nil
+}
+
+// decrypt 以口令解密钱包文件内容，口令错误时返回ErrWrongPassphrase
+func (e *encryptedWallet) decrypt(passphrase string) ([]byte, error) {
+	salt, err1 := hex.DecodeString(e.Salt)
+	nonce, err2 := hex.DecodeString(e.Nonce)
+	ciphertext, err3 := hex.DecodeString(e.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("加密钱包格式错误: %w", err)
+	}
+	if e.Iterations <= 0 {
+		return nil, fmt.Errorf("加密钱包的迭代次数%d无效", e.Iterations)
+	}
+	aead, err := walletCipher(passphrase, salt, e.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("加密钱包格式错误: nonce长度不符")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+type walletFileEntry struct {
+	Label string `json:"label"`
+	PEM   string `json:"pem"`
+}
+
+// SetPassphrase 设置钱包文件的加密口令，之后Save加密保存；空口令表示明文保存
+func (w *Wallet) SetPassphrase(passphrase string) {
+	w.passphrase = passphrase
+}
+
+// Save 将钱包写入磁盘（仅所有者可读），设置了口令时加密保存私钥与种子
+func (w *Wallet) Save() error {
+	file := walletFile{NextKey: w.nextKey, Keys: make([]walletFileEntry, 0, len(w.keys))}
+	if w.seed != nil {
+		file.Scheme = w.scheme.String()
+		file.Seed = hex.EncodeToString(w.seed)
+	}
+	for _, k := range w.keys {
+		block, err := marshalPrivateKeyPEM(k.keys)
+		if err != nil {
+			return err
+		}
+		file.Keys = append(file.Keys, walletFileEntry{Label: k.label, PEM: string(pem.EncodeToMemory(block))})
+	}
+	if w.passphrase != "" {
+		plaintext, err := json.Marshal(file)
+		if err != nil {
+			return err
+		}
+		encrypted, err := encryptWallet(plaintext, w.passphrase)
+		if err != nil {
+			return err
+		}
+		file = walletFile{Encrypted: encrypted}
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.path, data, 0600)
+}
+
+// LoadWallet 从磁盘加载钱包，加密的钱包需提供保存时的口令
+func LoadWallet(path, passphrase string) (*Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file walletFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析钱包文件失败: %w", err)
+	}
+	if file.Encrypted != nil {
+		plaintext, err := file.Encrypted.decrypt(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		file = walletFile{}
+		if err := json.Unmarshal(plaintext, &file); err != nil {
+			return nil, fmt.Errorf("解析钱包文件失败: %w", err)
+		}
+	} else if passphrase != "" {
+		return nil, errors.New("钱包文件未加密，不需要口令")
+	}
+
+	w := &Wallet{path: path, passphrase: passphrase, nextKey: file.NextKey}
+	if file.Seed != "" {
+		if w.seed, err = hex.DecodeString(file.Seed); err != nil {
+			return nil, fmt.Errorf("钱包种子格式错误: %w", err)
+		}
+		if w.scheme, err = ParseKeyScheme(file.Scheme); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range file.Keys {
+		keys, err := parsePrivateKeyPEM([]byte(entry.PEM))
+		if err != nil {
+			return nil, fmt.Errorf("加载密钥 %q 失败: %w", entry.Label, err)
+		}
+		w.keys = append(w.keys, &walletKey{label: entry.Label, keys: keys})
+	}
+	return w, nil
+}